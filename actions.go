@@ -0,0 +1,83 @@
+package fire
+
+import (
+	"context"
+	"time"
+
+	"github.com/256dpi/xo"
+
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+// ReorderAction returns a resource action that moves the resource before or
+// after another resource of the same scope using coal.Manager.Reorder. The
+// target is provided as a JSON body in the form:
+//
+//	{ "before": "<id>" } or { "after": "<id>" }
+//
+// The action responds with the updated rank of the resource:
+//
+//	{ "rank": "<rank>" }
+//
+// The model must have a registered ranking (see coal.AddRanking).
+func ReorderAction(timeout time.Duration) *Action {
+	return A("fire/ReorderAction", []string{"POST"}, 0, timeout, func(ctx *Context) error {
+		// get ranking
+		ranking := coal.GetMeta(ctx.Model).Ranking
+		if ranking == nil {
+			return xo.F("model has no ranking")
+		}
+
+		// parse body
+		var body struct {
+			Before string `json:"before"`
+			After  string `json:"after"`
+		}
+		err := ctx.Parse(&body)
+		if err != nil {
+			return err
+		}
+
+		// check body
+		if (body.Before == "") == (body.After == "") {
+			return xo.SF("expected either a before or after target")
+		}
+
+		// get target
+		after := body.After != ""
+		rawTarget := body.Before
+		if after {
+			rawTarget = body.After
+		}
+
+		// parse target
+		target, err := coal.FromHex(rawTarget)
+		if err != nil {
+			return xo.SF("invalid target")
+		}
+
+		// reorder model
+		err = ctx.Store.S(ctx.Model).T(ctx.Context, false, func(tc context.Context) error {
+			return ctx.With(tc, func() error {
+				found, err := ctx.Store.M(ctx.Model).Reorder(ctx, ctx.Model, ctx.Model.ID(), target, after)
+				if coal.ErrInvalidRankTarget.Is(err) {
+					return xo.SF("invalid target")
+				} else if err != nil {
+					return err
+				} else if !found {
+					return ErrResourceNotFound.Wrap()
+				}
+
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		return ctx.Respond(map[string]string{
+			"rank": string(stick.MustGet(ctx.Model, ranking.Field).(coal.Rank)),
+		})
+	})
+}
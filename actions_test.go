@@ -0,0 +1,108 @@
+package fire
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/256dpi/fire/coal"
+)
+
+func TestReorderAction(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, &itemModel{})
+		tester.Clean()
+
+		tester.Assign("", &Controller{
+			Model:   &itemModel{},
+			Filters: []string{"List"},
+			ResourceActions: M{
+				"reorder": ReorderAction(0),
+			},
+		})
+
+		a := tester.Insert(&itemModel{Name: "a", List: "x"}).(*itemModel)
+		b := tester.Insert(&itemModel{Name: "b", List: "x"}).(*itemModel)
+		c := tester.Insert(&itemModel{Name: "c", List: "x"}).(*itemModel)
+		y := tester.Insert(&itemModel{Name: "y", List: "y"}).(*itemModel)
+
+		names := func() []string {
+			var list []string
+			tester.Request("GET", "items?filter[list]=x", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+				assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+				for _, name := range gjson.Get(r.Body.String(), "data.#.attributes.name").Array() {
+					list = append(list, name.String())
+				}
+			})
+			return list
+		}
+
+		// default sorting
+		assert.Equal(t, []string{"a", "b", "c"}, names())
+
+		// move before
+		tester.Request("POST", "items/"+c.ID().Hex()+"/reorder", `{
+			"before": "`+a.ID().Hex()+`"
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"rank": "9"
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+		assert.Equal(t, []string{"c", "a", "b"}, names())
+
+		// move after
+		tester.Request("POST", "items/"+c.ID().Hex()+"/reorder", `{
+			"after": "`+b.ID().Hex()+`"
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+		})
+		assert.Equal(t, []string{"a", "b", "c"}, names())
+
+		// requested sorting
+		tester.Request("GET", "items?filter[list]=x&sort=-name", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+		})
+
+		// invalid body
+		tester.Request("POST", "items/"+c.ID().Hex()+"/reorder", `{
+			"before": "`+a.ID().Hex()+`",
+			"after": "`+b.ID().Hex()+`"
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"title": "bad request",
+					"detail": "expected either a before or after target"
+				}]
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// other scope
+		tester.Request("POST", "items/"+c.ID().Hex()+"/reorder", `{
+			"before": "`+y.ID().Hex()+`"
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"title": "bad request",
+					"detail": "invalid target"
+				}]
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// missing target
+		tester.Request("POST", "items/"+c.ID().Hex()+"/reorder", `{
+			"after": "`+coal.New().Hex()+`"
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+		})
+
+		assert.Equal(t, []string{"a", "b", "c"}, names())
+	})
+}
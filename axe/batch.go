@@ -0,0 +1,64 @@
+package axe
+
+import (
+	"context"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/fire/coal"
+)
+
+func eachBatch(ctx context.Context, store *coal.Store, model coal.Model, batch int, fn func(ids []coal.ID) error) error {
+	// prepare cursor
+	var cursor coal.ID
+
+	for {
+		// prepare filter
+		filter := bson.M{}
+		if !cursor.IsZero() {
+			filter["_id"] = bson.M{
+				"$gt": cursor,
+			}
+		}
+
+		// find next batch
+		iter, err := store.C(model).Find(ctx, filter, options.Find().
+			SetProjection(bson.M{"_id": 1}).
+			SetSort(bson.M{"_id": 1}).
+			SetLimit(int64(batch)))
+		if err != nil {
+			return err
+		}
+
+		// decode documents
+		var docs []struct {
+			ID coal.ID `bson:"_id"`
+		}
+		err = iter.All(&docs)
+		if err != nil {
+			return xo.W(err)
+		}
+
+		// check documents
+		if len(docs) == 0 {
+			return nil
+		}
+
+		// collect ids
+		ids := make([]coal.ID, 0, len(docs))
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+
+		// yield batch
+		err = fn(ids)
+		if err != nil {
+			return err
+		}
+
+		// advance cursor
+		cursor = ids[len(ids)-1]
+	}
+}
@@ -0,0 +1,83 @@
+package axe
+
+import (
+	"time"
+
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+// IntegrityJob is the job enqueued to scan models for dangling references.
+type IntegrityJob struct {
+	Base               `json:"-" axe:"axe/integrity"`
+	stick.NoValidation `json:"-"`
+
+	// The plural name of the model to scan. If empty, all models of the
+	// registry are scanned.
+	Model string `json:"model"`
+
+	// Whether dangling references should be repaired.
+	Repair bool `json:"repair"`
+}
+
+// IntegrityTask will return a task that scans the models in the registry for
+// dangling references using coal.ScanReferences in batches of the specified
+// size. Found references are yielded to the provided report function. The
+// repair option of the scan options is enabled if requested by the job.
+func IntegrityTask(store *coal.Store, registry *coal.Registry, opts coal.ScanOptions, batch int, report func(coal.DanglingReference)) *Task {
+	// set default batch
+	if batch == 0 {
+		batch = 100
+	}
+
+	return &Task{
+		Job: &IntegrityJob{},
+		Handler: func(ctx *Context) error {
+			// get job
+			job := ctx.Job.(*IntegrityJob)
+
+			// collect models
+			models := registry.All()
+			if job.Model != "" {
+				model := registry.Lookup(job.Model)
+				if model == nil {
+					return E("unknown model", false)
+				}
+				models = []coal.Model{model}
+			}
+
+			// prepare options
+			scanOpts := opts
+			scanOpts.Repair = opts.Repair || job.Repair
+
+			// scan models
+			for _, model := range models {
+				err := eachBatch(ctx, store, model, batch, func(ids []coal.ID) error {
+					// scan references
+					refs, err := coal.ScanReferences(ctx, store, registry, model, ids, scanOpts)
+					if err != nil {
+						return err
+					}
+
+					// report references
+					if report != nil {
+						for _, ref := range refs {
+							report(ref)
+						}
+					}
+
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Workers:     1,
+		MaxAttempts: 1,
+		Lifetime:    time.Hour,
+		Timeout:     2 * time.Hour,
+	}
+}
@@ -0,0 +1,67 @@
+package axe
+
+import (
+	"testing"
+
+	"github.com/256dpi/xo"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/coal"
+)
+
+func TestIntegrityTask(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *fire.Tester) {
+		tester.DeleteAll(&listModel{})
+		_, err := tester.Store.C(&itemModel{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		list := tester.Insert(&listModel{}).(*listModel)
+		missing := coal.New()
+		item := &itemModel{Base: coal.B(), List: missing}
+		_, err = tester.Store.C(&itemModel{}).InsertMany(nil, []interface{}{
+			&itemModel{Base: coal.B(), List: list.ID()},
+			item,
+		})
+		assert.NoError(t, err)
+
+		done := make(chan struct{})
+
+		queue := NewQueue(Options{
+			Store:    tester.Store,
+			Reporter: xo.Panic,
+		})
+
+		var refs []coal.DanglingReference
+		task := IntegrityTask(tester.Store, coal.NewRegistry(&listModel{}, &itemModel{}), coal.ScanOptions{}, 1, func(ref coal.DanglingReference) {
+			refs = append(refs, ref)
+		})
+		task.Notifier = func(ctx *Context, cancelled bool, reason string) error {
+			assert.False(t, cancelled)
+			close(done)
+			return nil
+		}
+		queue.Add(task)
+
+		<-queue.Run()
+
+		enqueued, err := queue.Enqueue(nil, &IntegrityJob{Repair: true}, 0, 0)
+		assert.NoError(t, err)
+		assert.True(t, enqueued)
+
+		<-done
+
+		assert.Equal(t, []coal.DanglingReference{
+			{
+				Model:     "items",
+				ID:        item.ID(),
+				Field:     "List",
+				RelType:   "lists",
+				Reference: missing,
+			},
+		}, refs)
+
+		queue.Close()
+	})
+}
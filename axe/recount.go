@@ -0,0 +1,75 @@
+package axe
+
+import (
+	"time"
+
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+// RecountJob is the job enqueued to recount the counter fields of models.
+type RecountJob struct {
+	Base               `json:"-" axe:"axe/recount"`
+	stick.NoValidation `json:"-"`
+
+	// The plural name of the model to recount. If empty, all models of the
+	// registry that own counters are recounted.
+	Model string `json:"model"`
+}
+
+// RecountTask will return a task that recomputes the counter fields registered
+// using coal.AddCounter for the models in the registry. Documents are
+// recounted in batches of the specified size.
+func RecountTask(store *coal.Store, registry *coal.Registry, batch int) *Task {
+	// set default batch
+	if batch == 0 {
+		batch = 100
+	}
+
+	return &Task{
+		Job: &RecountJob{},
+		Handler: func(ctx *Context) error {
+			// get job
+			job := ctx.Job.(*RecountJob)
+
+			// collect models
+			var models []coal.Model
+			if job.Model != "" {
+				model := registry.Lookup(job.Model)
+				if model == nil {
+					return E("unknown model", false)
+				}
+				models = append(models, model)
+			} else {
+				for _, model := range registry.All() {
+					for _, counter := range coal.GetMeta(model).Counters {
+						if counter.Owner == coal.GetMeta(model) {
+							models = append(models, model)
+							break
+						}
+					}
+				}
+			}
+
+			// recount models
+			for _, model := range models {
+				err := recount(ctx, store, model, batch)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Workers:     1,
+		MaxAttempts: 1,
+		Lifetime:    time.Hour,
+		Timeout:     2 * time.Hour,
+	}
+}
+
+func recount(ctx *Context, store *coal.Store, model coal.Model, batch int) error {
+	return eachBatch(ctx, store, model, batch, func(ids []coal.ID) error {
+		return coal.Recount(ctx, store, model, ids...)
+	})
+}
@@ -0,0 +1,83 @@
+package axe
+
+import (
+	"testing"
+
+	"github.com/256dpi/xo"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/coal"
+)
+
+type listModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"lists"`
+	ItemCount int          `json:"item-count"`
+	Items     coal.HasMany `json:"-" bson:"-" coal:"items:items:list"`
+}
+
+func (m *listModel) Validate() error {
+	return nil
+}
+
+type itemModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"items"`
+	List      coal.ID `json:"-" coal:"list:lists"`
+}
+
+func (m *itemModel) Validate() error {
+	return nil
+}
+
+func init() {
+	coal.AddCounter(&listModel{}, "ItemCount", "Items", &itemModel{}, "")
+}
+
+func TestRecountTask(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *fire.Tester) {
+		tester.DeleteAll(&listModel{})
+		_, err := tester.Store.C(&itemModel{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		list1 := tester.Insert(&listModel{}).(*listModel)
+		list2 := tester.Insert(&listModel{}).(*listModel)
+		list3 := tester.Insert(&listModel{ItemCount: 5}).(*listModel)
+
+		_, err = tester.Store.C(&itemModel{}).InsertMany(nil, []interface{}{
+			&itemModel{Base: coal.B(), List: list1.ID()},
+			&itemModel{Base: coal.B(), List: list1.ID()},
+			&itemModel{Base: coal.B(), List: list2.ID()},
+		})
+		assert.NoError(t, err)
+
+		done := make(chan struct{})
+
+		queue := NewQueue(Options{
+			Store:    tester.Store,
+			Reporter: xo.Panic,
+		})
+
+		task := RecountTask(tester.Store, coal.NewRegistry(&listModel{}, &itemModel{}), 1)
+		task.Notifier = func(ctx *Context, cancelled bool, reason string) error {
+			assert.False(t, cancelled)
+			close(done)
+			return nil
+		}
+		queue.Add(task)
+
+		<-queue.Run()
+
+		enqueued, err := queue.Enqueue(nil, &RecountJob{}, 0, 0)
+		assert.NoError(t, err)
+		assert.True(t, enqueued)
+
+		<-done
+
+		assert.Equal(t, 2, tester.Fetch(&listModel{}, list1.ID()).(*listModel).ItemCount)
+		assert.Equal(t, 1, tester.Fetch(&listModel{}, list2.ID()).(*listModel).ItemCount)
+		assert.Equal(t, 0, tester.Fetch(&listModel{}, list3.ID()).(*listModel).ItemCount)
+
+		queue.Close()
+	})
+}
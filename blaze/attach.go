@@ -46,7 +46,7 @@ func Attach(ctx context.Context, store *coal.Store, bucket *Bucket, model coal.M
 	stick.MustSet(model, field, link)
 
 	// run in transaction
-	err = store.T(ctx, false, func(ctx context.Context) error {
+	err = store.S(model).T(ctx, false, func(ctx context.Context) error {
 		// claim file
 		err = bucket.Claim(ctx, model, field)
 		if err != nil {
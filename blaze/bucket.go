@@ -1246,7 +1246,7 @@ func (b *Bucket) MigrateFile(ctx context.Context, id coal.ID) error {
 	}
 
 	// swap services and handles
-	err = b.store.T(ctx, false, func(ctx context.Context) error {
+	err = b.store.S(&File{}).T(ctx, false, func(ctx context.Context) error {
 		// update original file
 		found, err := b.store.M(&File{}).UpdateFirst(ctx, nil, bson.M{
 			"_id":     original.ID(),
@@ -69,6 +69,26 @@ func TimestampModifier(createdField, updatedField string) *Callback {
 	})
 }
 
+// SequenceModifier will assign the next number of the specified sequence to
+// the specified field on create operations:
+//
+//	fire.SequenceModifier(sequences, coal.Sequence{
+//		Name: "invoices",
+//		Scope: func(model coal.Model) string {
+//			return strconv.Itoa(time.Now().Year())
+//		},
+//		Format: "INV-%s-%04d",
+//	}, "Number")
+//
+// As the counter is incremented within the transaction of the operation, the
+// sequence remains free of gaps if the operation fails. The sequences must
+// therefore be stored in the same database as the model.
+func SequenceModifier(sequences *coal.Sequences, sequence coal.Sequence, field string) *Callback {
+	return C("fire/SequenceModifier", Modifier, Only(Create), func(ctx *Context) error {
+		return sequences.Assign(ctx, sequence, ctx.Model, field)
+	})
+}
+
 // NoDefault marks the specified field to have no default that needs to be
 // enforced while executing the ProtectedFieldsValidator.
 const NoDefault noDefault = iota
@@ -132,7 +152,8 @@ func ProtectedFieldsValidator(pairs map[string]interface{}) *Callback {
 //		&Comment{}: "Author",
 //	})
 //
-// The callback supports models that use the soft delete mechanism.
+// The callback supports models that use the soft delete mechanism and fields
+// that are polymorphic relationships.
 func DependentResourcesValidator(pairs map[coal.Model]string) *Callback {
 	return C("fire/DependentResourcesValidator", Validator, Only(Delete), func(ctx *Context) error {
 		// check all relations
@@ -142,6 +163,11 @@ func DependentResourcesValidator(pairs map[coal.Model]string) *Callback {
 				field: ctx.Model.ID(),
 			}
 
+			// use reference for polymorphic relationships
+			if f := coal.GetMeta(model).Fields[field]; f != nil && (f.PolyToOne || f.PolyToMany) {
+				query[field] = coal.R(ctx.Model)
+			}
+
 			// exclude soft deleted documents if supported
 			if sdf := coal.L(model, "fire-soft-delete", false); sdf != "" {
 				query[sdf] = nil
@@ -176,13 +202,52 @@ func DependentResourcesValidator(pairs map[coal.Model]string) *Callback {
 //	})
 //
 // The callbacks supports to-one, optional to-one and to-many relationships.
-func ReferencedResourcesValidator(pairs map[string]coal.Model) *Callback {
+//
+// Polymorphic relationships are supported by additionally passing the models
+// that may be referenced. Each reference is checked against the collection of
+// the model that matches its type. The model of the pair is ignored and may be
+// nil:
+//
+//	fire.ReferencedResourcesValidator(map[string]coal.Model{
+//		"Parent": nil,
+//	}, &Post{}, &Photo{}, &Video{})
+func ReferencedResourcesValidator(pairs map[string]coal.Model, models ...coal.Model) *Callback {
+	// build index
+	index := make(map[string]coal.Model, len(models))
+	for _, model := range models {
+		index[coal.GetMeta(model).PluralName] = model
+	}
+
 	return C("fire/ReferencedResourcesValidator", Validator, Only(Create|Update), func(ctx *Context) error {
 		// check all references
 		for field, collection := range pairs {
 			// read referenced id
 			ref := stick.MustGet(ctx.Model, field)
 
+			// handle polymorphic relationships
+			switch ref := ref.(type) {
+			case coal.Ref:
+				err := checkReferences(ctx, index, field, []coal.Ref{ref})
+				if err != nil {
+					return err
+				}
+				continue
+			case *coal.Ref:
+				if ref != nil {
+					err := checkReferences(ctx, index, field, []coal.Ref{*ref})
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			case []coal.Ref:
+				err := checkReferences(ctx, index, field, ref)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
 			// continue if reference is not set
 			if oid, ok := ref.(*coal.ID); ok && oid == nil {
 				continue
@@ -237,6 +302,48 @@ func ReferencedResourcesValidator(pairs map[string]coal.Model) *Callback {
 	})
 }
 
+func checkReferences(ctx *Context, index map[string]coal.Model, field string, refs []coal.Ref) error {
+	// get allowed types
+	var relTypes []string
+	if f := coal.GetMeta(ctx.Model).Fields[field]; f != nil {
+		relTypes = f.RelTypes
+	}
+
+	// group ids by type
+	ids := map[string][]coal.ID{}
+	for _, ref := range refs {
+		if !stick.Contains(ids[ref.Type], ref.ID) {
+			ids[ref.Type] = append(ids[ref.Type], ref.ID)
+		}
+	}
+
+	// check references of each type
+	for typ, list := range ids {
+		// get model
+		model := index[typ]
+		if model == nil || (len(relTypes) > 0 && !stick.Contains(relTypes, typ)) {
+			return xo.SF("invalid reference type for field " + field)
+		}
+
+		// count entities in database
+		count, err := ctx.Store.M(model).Count(ctx, bson.M{
+			"_id": bson.M{
+				"$in": list,
+			},
+		}, 0, 0, false)
+		if err != nil {
+			return err
+		}
+
+		// check for existence
+		if int(count) != len(list) {
+			return xo.SF("missing references for field " + field)
+		}
+	}
+
+	return nil
+}
+
 // RelationshipValidator makes sure all relationships of a model are correct and
 // in place. It does so by combining a DependentResourcesValidator and a
 // ReferencedResourcesValidator based on the specified model and catalog.
@@ -292,11 +399,24 @@ func RelationshipValidator(model coal.Model, models []coal.Model, exclude ...str
 			// add reference
 			references[field.Name] = relatedModel
 		}
+
+		// handle polymorphic relationships
+		if field.PolyToOne || field.PolyToMany {
+			// check related models
+			for _, relType := range field.RelTypes {
+				if index[relType] == nil {
+					panic(fmt.Sprintf(`fire: missing model in catalog: "%s"`, relType))
+				}
+			}
+
+			// add reference
+			references[field.Name] = nil
+		}
 	}
 
 	// create callbacks
 	drv := DependentResourcesValidator(resources)
-	rrv := ReferencedResourcesValidator(references)
+	rrv := ReferencedResourcesValidator(references, models...)
 
 	// combine callbacks
 	cb := Combine("fire/RelationshipValidator", Validator, drv, rrv)
@@ -381,3 +501,55 @@ func MatchingReferencesValidator(reference string, target coal.Model, matcher ma
 		return nil
 	})
 }
+
+// TreeValidator makes sure the parent of a model with a registered tree exists
+// and that the model does not become its own ancestor.
+//
+//	coal.AddTree(&Folder{}, "Parent", "Ancestors", "Depth")
+//
+//	fire.TreeValidator()
+//
+// The ancestors and depth of the model are maintained by the coal.Manager.
+func TreeValidator() *Callback {
+	return C("fire/TreeValidator", Validator, Only(Create|Update), func(ctx *Context) error {
+		// get tree
+		tree := coal.GetMeta(ctx.Model).Tree
+		if tree == nil {
+			return xo.F("model has no tree")
+		}
+
+		// get parent
+		parent := stick.MustGet(ctx.Model, tree.Parent).(*coal.ID)
+		if parent == nil {
+			return nil
+		}
+
+		// check self reference
+		if *parent == ctx.Model.ID() {
+			return xo.SF("invalid parent")
+		}
+
+		// check parent
+		count, err := ctx.Store.M(ctx.Model).Count(ctx, bson.M{
+			"_id": *parent,
+		}, 0, 1, false)
+		if err != nil {
+			return err
+		} else if count == 0 {
+			return xo.SF("missing parent")
+		}
+
+		// check cycle
+		count, err = ctx.Store.M(ctx.Model).Count(ctx, bson.M{
+			"_id":          *parent,
+			tree.Ancestors: ctx.Model.ID(),
+		}, 0, 1, false)
+		if err != nil {
+			return err
+		} else if count != 0 {
+			return xo.SF("invalid parent")
+		}
+
+		return nil
+	})
+}
@@ -2,10 +2,16 @@ package fire
 
 import (
 	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/256dpi/xo"
 	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/256dpi/fire/coal"
 	"github.com/256dpi/fire/stick"
@@ -72,6 +78,73 @@ func TestTimestampModifier(t *testing.T) {
 	})
 }
 
+func TestSequenceModifier(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		type model struct {
+			coal.Base          `json:"-" bson:",inline" coal:"invoices"`
+			Number             string `json:"number"`
+			Fail               bool   `json:"fail"`
+			stick.NoValidation `json:"-" bson:"-"`
+		}
+
+		tester = NewTester(tester.Store, &model{})
+		tester.Clean()
+		_, _ = tester.Store.DB().Collection("sequences").DeleteMany(nil, bson.M{})
+
+		sequences := coal.NewSequences(tester.Store, "sequences")
+
+		tester.Assign("", &Controller{
+			Model: &model{},
+			Modifiers: L{
+				SequenceModifier(sequences, coal.Sequence{
+					Name: "invoices",
+					Scope: func(coal.Model) string {
+						return "2026"
+					},
+					Format: "INV-%s-%04d",
+				}, "Number"),
+			},
+			Validators: L{
+				C("fail", Validator, Only(Create), func(ctx *Context) error {
+					if ctx.Model.(*model).Fail {
+						return xo.SF("failed")
+					}
+					return nil
+				}),
+			},
+		})
+
+		create := func(fail bool) string {
+			var number string
+			tester.Request("POST", "invoices", `{
+				"data": {
+					"type": "invoices",
+					"attributes": {
+						"number": "INV-0",
+						"fail": `+fmt.Sprint(fail)+`
+					}
+				}
+			}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+				if fail {
+					assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+				} else {
+					assert.Equal(t, http.StatusCreated, r.Result().StatusCode, tester.DebugRequest(rq, r))
+				}
+				number = gjson.Get(r.Body.String(), "data.attributes.number").String()
+			})
+			return number
+		}
+
+		assert.Equal(t, "INV-2026-0001", create(false))
+		assert.Equal(t, "", create(true))
+		assert.Equal(t, "INV-2026-0002", create(false))
+
+		n, err := sequences.Current(nil, "invoices", "2026")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+	})
+}
+
 func TestProtectedAttributesValidatorOnCreate(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		validator := ProtectedFieldsValidator(map[string]interface{}{
@@ -0,0 +1,522 @@
+package coal
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// BackupFormat defines the format of the model files in a backup archive.
+type BackupFormat string
+
+// The available backup formats.
+const (
+	// BSONFormat stores documents as concatenated BSON documents.
+	BSONFormat BackupFormat = "bson"
+
+	// JSONFormat stores documents as canonical extended JSON, one document
+	// per line.
+	JSONFormat BackupFormat = "json"
+)
+
+// BackupManifest describes the contents of a backup archive.
+type BackupManifest struct {
+	// The archive version.
+	Version int `json:"version"`
+
+	// The format of the model files.
+	Format BackupFormat `json:"format"`
+
+	// The time the backup was created.
+	Created time.Time `json:"created"`
+
+	// The backed up models.
+	Models []BackupModel `json:"models"`
+}
+
+// BackupModel describes a single backed up model.
+type BackupModel struct {
+	// The plural name of the model.
+	Name string `json:"name"`
+
+	// The collection of the model.
+	Collection string `json:"collection"`
+
+	// The file in the archive.
+	File string `json:"file"`
+
+	// The number of documents.
+	Count int64 `json:"count"`
+}
+
+// BackupOptions defines options for Backup.
+type BackupOptions struct {
+	// The format of the model files. Defaults to BSONFormat.
+	Format BackupFormat
+
+	// The plural names of the models to back up. Defaults to all models in
+	// the registry.
+	Models []string
+
+	// Optional filters for individual models keyed by plural name.
+	Filters map[string]bson.M
+}
+
+// RestoreOptions defines options for Restore.
+type RestoreOptions struct {
+	// The plural names of the models to restore. Defaults to all models in
+	// the archive.
+	Models []string
+
+	// Whether documents should receive new ids. References and tree ancestors
+	// between restored models are rewritten accordingly.
+	RemapIDs bool
+
+	// Whether the registered indexes should be ensured after restoring.
+	EnsureIndexes bool
+}
+
+const backupManifest = "manifest.json"
+const backupBatchSize = 1000
+
+// Backup will stream the documents of the models in the registry into a zip
+// archive written to the provided writer. Documents are exported as stored,
+// encrypted fields therefore remain encrypted.
+func Backup(ctx context.Context, store *Store, registry *Registry, w io.Writer, opts BackupOptions) (*BackupManifest, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Backup")
+	defer span.End()
+
+	// set default format
+	if opts.Format == "" {
+		opts.Format = BSONFormat
+	}
+
+	// check format
+	if opts.Format != BSONFormat && opts.Format != JSONFormat {
+		return nil, xo.F("invalid format %q", opts.Format)
+	}
+
+	// get models
+	models, err := backupModels(registry, opts.Models)
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare manifest
+	manifest := &BackupManifest{
+		Version: 1,
+		Format:  opts.Format,
+		Created: time.Now().UTC(),
+	}
+
+	// create archive
+	archive := zip.NewWriter(w)
+
+	// export models
+	for _, model := range models {
+		// get meta
+		meta := GetMeta(model)
+
+		// prepare file
+		file := meta.PluralName + ".bson"
+		if opts.Format == JSONFormat {
+			file = meta.PluralName + ".ndjson"
+		}
+
+		// export model
+		count, err := backupModel(ctx, store, model, archive, file, opts.Format, opts.Filters[meta.PluralName])
+		if err != nil {
+			return nil, err
+		}
+
+		// add model
+		manifest.Models = append(manifest.Models, BackupModel{
+			Name:       meta.PluralName,
+			Collection: meta.Collection,
+			File:       file,
+			Count:      count,
+		})
+	}
+
+	// write manifest
+	writer, err := archive.Create(backupManifest)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+	err = json.NewEncoder(writer).Encode(manifest)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	// close archive
+	err = archive.Close()
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	return manifest, nil
+}
+
+// ReadBackupManifest will read the manifest of the provided backup archive.
+func ReadBackupManifest(r io.ReaderAt, size int64) (*BackupManifest, error) {
+	// open archive
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	return readBackupManifest(archive)
+}
+
+// Restore will restore the documents of the provided backup archive using the
+// models in the registry. If requested, the documents receive new ids and the
+// id mapping is returned.
+func Restore(ctx context.Context, store *Store, registry *Registry, r io.ReaderAt, size int64, opts RestoreOptions) (map[ID]ID, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Restore")
+	defer span.End()
+
+	// open archive
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	// read manifest
+	manifest, err := readBackupManifest(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	// select entries
+	var entries []BackupModel
+	for _, entry := range manifest.Models {
+		if len(opts.Models) == 0 || stick.Contains(opts.Models, entry.Name) {
+			entries = append(entries, entry)
+		}
+	}
+
+	// check models
+	for _, entry := range entries {
+		if registry.Lookup(entry.Name) == nil {
+			return nil, xo.F("unknown model %q", entry.Name)
+		}
+	}
+	for _, name := range opts.Models {
+		found := false
+		for _, entry := range entries {
+			if entry.Name == name {
+				found = true
+			}
+		}
+		if !found {
+			return nil, xo.F("missing model %q", name)
+		}
+	}
+
+	// prepare mapping
+	var mapping map[ID]ID
+	if opts.RemapIDs {
+		mapping = map[ID]ID{}
+		for _, entry := range entries {
+			err = readBackupModel(archive, entry.File, manifest.Format, func(doc bson.D) error {
+				for _, elem := range doc {
+					if id, ok := elem.Value.(ID); ok && elem.Key == "_id" {
+						mapping[id] = New()
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// restore models
+	for _, entry := range entries {
+		// get model and meta
+		model := registry.Lookup(entry.Name)
+		meta := GetMeta(model)
+
+		// prepare batch
+		var batch []interface{}
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			_, err := store.C(model).InsertMany(ctx, batch)
+			batch = nil
+			return err
+		}
+
+		// insert documents
+		err = readBackupModel(archive, entry.File, manifest.Format, func(doc bson.D) error {
+			// remap ids
+			if mapping != nil {
+				remapDocument(meta, doc, mapping)
+			}
+
+			// add document
+			batch = append(batch, doc)
+			if len(batch) >= backupBatchSize {
+				return flush()
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// flush remaining documents
+		err = flush()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// ensure indexes
+	if opts.EnsureIndexes {
+		var models []Model
+		for _, entry := range entries {
+			models = append(models, registry.Lookup(entry.Name))
+		}
+		err = EnsureIndexes(store, models...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mapping, nil
+}
+
+func backupModels(registry *Registry, names []string) ([]Model, error) {
+	// use all models
+	if len(names) == 0 {
+		return registry.All(), nil
+	}
+
+	// lookup models
+	models := make([]Model, 0, len(names))
+	for _, name := range names {
+		model := registry.Lookup(name)
+		if model == nil {
+			return nil, xo.F("unknown model %q", name)
+		}
+		models = append(models, model)
+	}
+
+	return models, nil
+}
+
+func backupModel(ctx context.Context, store *Store, model Model, archive *zip.Writer, file string, format BackupFormat, filter bson.M) (int64, error) {
+	// translate filter
+	query := bson.D{}
+	if filter != nil {
+		var err error
+		query, err = NewTranslator(model).Document(filter)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// create file
+	writer, err := archive.Create(file)
+	if err != nil {
+		return 0, xo.W(err)
+	}
+
+	// find documents
+	iter, err := store.C(model).Find(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	// ensure close
+	defer iter.Close()
+
+	// write documents
+	var count int64
+	for iter.Next() {
+		// decode document
+		var doc bson.Raw
+		err = iter.Decode(&doc)
+		if err != nil {
+			return 0, err
+		}
+
+		// encode document
+		data := []byte(doc)
+		if format == JSONFormat {
+			data, err = bson.MarshalExtJSON(doc, true, false)
+			if err != nil {
+				return 0, xo.W(err)
+			}
+			data = append(data, '\n')
+		}
+
+		// write document
+		_, err = writer.Write(data)
+		if err != nil {
+			return 0, xo.W(err)
+		}
+
+		count++
+	}
+
+	// check error
+	err = iter.Error()
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func readBackupManifest(archive *zip.Reader) (*BackupManifest, error) {
+	// open manifest
+	file, err := archive.Open(backupManifest)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	// ensure close
+	defer file.Close()
+
+	// decode manifest
+	var manifest BackupManifest
+	err = json.NewDecoder(file).Decode(&manifest)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	// check version
+	if manifest.Version != 1 {
+		return nil, xo.F("unsupported backup version %d", manifest.Version)
+	}
+
+	return &manifest, nil
+}
+
+func readBackupModel(archive *zip.Reader, name string, format BackupFormat, fn func(bson.D) error) error {
+	// open file
+	file, err := archive.Open(name)
+	if err != nil {
+		return xo.W(err)
+	}
+
+	// ensure close
+	defer file.Close()
+
+	// read JSON documents
+	if format == JSONFormat {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 32<<20)
+		for scanner.Scan() {
+			var doc bson.D
+			err = bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc)
+			if err != nil {
+				return xo.W(err)
+			}
+			err = fn(doc)
+			if err != nil {
+				return err
+			}
+		}
+
+		return xo.W(scanner.Err())
+	}
+
+	// read BSON documents
+	reader := bufio.NewReader(file)
+	for {
+		raw, err := bson.NewFromIOReader(reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return xo.W(err)
+		}
+		var doc bson.D
+		err = bson.Unmarshal(raw, &doc)
+		if err != nil {
+			return xo.W(err)
+		}
+		err = fn(doc)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func remapDocument(meta *Meta, doc bson.D, mapping map[ID]ID) {
+	// prepare remap
+	remap := func(value interface{}) interface{} {
+		if id, ok := value.(ID); ok {
+			if newID, ok := mapping[id]; ok {
+				return newID
+			}
+		}
+		return value
+	}
+
+	// prepare reference remap
+	remapRef := func(value interface{}) {
+		if ref, ok := value.(bson.D); ok {
+			for i, elem := range ref {
+				if elem.Key == "id" {
+					ref[i].Value = remap(elem.Value)
+				}
+			}
+		}
+	}
+
+	// remap id and references
+	for i, elem := range doc {
+		// remap id
+		if elem.Key == "_id" {
+			doc[i].Value = remap(elem.Value)
+			continue
+		}
+
+		// check field
+		field := meta.DatabaseFields[elem.Key]
+		if field == nil {
+			continue
+		}
+
+		// remap references
+		if field.ToOne {
+			doc[i].Value = remap(elem.Value)
+		} else if field.ToMany {
+			if list, ok := elem.Value.(bson.A); ok {
+				for j, value := range list {
+					list[j] = remap(value)
+				}
+			}
+		} else if field.PolyToOne {
+			remapRef(elem.Value)
+		} else if field.PolyToMany {
+			if list, ok := elem.Value.(bson.A); ok {
+				for _, value := range list {
+					remapRef(value)
+				}
+			}
+		} else if meta.Tree != nil && field.Name == meta.Tree.Ancestors {
+			if list, ok := elem.Value.(bson.A); ok {
+				for j, value := range list {
+					list[j] = remap(value)
+				}
+			}
+		}
+	}
+}
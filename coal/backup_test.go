@@ -0,0 +1,155 @@
+package coal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+func TestBackupRestore(t *testing.T) {
+	for _, format := range []BackupFormat{BSONFormat, JSONFormat} {
+		t.Run(string(format), func(t *testing.T) {
+			withTester(t, func(t *testing.T, tester *Tester) {
+				registry := NewRegistry(&postModel{}, &commentModel{}, &selectionModel{})
+
+				post1 := tester.Insert(&postModel{Title: "Hello", Published: true}).(*postModel)
+				post2 := tester.Insert(&postModel{Title: "World"}).(*postModel)
+				comment1 := tester.Insert(&commentModel{Message: "Foo", Post: post1.ID()}).(*commentModel)
+				comment2 := tester.Insert(&commentModel{Message: "Bar", Post: post1.ID(), Parent: &comment1.DocID}).(*commentModel)
+				selection := tester.Insert(&selectionModel{Name: "All", Posts: []ID{post1.ID(), post2.ID()}}).(*selectionModel)
+
+				var buf bytes.Buffer
+				manifest, err := Backup(nil, tester.Store, registry, &buf, BackupOptions{
+					Format: format,
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, 1, manifest.Version)
+				assert.Equal(t, format, manifest.Format)
+				assert.Len(t, manifest.Models, 3)
+				assert.Equal(t, "posts", manifest.Models[0].Name)
+				assert.Equal(t, int64(2), manifest.Models[0].Count)
+				assert.Equal(t, int64(2), manifest.Models[1].Count)
+				assert.Equal(t, int64(1), manifest.Models[2].Count)
+
+				read, err := ReadBackupManifest(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+				assert.NoError(t, err)
+				assert.Equal(t, manifest.Models, read.Models)
+
+				/* plain restore */
+
+				tester.Clean()
+
+				mapping, err := Restore(nil, tester.Store, registry, bytes.NewReader(buf.Bytes()), int64(buf.Len()), RestoreOptions{
+					EnsureIndexes: true,
+				})
+				assert.NoError(t, err)
+				assert.Nil(t, mapping)
+				assert.Equal(t, post1, tester.Fetch(&postModel{}, post1.ID()))
+				assert.Equal(t, post2, tester.Fetch(&postModel{}, post2.ID()))
+				assert.Equal(t, comment1, tester.Fetch(&commentModel{}, comment1.ID()))
+				assert.Equal(t, comment2, tester.Fetch(&commentModel{}, comment2.ID()))
+				assert.Equal(t, selection, tester.Fetch(&selectionModel{}, selection.ID()))
+
+				/* remapped restore */
+
+				mapping, err = Restore(nil, tester.Store, registry, bytes.NewReader(buf.Bytes()), int64(buf.Len()), RestoreOptions{
+					RemapIDs: true,
+				})
+				assert.NoError(t, err)
+				assert.Len(t, mapping, 5)
+				assert.Equal(t, 4, tester.Count(&postModel{}))
+				assert.Equal(t, 4, tester.Count(&commentModel{}))
+
+				newComment2 := tester.Fetch(&commentModel{}, mapping[comment2.ID()]).(*commentModel)
+				assert.Equal(t, "Bar", newComment2.Message)
+				assert.Equal(t, mapping[post1.ID()], newComment2.Post)
+				assert.Equal(t, mapping[comment1.ID()], *newComment2.Parent)
+
+				newSelection := tester.Fetch(&selectionModel{}, mapping[selection.ID()]).(*selectionModel)
+				assert.Equal(t, []ID{mapping[post1.ID()], mapping[post2.ID()]}, newSelection.Posts)
+			})
+		})
+	}
+}
+
+func TestBackupRestoreTree(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		registry := NewRegistry(&folderModel{})
+
+		root := tester.Insert(&folderModel{Name: "Root"}).(*folderModel)
+		child := tester.Insert(&folderModel{Name: "Child", Parent: stick.P(root.ID())}).(*folderModel)
+		leaf := tester.Insert(&folderModel{Name: "Leaf", Parent: stick.P(child.ID())}).(*folderModel)
+		assert.Equal(t, []ID{root.ID(), child.ID()}, leaf.Ancestors)
+
+		var buf bytes.Buffer
+		_, err := Backup(nil, tester.Store, registry, &buf, BackupOptions{})
+		assert.NoError(t, err)
+
+		mapping, err := Restore(nil, tester.Store, registry, bytes.NewReader(buf.Bytes()), int64(buf.Len()), RestoreOptions{
+			RemapIDs: true,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, mapping, 3)
+
+		newLeaf := tester.Fetch(&folderModel{}, mapping[leaf.ID()]).(*folderModel)
+		assert.Equal(t, mapping[child.ID()], *newLeaf.Parent)
+		assert.Equal(t, []ID{mapping[root.ID()], mapping[child.ID()]}, newLeaf.Ancestors)
+		assert.Equal(t, 2, newLeaf.Depth)
+
+		var list []*folderModel
+		found, err := tester.Store.M(&folderModel{}).Descendants(nil, &list, mapping[root.ID()], 0, NoTransaction)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Len(t, list, 2)
+	})
+}
+
+func TestBackupRestoreSubset(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		registry := NewRegistry(&postModel{}, &commentModel{})
+
+		post1 := tester.Insert(&postModel{Title: "Hello", Published: true}).(*postModel)
+		tester.Insert(&postModel{Title: "World"})
+		tester.Insert(&commentModel{Message: "Foo", Post: post1.ID()})
+
+		var buf bytes.Buffer
+		manifest, err := Backup(nil, tester.Store, registry, &buf, BackupOptions{
+			Models: []string{"posts"},
+			Filters: map[string]bson.M{
+				"posts": {"Published": true},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, manifest.Models, 1)
+		assert.Equal(t, int64(1), manifest.Models[0].Count)
+
+		tester.Clean()
+
+		_, err = Restore(nil, tester.Store, registry, bytes.NewReader(buf.Bytes()), int64(buf.Len()), RestoreOptions{
+			Models: []string{"comments"},
+		})
+		assert.Error(t, err)
+		assert.Equal(t, `missing model "comments"`, err.Error())
+
+		_, err = Restore(nil, tester.Store, NewRegistry(&commentModel{}), bytes.NewReader(buf.Bytes()), int64(buf.Len()), RestoreOptions{})
+		assert.Error(t, err)
+		assert.Equal(t, `unknown model "posts"`, err.Error())
+
+		_, err = Restore(nil, tester.Store, registry, bytes.NewReader(buf.Bytes()), int64(buf.Len()), RestoreOptions{
+			Models: []string{"posts"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, tester.Count(&postModel{}))
+		assert.Equal(t, post1, tester.Fetch(&postModel{}, post1.ID()))
+
+		_, err = Backup(nil, tester.Store, registry, &buf, BackupOptions{
+			Models: []string{"foos"},
+		})
+		assert.Error(t, err)
+		assert.Equal(t, `unknown model "foos"`, err.Error())
+	})
+}
@@ -0,0 +1,395 @@
+package coal
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// CacheOptions defines options for NewCache.
+type CacheOptions struct {
+	// The maximum number of cached documents.
+	//
+	// Default: 1000.
+	Size int
+
+	// The duration after which cached documents expire. If zero, documents
+	// are kept until they are evicted or invalidated.
+	TTL time.Duration
+
+	// The unique struct fields that may be used with FindBy.
+	Keys []string
+}
+
+// CacheStats contains cache statistics.
+type CacheStats struct {
+	// The number of lookups served from the cache.
+	Hits int64
+
+	// The number of lookups served from the database.
+	Misses int64
+
+	// The number of lookups that bypassed the cache.
+	Bypasses int64
+
+	// The number of documents evicted due to the size limit or expiry.
+	Evictions int64
+
+	// The number of documents invalidated.
+	Invalidations int64
+}
+
+// Cache is a read-through cache for lookups of documents by ID or unique key.
+// Lookups within a transaction or that lock the document bypass the cache.
+// The cache must be kept in sync by forwarding stream events to Receive or by
+// using Watch.
+type Cache struct {
+	store   *Store
+	meta    *Meta
+	opts    CacheOptions
+	entries map[ID]*list.Element
+	keys    map[string]map[interface{}]ID
+	lru     *list.List
+	epoch   int64
+	stats   CacheStats
+	mutex   sync.Mutex
+}
+
+type cacheEntry struct {
+	id      ID
+	doc     bson.Raw
+	keys    map[string]interface{}
+	expires time.Time
+}
+
+// NewCache will create and return a new cache for the specified model.
+func NewCache(store *Store, model Model, opts CacheOptions) *Cache {
+	// get meta
+	meta := GetMeta(model)
+
+	// set default size
+	if opts.Size <= 0 {
+		opts.Size = 1000
+	}
+
+	// check keys
+	keys := map[string]map[interface{}]ID{}
+	for _, key := range opts.Keys {
+		if field := meta.Fields[key]; field == nil || field.BSONKey == "" {
+			panic(fmt.Sprintf(`coal: unknown or virtual field "%s"`, key))
+		}
+		keys[key] = map[interface{}]ID{}
+	}
+
+	return &Cache{
+		store:   store,
+		meta:    meta,
+		opts:    opts,
+		entries: map[ID]*list.Element{},
+		keys:    keys,
+		lru:     list.New(),
+	}
+}
+
+// Find will look up the document with the specified id and decode it into the
+// provided model. Documents that are not cached are loaded from the database
+// and added to the cache.
+func (c *Cache) Find(ctx context.Context, model Model, id ID, lock bool, flags ...Flags) (bool, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Cache.Find")
+	span.Tag("id", id.Hex())
+	defer span.End()
+
+	// check bypass
+	if lock || HasTransaction(ctx) {
+		c.count(&c.stats.Bypasses)
+		return c.store.M(model).Find(ctx, model, id, lock, flags...)
+	}
+
+	// get document
+	doc, epoch := c.get(id)
+	if doc == nil {
+		// find document
+		err := c.store.C(model).FindOne(ctx, bson.M{
+			"_id": id,
+		}).Decode(&doc)
+		if IsMissing(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	return c.load(model, doc, epoch, flags)
+}
+
+// FindBy will look up the document with the specified unique key value and
+// decode it into the provided model. The field must be one of the configured
+// keys and the value must be comparable. Lookups within a transaction bypass
+// the cache.
+func (c *Cache) FindBy(ctx context.Context, model Model, field string, value interface{}, flags ...Flags) (bool, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Cache.FindBy")
+	span.Tag("field", field)
+	defer span.End()
+
+	// check field
+	if c.keys[field] == nil {
+		return false, xo.F("unknown cache key %q", field)
+	}
+
+	// check bypass
+	if HasTransaction(ctx) {
+		c.count(&c.stats.Bypasses)
+		return c.store.M(model).FindFirst(ctx, model, bson.M{
+			field: value,
+		}, nil, 0, false, flags...)
+	}
+
+	// get document
+	var doc bson.Raw
+	var epoch int64
+	c.mutex.Lock()
+	id, ok := c.keys[field][value]
+	c.mutex.Unlock()
+	if ok {
+		doc, epoch = c.get(id)
+	} else {
+		c.mutex.Lock()
+		c.stats.Misses++
+		epoch = c.epoch
+		c.mutex.Unlock()
+	}
+
+	// find document if missing
+	if doc == nil {
+		// translate and encrypt filter
+		filter, err := c.store.M(model).translateFilter(bson.M{
+			field: value,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		// find document
+		err = c.store.C(model).FindOne(ctx, filter).Decode(&doc)
+		if IsMissing(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	return c.load(model, doc, epoch, flags)
+}
+
+// Invalidate will remove the specified documents from the cache.
+func (c *Cache) Invalidate(ids ...ID) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// increment epoch
+	c.epoch++
+
+	// remove entries
+	for _, id := range ids {
+		if elem := c.entries[id]; elem != nil {
+			c.remove(elem)
+			c.stats.Invalidations++
+		}
+	}
+}
+
+// Purge will remove all documents from the cache.
+func (c *Cache) Purge() {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// increment epoch
+	c.epoch++
+
+	// count entries
+	c.stats.Invalidations += int64(c.lru.Len())
+
+	// reset entries
+	c.entries = map[ID]*list.Element{}
+	for key := range c.keys {
+		c.keys[key] = map[interface{}]ID{}
+	}
+	c.lru.Init()
+}
+
+// Stats will return the cache statistics.
+func (c *Cache) Stats() CacheStats {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.stats
+}
+
+// Receive is a Receiver that invalidates documents that have been updated or
+// deleted. The cache is purged whenever the stream has been opened, resumed or
+// errored as events may have been missed.
+func (c *Cache) Receive(event Event, id ID, _ Model, _ error, _ []byte) error {
+	// handle event
+	switch event {
+	case Opened, Resumed, Errored:
+		c.Purge()
+	case Updated, Deleted:
+		c.Invalidate(id)
+	}
+
+	return nil
+}
+
+// Watch will open a stream that keeps the cache in sync.
+func (c *Cache) Watch() *Stream {
+	return OpenStream(c.store, c.meta.Make(), nil, c.Receive)
+}
+
+func (c *Cache) get(id ID) (bson.Raw, int64) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// get entry
+	elem := c.entries[id]
+	if elem != nil && c.opts.TTL > 0 && time.Now().After(elem.Value.(*cacheEntry).expires) {
+		c.remove(elem)
+		c.stats.Evictions++
+		elem = nil
+	}
+
+	// handle miss
+	if elem == nil {
+		c.stats.Misses++
+		return nil, c.epoch
+	}
+
+	// handle hit
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+
+	return elem.Value.(*cacheEntry).doc, -1
+}
+
+func (c *Cache) load(model Model, doc bson.Raw, epoch int64, flags []Flags) (bool, error) {
+	// get manager
+	manager := c.store.M(model)
+
+	// decode document
+	err := bson.Unmarshal(doc, model)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	// decrypt model
+	err = manager.decryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
+	// add entry if loaded from the database
+	if epoch >= 0 {
+		c.add(model, doc, epoch)
+	}
+
+	// run hook
+	err = afterLoad(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
+	// validate model
+	if !Merge(flags).Has(NoValidation) {
+		err = model.Validate()
+		if err != nil {
+			return false, xo.W(err)
+		}
+	}
+
+	return true, nil
+}
+
+func (c *Cache) add(model Model, doc bson.Raw, epoch int64) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// skip if invalidated in the meantime
+	if epoch != c.epoch {
+		return
+	}
+
+	// remove existing entry
+	if elem := c.entries[model.ID()]; elem != nil {
+		c.remove(elem)
+	}
+
+	// prepare entry
+	entry := &cacheEntry{
+		id:   model.ID(),
+		doc:  doc,
+		keys: map[string]interface{}{},
+	}
+	if c.opts.TTL > 0 {
+		entry.expires = time.Now().Add(c.opts.TTL)
+	}
+
+	// add entry
+	c.entries[entry.id] = c.lru.PushFront(entry)
+	for key, index := range c.keys {
+		// get value (dereference pointers)
+		value := stick.MustGet(model, key)
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				continue
+			}
+			value = rv.Elem().Interface()
+		}
+
+		// index value
+		entry.keys[key] = value
+		index[value] = entry.id
+	}
+
+	// evict entries
+	for c.lru.Len() > c.opts.Size {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	// get entry
+	entry := elem.Value.(*cacheEntry)
+
+	// remove entry
+	c.lru.Remove(elem)
+	delete(c.entries, entry.id)
+	for key, value := range entry.keys {
+		if c.keys[key][value] == entry.id {
+			delete(c.keys[key], value)
+		}
+	}
+}
+
+func (c *Cache) count(counter *int64) {
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// increment
+	*counter++
+}
@@ -0,0 +1,171 @@
+package coal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+func TestCache(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		cache := NewCache(tester.Store, &postModel{}, CacheOptions{
+			Keys: []string{"Title"},
+		})
+
+		post := tester.Insert(&postModel{Title: "foo"}).(*postModel)
+
+		var res postModel
+		found, err := cache.Find(nil, &res, post.ID(), false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "foo", res.Title)
+		assert.Equal(t, CacheStats{Misses: 1}, cache.Stats())
+
+		tester.Update(post, bson.M{"$set": bson.M{"Title": "bar"}})
+
+		res = postModel{}
+		found, err = cache.Find(nil, &res, post.ID(), false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "foo", res.Title)
+		assert.Equal(t, CacheStats{Hits: 1, Misses: 1}, cache.Stats())
+
+		res = postModel{}
+		found, err = cache.FindBy(nil, &res, "Title", "foo")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "foo", res.Title)
+		assert.Equal(t, CacheStats{Hits: 2, Misses: 1}, cache.Stats())
+
+		cache.Invalidate(post.ID())
+
+		res = postModel{}
+		found, err = cache.FindBy(nil, &res, "Title", "bar")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "bar", res.Title)
+		assert.Equal(t, CacheStats{Hits: 2, Misses: 2, Invalidations: 1}, cache.Stats())
+
+		found, err = cache.FindBy(nil, &res, "Title", "foo")
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		found, err = cache.Find(nil, &res, New(), false)
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		_, err = cache.FindBy(nil, &res, "TextBody", "foo")
+		assert.Error(t, err)
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			found, err := cache.Find(ctx, &res, post.ID(), false)
+			assert.NoError(t, err)
+			assert.True(t, found)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), cache.Stats().Bypasses)
+
+		assert.PanicsWithValue(t, `coal: unknown or virtual field "Comments"`, func() {
+			NewCache(tester.Store, &postModel{}, CacheOptions{
+				Keys: []string{"Comments"},
+			})
+		})
+	})
+}
+
+func TestCacheEncryption(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester.Store.SetKeyring(NewKeyring("k1", map[string][]byte{
+			"k1": testKey1,
+		}))
+		defer tester.Store.SetKeyring(nil)
+
+		cache := NewCache(tester.Store, &secretModel{}, CacheOptions{
+			Keys: []string{"Email"},
+		})
+
+		tester.Insert(&secretModel{
+			Token: "secret",
+			Email: stick.P("foo@example.com"),
+		})
+
+		var res secretModel
+		found, err := cache.FindBy(nil, &res, "Email", "foo@example.com")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "secret", res.Token)
+		assert.Equal(t, CacheStats{Misses: 1}, cache.Stats())
+
+		res = secretModel{}
+		found, err = cache.FindBy(nil, &res, "Email", "foo@example.com")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "secret", res.Token)
+		assert.Equal(t, CacheStats{Hits: 1, Misses: 1}, cache.Stats())
+	})
+}
+
+func TestCacheLimits(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		cache := NewCache(tester.Store, &postModel{}, CacheOptions{
+			Size: 1,
+			TTL:  50 * time.Millisecond,
+		})
+
+		post1 := tester.Insert(&postModel{Title: "foo"}).(*postModel)
+		post2 := tester.Insert(&postModel{Title: "bar"}).(*postModel)
+
+		var res postModel
+		_, err := cache.Find(nil, &res, post1.ID(), false)
+		assert.NoError(t, err)
+		_, err = cache.Find(nil, &res, post2.ID(), false)
+		assert.NoError(t, err)
+		assert.Equal(t, CacheStats{Misses: 2, Evictions: 1}, cache.Stats())
+
+		_, err = cache.Find(nil, &res, post2.ID(), false)
+		assert.NoError(t, err)
+		assert.Equal(t, CacheStats{Hits: 1, Misses: 2, Evictions: 1}, cache.Stats())
+
+		time.Sleep(60 * time.Millisecond)
+
+		_, err = cache.Find(nil, &res, post2.ID(), false)
+		assert.NoError(t, err)
+		assert.Equal(t, CacheStats{Hits: 1, Misses: 3, Evictions: 2}, cache.Stats())
+	})
+}
+
+func TestCacheWatch(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(10 * time.Millisecond)
+
+		cache := NewCache(tester.Store, &postModel{}, CacheOptions{})
+
+		post := tester.Insert(&postModel{Title: "foo"}).(*postModel)
+
+		stream := cache.Watch()
+		defer stream.Close()
+
+		time.Sleep(100 * time.Millisecond)
+
+		var res postModel
+		_, err := cache.Find(nil, &res, post.ID(), false)
+		assert.NoError(t, err)
+		assert.Equal(t, "foo", res.Title)
+
+		tester.Update(post, bson.M{"$set": bson.M{"Title": "bar"}})
+
+		assert.Eventually(t, func() bool {
+			return cache.Stats().Invalidations == 1
+		}, time.Second, 10*time.Millisecond)
+
+		_, err = cache.Find(nil, &res, post.ID(), false)
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", res.Title)
+	})
+}
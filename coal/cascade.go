@@ -0,0 +1,272 @@
+package coal
+
+import (
+	"context"
+	"time"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// ErrDeleteRestricted is returned if the deletion of a document is restricted
+// by a referencing document.
+var ErrDeleteRestricted = xo.BF("delete restricted by dependent documents")
+
+// DeleteCascade will remove the document with the specified id and apply the
+// on-delete behaviours of all relationships that reference the document using
+// Cascade. If the model has a field with the provided soft delete flag, the
+// document is soft deleted instead. It will return whether a document has been
+// found and deleted.
+//
+// A transaction is required to ensure atomicity.
+func (m *Manager) DeleteCascade(ctx context.Context, model Model, id ID, registry *Registry, softDeleteFlag string) (bool, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Manager.DeleteCascade")
+	defer span.End()
+
+	// require transaction
+	if !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
+	// get soft delete field
+	var softDeleteField string
+	if softDeleteFlag != "" {
+		softDeleteField = L(m.meta.Make(), softDeleteFlag, false)
+	}
+
+	// soft delete or delete document
+	var found bool
+	var err error
+	if softDeleteField != "" {
+		found, err = m.UpdateFirst(ctx, model, bson.M{
+			"_id":           id,
+			softDeleteField: nil,
+		}, bson.M{
+			"$set": bson.M{
+				softDeleteField: time.Now(),
+			},
+		}, nil, false)
+	} else {
+		found, err = m.Delete(ctx, model, id)
+	}
+	if err != nil || !found {
+		return false, err
+	}
+
+	// cascade delete
+	err = m.Cascade(ctx, id, registry, softDeleteFlag)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Cascade will apply the on-delete behaviours of all (polymorphic) to-one and
+// to-many relationships of the models in the registry that reference the
+// deleted document with the specified id. Referencing documents are deleted
+// (cascade), have their reference unset or pulled (nullify) or cause the
+// operation to fail with ErrDeleteRestricted (restrict). Deletes are cascaded
+// recursively.
+//
+// If a soft delete flag is provided, models that have a field with that flag
+// are soft deleted by setting the field to the current time instead of being
+// removed. Documents that have already been soft deleted are ignored.
+//
+// A transaction is required to ensure atomicity.
+func (m *Manager) Cascade(ctx context.Context, id ID, registry *Registry, softDeleteFlag string) error {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Manager.Cascade")
+	span.Tag("id", id.Hex())
+	defer span.End()
+
+	// require transaction
+	if !HasTransaction(ctx) {
+		return ErrTransactionRequired.Wrap()
+	}
+
+	// prepare visited documents
+	visited := map[*Meta]map[ID]bool{
+		m.meta: {id: true},
+	}
+
+	return cascade(ctx, m.store, registry, m.meta, []ID{id}, softDeleteFlag, visited)
+}
+
+func cascade(ctx context.Context, store *Store, registry *Registry, meta *Meta, ids []ID, softDeleteFlag string, visited map[*Meta]map[ID]bool) error {
+	// check all models
+	for _, model := range registry.All() {
+		// get meta
+		modelMeta := GetMeta(model)
+
+		// get soft delete field
+		var softDeleteField string
+		if softDeleteFlag != "" {
+			softDeleteField = L(model, softDeleteFlag, false)
+		}
+
+		// check all relationships
+		for _, field := range modelMeta.OrderedFields {
+			// skip fields without behaviour
+			if field.RelOnDelete == "" {
+				continue
+			}
+
+			// prepare filter
+			var filter bson.M
+			if (field.ToOne || field.ToMany) && field.RelType == meta.PluralName {
+				filter = bson.M{
+					field.Name: bson.M{
+						"$in": ids,
+					},
+				}
+			} else if (field.PolyToOne || field.PolyToMany) && stick.Contains(field.RelTypes, meta.PluralName) {
+				refs := make([]Ref, 0, len(ids))
+				for _, id := range ids {
+					refs = append(refs, Ref{Type: meta.PluralName, ID: id})
+				}
+				filter = bson.M{
+					field.Name: bson.M{
+						"$in": refs,
+					},
+				}
+			} else {
+				continue
+			}
+
+			// exclude soft deleted documents
+			if softDeleteField != "" {
+				filter[softDeleteField] = nil
+			}
+
+			// get manager
+			manager := store.M(model)
+
+			// apply behaviour
+			switch field.RelOnDelete {
+			case Restrict:
+				// count referencing documents
+				count, err := manager.Count(ctx, filter, 0, 1, false)
+				if err != nil {
+					return err
+				}
+
+				// check count
+				if count > 0 {
+					return ErrDeleteRestricted.WrapF("restricted by %s", modelMeta.Name+"#"+field.RelName)
+				}
+			case Nullify:
+				// unset to-one references
+				if field.ToOne || field.PolyToOne {
+					_, err := manager.UpdateAll(ctx, filter, bson.M{
+						"$set": bson.M{
+							field.Name: nil,
+						},
+					}, false)
+					if err != nil {
+						return err
+					}
+
+					continue
+				}
+
+				// get to-many references
+				references, err := manager.ProjectAll(ctx, filter, field.Name, nil, 0, 0, false)
+				if err != nil {
+					return err
+				}
+
+				// pull to-many references (lungo does not support $pull)
+				for refID, value := range references {
+					// collect remaining references
+					var list interface{}
+					if field.PolyToMany {
+						refs := make([]Ref, 0)
+						for _, item := range value.(bson.A) {
+							if ref, _ := ToRef(item); ref.Type != meta.PluralName || !stick.Contains(ids, ref.ID) {
+								refs = append(refs, ref)
+							}
+						}
+						list = refs
+					} else {
+						refIDs := make([]ID, 0)
+						for _, item := range value.(bson.A) {
+							if id := item.(ID); !stick.Contains(ids, id) {
+								refIDs = append(refIDs, id)
+							}
+						}
+						list = refIDs
+					}
+
+					// update document
+					_, err = manager.Update(ctx, nil, refID, bson.M{
+						"$set": bson.M{
+							field.Name: list,
+						},
+					}, false)
+					if err != nil {
+						return err
+					}
+				}
+			case Cascade:
+				// find referencing documents
+				list, err := manager.Distinct(ctx, "_id", filter, false)
+				if err != nil {
+					return err
+				}
+
+				// collect unvisited documents
+				var refs []ID
+				for _, item := range list {
+					ref := item.(ID)
+					if !visited[modelMeta][ref] {
+						refs = append(refs, ref)
+					}
+				}
+				if len(refs) == 0 {
+					continue
+				}
+
+				// mark documents
+				if visited[modelMeta] == nil {
+					visited[modelMeta] = map[ID]bool{}
+				}
+				for _, ref := range refs {
+					visited[modelMeta][ref] = true
+				}
+
+				// prepare filter
+				refFilter := bson.M{
+					"_id": bson.M{
+						"$in": refs,
+					},
+				}
+
+				// soft delete or delete referencing documents
+				if softDeleteField != "" {
+					_, err = manager.UpdateAll(ctx, refFilter, bson.M{
+						"$set": bson.M{
+							softDeleteField: time.Now(),
+						},
+					}, false)
+				} else {
+					_, err = manager.DeleteAll(ctx, refFilter)
+				}
+				if err != nil {
+					return err
+				}
+
+				// cascade delete
+				err = cascade(ctx, store, registry, modelMeta, refs, softDeleteFlag, visited)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
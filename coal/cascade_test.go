@@ -0,0 +1,263 @@
+package coal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type blogModel struct {
+	Base               `json:"-" bson:",inline" coal:"blogs"`
+	Name               string
+	Entries            HasMany `json:"-" bson:"-" coal:"entries:entries:blog"`
+	FeaturedEntries    HasMany `json:"-" bson:"-" coal:"featured-entries:entries:featured"`
+	ListedEntries      HasMany `json:"-" bson:"-" coal:"listed-entries:entries:blogs"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type entryModel struct {
+	Base               `json:"-" bson:",inline" coal:"entries"`
+	Title              string
+	Blog               ID         `coal:"blog:blogs:cascade"`
+	Featured           *ID        `coal:"featured:blogs:nullify"`
+	Blogs              []ID       `coal:"blogs:blogs:nullify"`
+	Reply              *ID        `coal:"reply:entries:cascade"`
+	Deleted            *time.Time `coal:"soft-delete"`
+	Replies            HasMany    `json:"-" bson:"-" coal:"replies:entries:reply"`
+	Pins               HasMany    `json:"-" bson:"-" coal:"pins:pins:entry"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type pinModel struct {
+	Base               `json:"-" bson:",inline" coal:"pins"`
+	Entry              ID `coal:"entry:entries:restrict"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type markModel struct {
+	Base               `json:"-" bson:",inline" coal:"marks"`
+	Subject            Ref   `coal:"subject:blogs|entries:cascade"`
+	Target             *Ref  `coal:"target:blogs|entries:nullify"`
+	Targets            []Ref `coal:"targets:blogs|entries:nullify"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+func TestManagerDeleteCascade(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		registry := NewRegistry(&blogModel{}, &entryModel{}, &pinModel{})
+
+		blog1 := tester.Insert(&blogModel{Name: "Blog 1"}).(*blogModel)
+		blog2 := tester.Insert(&blogModel{Name: "Blog 2"}).(*blogModel)
+
+		entry1 := tester.Insert(&entryModel{
+			Title: "Entry 1",
+			Blog:  blog1.ID(),
+		}).(*entryModel)
+		entry2 := tester.Insert(&entryModel{
+			Title:    "Entry 2",
+			Blog:     blog2.ID(),
+			Featured: stick.P(blog1.ID()),
+			Blogs:    []ID{blog1.ID(), blog2.ID()},
+		}).(*entryModel)
+		entry3 := tester.Insert(&entryModel{
+			Title: "Entry 3",
+			Blog:  blog2.ID(),
+			Reply: stick.P(entry1.ID()),
+		}).(*entryModel)
+
+		m := tester.Store.M(&blogModel{})
+
+		/* transaction */
+
+		found, err := m.DeleteCascade(nil, nil, blog1.ID(), registry, "")
+		assert.Error(t, err)
+		assert.True(t, ErrTransactionRequired.Is(err))
+		assert.False(t, found)
+
+		/* cascade and nullify */
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			found, err := m.DeleteCascade(ctx, nil, blog1.ID(), registry, "")
+			assert.NoError(t, err)
+			assert.True(t, found)
+			return err
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, 1, tester.Count(&blogModel{}))
+		assert.Equal(t, 1, tester.Count(&entryModel{}))
+
+		entry := tester.Fetch(&entryModel{}, entry2.ID()).(*entryModel)
+		assert.Nil(t, entry.Featured)
+		assert.Equal(t, []ID{blog2.ID()}, entry.Blogs)
+
+		/* missing */
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			found, err := m.DeleteCascade(ctx, nil, entry3.ID(), registry, "")
+			assert.NoError(t, err)
+			assert.False(t, found)
+			return err
+		})
+		assert.NoError(t, err)
+
+		/* restrict */
+
+		tester.Insert(&pinModel{
+			Entry: entry2.ID(),
+		})
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			_, err := m.DeleteCascade(ctx, nil, blog2.ID(), registry, "")
+			return err
+		})
+		assert.Error(t, err)
+		assert.True(t, ErrDeleteRestricted.Is(err))
+
+		assert.Equal(t, 1, tester.Count(&blogModel{}))
+		assert.Equal(t, 1, tester.Count(&entryModel{}))
+
+		/* soft delete */
+
+		tester.DeleteAll(&pinModel{})
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			found, err := m.DeleteCascade(ctx, nil, blog2.ID(), registry, "soft-delete")
+			assert.NoError(t, err)
+			assert.True(t, found)
+			return err
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, 0, tester.Count(&blogModel{}))
+		assert.Equal(t, 1, tester.Count(&entryModel{}))
+
+		entry = tester.Fetch(&entryModel{}, entry2.ID()).(*entryModel)
+		assert.NotNil(t, entry.Deleted)
+		assert.Equal(t, []ID{blog2.ID()}, entry.Blogs)
+	})
+}
+
+func TestManagerDeleteCascadeSoftDelete(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		registry := NewRegistry(&blogModel{}, &entryModel{}, &pinModel{})
+
+		entry1 := tester.Insert(&entryModel{
+			Title: "Entry 1",
+		}).(*entryModel)
+		entry2 := tester.Insert(&entryModel{
+			Title: "Entry 2",
+			Reply: stick.P(entry1.ID()),
+		}).(*entryModel)
+
+		m := tester.Store.M(&entryModel{})
+
+		var model entryModel
+		err := tester.Store.T(nil, false, func(ctx context.Context) error {
+			found, err := m.DeleteCascade(ctx, &model, entry1.ID(), registry, "soft-delete")
+			assert.True(t, found)
+			return err
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, model.Deleted)
+
+		assert.Equal(t, 2, tester.Count(&entryModel{}))
+		assert.NotNil(t, tester.Fetch(&entryModel{}, entry1.ID()).(*entryModel).Deleted)
+		assert.NotNil(t, tester.Fetch(&entryModel{}, entry2.ID()).(*entryModel).Deleted)
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			found, err := m.DeleteCascade(ctx, nil, entry1.ID(), registry, "soft-delete")
+			assert.False(t, found)
+			return err
+		})
+		assert.NoError(t, err)
+	})
+}
+
+func TestManagerCascade(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		registry := NewRegistry(&blogModel{}, &entryModel{}, &pinModel{})
+
+		blog := tester.Insert(&blogModel{Name: "Blog"}).(*blogModel)
+
+		entry1 := tester.Insert(&entryModel{
+			Title: "Entry 1",
+			Blog:  blog.ID(),
+		}).(*entryModel)
+		entry2 := tester.Insert(&entryModel{
+			Title: "Entry 2",
+			Blog:  blog.ID(),
+			Reply: stick.P(entry1.ID()),
+		}).(*entryModel)
+
+		deleted := time.Now()
+		tester.Update(entry2, bson.M{
+			"$set": bson.M{
+				"Deleted": deleted,
+			},
+		})
+
+		m := tester.Store.M(&entryModel{})
+
+		err := m.Cascade(nil, entry1.ID(), registry, "soft-delete")
+		assert.Error(t, err)
+		assert.True(t, ErrTransactionRequired.Is(err))
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			return m.Cascade(ctx, entry1.ID(), registry, "soft-delete")
+		})
+		assert.NoError(t, err)
+
+		entry := tester.Fetch(&entryModel{}, entry2.ID()).(*entryModel)
+		assert.Equal(t, deleted.Unix(), entry.Deleted.Unix())
+	})
+}
+
+func TestManagerCascadePolymorphic(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		registry := NewRegistry(&blogModel{}, &entryModel{}, &pinModel{}, &markModel{})
+
+		tester.DeleteAll(&markModel{})
+
+		blog := tester.Insert(&blogModel{Name: "Blog"}).(*blogModel)
+		entry := tester.Insert(&entryModel{Title: "Entry"}).(*entryModel)
+
+		mark1 := tester.Insert(&markModel{
+			Subject: R(blog),
+			Target:  stick.P(R(entry)),
+		}).(*markModel)
+		mark2 := tester.Insert(&markModel{
+			Subject: R(entry),
+			Target:  stick.P(R(blog)),
+			Targets: []Ref{R(blog), R(entry)},
+		}).(*markModel)
+
+		err := tester.Store.T(nil, false, func(ctx context.Context) error {
+			found, err := tester.Store.M(&blogModel{}).DeleteCascade(ctx, nil, blog.ID(), registry, "")
+			assert.True(t, found)
+			return err
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, 0, tester.Count(&markModel{}, bson.M{"_id": mark1.ID()}))
+
+		mark := tester.Fetch(&markModel{}, mark2.ID()).(*markModel)
+		assert.Equal(t, R(entry), mark.Subject)
+		assert.Nil(t, mark.Target)
+		assert.Equal(t, []Ref{R(entry)}, mark.Targets)
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			found, err := tester.Store.M(&entryModel{}).DeleteCascade(ctx, nil, entry.ID(), registry, "")
+			assert.True(t, found)
+			return err
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, 0, tester.Count(&markModel{}))
+	})
+}
@@ -0,0 +1,126 @@
+package coal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/256dpi/lungo"
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Checkpoints persists stream resume tokens under a name.
+type Checkpoints interface {
+	// Load should return the stored token or nil if absent.
+	Load(ctx context.Context, name string) ([]byte, error)
+
+	// Save should store the token or remove it if nil.
+	Save(ctx context.Context, name string, token []byte) error
+}
+
+// Checkpoint defines how a stream persists its resume token.
+type Checkpoint struct {
+	// The checkpoints used to load and save the token.
+	Checkpoints Checkpoints
+
+	// The name of the checkpoint.
+	Name string
+
+	// The minimum interval between saves. If zero, the token is saved after
+	// every event. The latest token is always saved when the stream stops.
+	Interval time.Duration
+}
+
+// CollectionCheckpoints stores checkpoints in a collection.
+type CollectionCheckpoints struct {
+	store      *Store
+	collection string
+}
+
+// NewCollectionCheckpoints will create and return checkpoints that are stored
+// in the specified collection.
+func NewCollectionCheckpoints(store *Store, collection string) *CollectionCheckpoints {
+	return &CollectionCheckpoints{
+		store:      store,
+		collection: collection,
+	}
+}
+
+// Load implements the Checkpoints interface.
+func (c *CollectionCheckpoints) Load(ctx context.Context, name string) ([]byte, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/CollectionCheckpoints.Load")
+	span.Tag("name", name)
+	defer span.End()
+
+	// find checkpoint
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := c.store.DB().Collection(c.collection).FindOne(ctx, bson.M{
+		"_id": name,
+	}).Decode(&doc)
+	if IsMissing(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, xo.W(err)
+	}
+
+	return doc.Token, nil
+}
+
+// Save implements the Checkpoints interface.
+func (c *CollectionCheckpoints) Save(ctx context.Context, name string, token []byte) error {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/CollectionCheckpoints.Save")
+	span.Tag("name", name)
+	defer span.End()
+
+	// get collection
+	coll := c.store.DB().Collection(c.collection)
+
+	// delete checkpoint if token is missing
+	if token == nil {
+		_, err := coll.DeleteOne(ctx, bson.M{
+			"_id": name,
+		})
+		if err != nil {
+			return xo.W(err)
+		}
+
+		return nil
+	}
+
+	// upsert checkpoint
+	_, err := coll.ReplaceOne(ctx, bson.M{
+		"_id": name,
+	}, bson.M{
+		"_id":     name,
+		"token":   bson.Raw(token),
+		"updated": time.Now(),
+	}, options.Replace().SetUpsert(true))
+	if err != nil {
+		return xo.W(err)
+	}
+
+	return nil
+}
+
+func expiredToken(err error) bool {
+	// check lungo errors, an unknown token is reported using a plain error
+	if errors.Is(err, lungo.ErrLostOplogPosition) || strings.Contains(err.Error(), "unable to resume change stream") {
+		return true
+	}
+
+	// check mongo errors (ChangeStreamFatalError, ChangeStreamHistoryLost)
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.HasErrorCode(280) || serverErr.HasErrorCode(286)
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+package coal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCollectionCheckpoints(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		checkpoints := NewCollectionCheckpoints(tester.Store, "checkpoints")
+
+		_, err := tester.Store.DB().Collection("checkpoints").DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		token, err := checkpoints.Load(nil, "foo")
+		assert.NoError(t, err)
+		assert.Nil(t, token)
+
+		data, err := bson.Marshal(bson.M{"foo": "bar"})
+		assert.NoError(t, err)
+
+		err = checkpoints.Save(nil, "foo", data)
+		assert.NoError(t, err)
+
+		token, err = checkpoints.Load(nil, "foo")
+		assert.NoError(t, err)
+		assert.Equal(t, data, token)
+
+		err = checkpoints.Save(nil, "foo", nil)
+		assert.NoError(t, err)
+
+		token, err = checkpoints.Load(nil, "foo")
+		assert.NoError(t, err)
+		assert.Nil(t, token)
+	})
+}
+
+func TestReconcileWithCheckpoint(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(10 * time.Millisecond)
+
+		checkpoint := &Checkpoint{
+			Checkpoints: NewCollectionCheckpoints(tester.Store, "checkpoints"),
+			Name:        "posts",
+		}
+
+		_, err := tester.Store.DB().Collection("checkpoints").DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		post1 := tester.Insert(&postModel{Title: "1"}).(*postModel)
+
+		var created []string
+		open := make(chan struct{})
+		done := make(chan struct{})
+
+		stream := ReconcileWithCheckpoint(tester.Store, &postModel{}, checkpoint, func() {
+			close(open)
+		}, func(model Model) {
+			created = append(created, model.(*postModel).Title)
+			if model.(*postModel).Title == "2" {
+				close(done)
+			}
+		}, nil, nil, func(err error) {
+			panic(err)
+		})
+
+		<-open
+		assert.Equal(t, []string{"1"}, created)
+
+		post2 := tester.Insert(&postModel{Title: "2"}).(*postModel)
+
+		<-done
+		stream.Close()
+
+		token, err := checkpoint.Checkpoints.Load(nil, "posts")
+		assert.NoError(t, err)
+		assert.NotNil(t, token)
+
+		post3 := tester.Insert(&postModel{Title: "3"}).(*postModel)
+
+		created = nil
+		open = make(chan struct{})
+		done = make(chan struct{})
+
+		stream = ReconcileWithCheckpoint(tester.Store, &postModel{}, checkpoint, func() {
+			close(open)
+		}, func(model Model) {
+			created = append(created, model.(*postModel).Title)
+		}, nil, func(id ID) {
+			assert.Equal(t, post1.ID(), id)
+			close(done)
+		}, func(err error) {
+			panic(err)
+		})
+
+		<-open
+
+		tester.Delete(post1)
+
+		<-done
+		stream.Close()
+
+		assert.Equal(t, []string{"3"}, created)
+		assert.NotZero(t, post2.ID())
+		assert.NotZero(t, post3.ID())
+	})
+}
+
+func TestReconcileWithExpiredCheckpoint(t *testing.T) {
+	tester := NewTester(lungoStore, modelList...)
+	tester.Clean()
+
+	checkpoint := &Checkpoint{
+		Checkpoints: NewCollectionCheckpoints(tester.Store, "checkpoints"),
+		Name:        "posts",
+	}
+
+	data, err := bson.Marshal(bson.M{"ts": "foo"})
+	assert.NoError(t, err)
+
+	err = checkpoint.Checkpoints.Save(nil, "posts", data)
+	assert.NoError(t, err)
+
+	tester.Insert(&postModel{Title: "1"})
+
+	var created []string
+	open := make(chan struct{})
+
+	stream := ReconcileWithCheckpoint(tester.Store, &postModel{}, checkpoint, func() {
+		close(open)
+	}, func(model Model) {
+		created = append(created, model.(*postModel).Title)
+	}, nil, nil, func(err error) {
+		panic(err)
+	})
+
+	<-open
+	stream.Close()
+
+	assert.Equal(t, []string{"1"}, created)
+
+	token, err := checkpoint.Checkpoints.Load(nil, "posts")
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+}
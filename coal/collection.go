@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/256dpi/lungo"
 	"github.com/256dpi/xo"
@@ -26,7 +28,9 @@ func IsDuplicate(err error) bool {
 
 // Collection mimics a collection and adds tracing.
 type Collection struct {
-	coll lungo.ICollection
+	coll   lungo.ICollection
+	store  *Store
+	clones sync.Map
 }
 
 // Native will return the underlying native collection.
@@ -41,8 +45,36 @@ func (c *Collection) Aggregate(ctx context.Context, pipeline interface{}, opts .
 	ctx, span := xo.Trace(ctx, "coal/Collection.Aggregate")
 	span.Tag("collection", c.coll.Name())
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		span.End()
+		return nil, err
+	}
+
+	// get read collection
+	coll, err := c.read(ctx)
+	if err != nil {
+		span.End()
+		return nil, err
+	}
+
+	// explain query
+	err = c.explainQuery(bson.D{
+		{Key: "aggregate", Value: c.coll.Name()},
+		{Key: "pipeline", Value: pipeline},
+		{Key: "cursor", Value: bson.M{}},
+	})
+	if err != nil {
+		span.End()
+		return nil, err
+	}
+
+	// observe duration
+	defer c.observe("aggregate", pipeline, nil, time.Now())
+
 	// aggregate
-	csr, err := c.coll.Aggregate(ctx, pipeline, opts...)
+	csr, err := coll.Aggregate(ctx, pipeline, opts...)
 	if err != nil {
 		span.End()
 		return nil, xo.W(err)
@@ -61,6 +93,12 @@ func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, o
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// bulk write
 	res, err := c.coll.BulkWrite(ctx, models, opts...)
 	if err != nil {
@@ -84,8 +122,32 @@ func (c *Collection) CountDocuments(ctx context.Context, filter interface{}, opt
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// get read collection
+	coll, err := c.read(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// explain query
+	err = c.explainQuery(bson.D{
+		{Key: "count", Value: c.coll.Name()},
+		{Key: "query", Value: ensureFilter(filter)},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// observe duration
+	defer c.observe("countDocuments", filter, nil, time.Now())
+
 	// count documents
-	count, err := c.coll.CountDocuments(ctx, filter, opts...)
+	count, err := coll.CountDocuments(ctx, filter, opts...)
 	if err != nil {
 		return 0, xo.W(err)
 	}
@@ -103,6 +165,15 @@ func (c *Collection) DeleteMany(ctx context.Context, filter interface{}, opts ..
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// observe duration
+	defer c.observe("deleteMany", filter, nil, time.Now())
+
 	// delete many
 	res, err := c.coll.DeleteMany(ctx, filter, opts...)
 	if err != nil {
@@ -122,6 +193,15 @@ func (c *Collection) DeleteOne(ctx context.Context, filter interface{}, opts ...
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// observe duration
+	defer c.observe("deleteOne", filter, nil, time.Now())
+
 	// delete one
 	res, err := c.coll.DeleteOne(ctx, filter, opts...)
 	if err != nil {
@@ -142,8 +222,23 @@ func (c *Collection) Distinct(ctx context.Context, field string, filter interfac
 	span.Tag("field", field)
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// get read collection
+	coll, err := c.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// observe duration
+	defer c.observe("distinct", filter, nil, time.Now())
+
 	// distinct
-	list, err := c.coll.Distinct(ctx, field, filter, opts...)
+	list, err := coll.Distinct(ctx, field, filter, opts...)
 	if err != nil {
 		return nil, xo.W(err)
 	}
@@ -161,8 +256,20 @@ func (c *Collection) EstimatedDocumentCount(ctx context.Context, opts ...*option
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// get read collection
+	coll, err := c.read(ctx)
+	if err != nil {
+		return 0, err
+	}
+
 	// estimate count
-	count, err := c.coll.EstimatedDocumentCount(ctx, opts...)
+	count, err := coll.EstimatedDocumentCount(ctx, opts...)
 	if err != nil {
 		return 0, xo.W(err)
 	}
@@ -179,8 +286,39 @@ func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*opti
 	ctx, span := xo.Trace(ctx, "coal/Collection.Find")
 	span.Tag("collection", c.coll.Name())
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		span.End()
+		return nil, err
+	}
+
+	// get read collection
+	coll, err := c.read(ctx)
+	if err != nil {
+		span.End()
+		return nil, err
+	}
+
+	// get sort
+	sort := options.MergeFindOptions(opts...).Sort
+
+	// explain query
+	err = c.explainQuery(bson.D{
+		{Key: "find", Value: c.coll.Name()},
+		{Key: "filter", Value: ensureFilter(filter)},
+		{Key: "sort", Value: ensureFilter(sort)},
+	})
+	if err != nil {
+		span.End()
+		return nil, err
+	}
+
+	// observe duration
+	defer c.observe("find", filter, sort, time.Now())
+
 	// find
-	csr, err := c.coll.Find(ctx, filter, opts...)
+	csr, err := coll.Find(ctx, filter, opts...)
 	if err != nil {
 		span.End()
 		return nil, xo.W(err)
@@ -199,8 +337,37 @@ func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*o
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// get read collection
+	coll, err := c.read(ctx)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// get sort
+	sort := options.MergeFindOneOptions(opts...).Sort
+
+	// explain query
+	err = c.explainQuery(bson.D{
+		{Key: "find", Value: c.coll.Name()},
+		{Key: "filter", Value: ensureFilter(filter)},
+		{Key: "sort", Value: ensureFilter(sort)},
+		{Key: "limit", Value: 1},
+	})
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// observe duration
+	defer c.observe("findOne", filter, sort, time.Now())
+
 	// find one
-	res := c.coll.FindOne(ctx, filter, opts...)
+	res := coll.FindOne(ctx, filter, opts...)
 
 	return &SingleResult{res: res}
 }
@@ -212,6 +379,15 @@ func (c *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, o
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// observe duration
+	defer c.observe("findOneAndDelete", filter, options.MergeFindOneAndDeleteOptions(opts...).Sort, time.Now())
+
 	// find one and delete
 	res := c.coll.FindOneAndDelete(ctx, filter, opts...)
 
@@ -225,6 +401,15 @@ func (c *Collection) FindOneAndReplace(ctx context.Context, filter interface{},
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// observe duration
+	defer c.observe("findOneAndReplace", filter, options.MergeFindOneAndReplaceOptions(opts...).Sort, time.Now())
+
 	// find and replace one
 	res := c.coll.FindOneAndReplace(ctx, filter, replacement, opts...)
 
@@ -238,6 +423,15 @@ func (c *Collection) FindOneAndUpdate(ctx context.Context, filter interface{}, u
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return &SingleResult{err: err}
+	}
+
+	// observe duration
+	defer c.observe("findOneAndUpdate", filter, options.MergeFindOneAndUpdateOptions(opts...).Sort, time.Now())
+
 	// find one and update
 	res := c.coll.FindOneAndUpdate(ctx, filter, update, opts...)
 
@@ -252,6 +446,12 @@ func (c *Collection) InsertMany(ctx context.Context, documents []interface{}, op
 	span.Tag("count", len(documents))
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// insert many
 	res, err := c.coll.InsertMany(ctx, documents, opts...)
 	if err != nil {
@@ -268,6 +468,12 @@ func (c *Collection) InsertOne(ctx context.Context, document interface{}, opts .
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// insert one
 	res, err := c.coll.InsertOne(ctx, document, opts...)
 	if err != nil {
@@ -284,6 +490,15 @@ func (c *Collection) ReplaceOne(ctx context.Context, filter interface{}, replace
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// observe duration
+	defer c.observe("replaceOne", filter, nil, time.Now())
+
 	// replace one
 	res, err := c.coll.ReplaceOne(ctx, filter, replacement, opts...)
 	if err != nil {
@@ -300,6 +515,15 @@ func (c *Collection) UpdateMany(ctx context.Context, filter interface{}, update
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// observe duration
+	defer c.observe("updateMany", filter, nil, time.Now())
+
 	// update many
 	res, err := c.coll.UpdateMany(ctx, filter, update, opts...)
 	if err != nil {
@@ -321,6 +545,15 @@ func (c *Collection) UpdateOne(ctx context.Context, filter interface{}, update i
 	span.Tag("collection", c.coll.Name())
 	defer span.End()
 
+	// check transaction
+	err := c.checkTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// observe duration
+	defer c.observe("updateOne", filter, nil, time.Now())
+
 	// update one
 	res, err := c.coll.UpdateOne(ctx, filter, update, opts...)
 	if err != nil {
@@ -335,6 +568,16 @@ func (c *Collection) UpdateOne(ctx context.Context, filter interface{}, update i
 	return res, nil
 }
 
+func (c *Collection) checkTransaction(ctx context.Context) error {
+	// check transaction store
+	ok, store := GetTransaction(ctx)
+	if ok && store.client != c.store.client {
+		return ErrCrossStoreTransaction.Wrap()
+	}
+
+	return nil
+}
+
 // Iterator manages the iteration over a cursor.
 type Iterator struct {
 	ctx     context.Context
@@ -428,20 +671,37 @@ func (i *Iterator) Close() {
 // SingleResult wraps a single operation result.
 type SingleResult struct {
 	res lungo.ISingleResult
+	err error
 }
 
 // Decode will decode the document to the specified value.
 func (r *SingleResult) Decode(i interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
 	return xo.W(r.res.Decode(i))
 }
 
 // DecodeBytes will return the raw document bytes.s
 func (r *SingleResult) DecodeBytes() (bson.Raw, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
 	raw, err := r.res.DecodeBytes()
 	return raw, xo.W(err)
 }
 
 // Err return will return the last error.
 func (r *SingleResult) Err() error {
+	if r.err != nil {
+		return r.err
+	}
 	return xo.W(r.res.Err())
 }
+
+func ensureFilter(filter interface{}) interface{} {
+	if filter == nil {
+		return bson.D{}
+	}
+	return filter
+}
@@ -0,0 +1,367 @@
+package coal
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// Counter describes a field that caches the number of documents of a has-many
+// relationship.
+type Counter struct {
+	// The owner model.
+	Owner *Meta
+
+	// The owner counter struct field.
+	Field string
+
+	// The dependent model.
+	Dependent *Meta
+
+	// The dependent to-one relationship struct field.
+	Relationship string
+
+	// The dependent soft delete struct field, if any.
+	SoftDelete string
+}
+
+// AddCounter will register a counter field with the model that caches the
+// number of documents of the specified has-many relationship. The counter is
+// maintained by the manager of the dependent model when documents are inserted,
+// deleted, soft deleted or reassigned to another owner. If a soft delete flag
+// is provided, dependent documents with a non-zero field flagged that way are
+// not counted.
+//
+// Counters are updated as part of the transaction of the operation. Therefore,
+// the manager of the dependent model returns ErrTransactionRequired for writes
+// that may affect a counter if no transaction is present. Documents that are
+// written without the manager will not be counted, Recount may be used to
+// repair the counters in this case.
+func AddCounter(model Model, field, relationship string, dependent Model, softDeleteFlag string) {
+	// get metas
+	meta := GetMeta(model)
+	depMeta := GetMeta(dependent)
+
+	// get fields
+	fieldInfo := meta.Fields[field]
+	relInfo := meta.Fields[relationship]
+
+	// check fields
+	if fieldInfo == nil || fieldInfo.BSONKey == "" {
+		panic(fmt.Sprintf(`coal: unknown or virtual field "%s"`, field))
+	} else if k := fieldInfo.Type.Kind(); k != reflect.Int && k != reflect.Int32 && k != reflect.Int64 {
+		panic(fmt.Sprintf(`coal: counter field "%s" is not an integer`, field))
+	} else if relInfo == nil || !relInfo.HasMany {
+		panic(fmt.Sprintf(`coal: field "%s" is not a has-many relationship`, relationship))
+	} else if relInfo.RelType != depMeta.PluralName {
+		panic(fmt.Sprintf(`coal: relationship "%s" does not reference "%s"`, relationship, depMeta.PluralName))
+	}
+
+	// find inverse relationship
+	var inverse *Field
+	for _, f := range depMeta.OrderedFields {
+		if f.ToOne && f.RelName == relInfo.RelInverse && f.RelType == meta.PluralName {
+			inverse = f
+		}
+	}
+	if inverse == nil {
+		panic(fmt.Sprintf(`coal: missing to-one relationship "%s" on "%s"`, relInfo.RelInverse, depMeta.PluralName))
+	}
+
+	// get soft delete field
+	var softDelete string
+	if softDeleteFlag != "" {
+		softDelete = L(dependent, softDeleteFlag, false)
+	}
+
+	// prepare counter
+	counter := &Counter{
+		Owner:        meta,
+		Field:        field,
+		Dependent:    depMeta,
+		Relationship: inverse.Name,
+		SoftDelete:   softDelete,
+	}
+
+	// add counter
+	meta.Counters = append(meta.Counters, counter)
+	if depMeta != meta {
+		depMeta.Counters = append(depMeta.Counters, counter)
+	}
+}
+
+// Recount will recompute the counter fields of the specified documents. If no
+// ids are provided, all documents are recomputed. Each counter is counted and
+// set in a separate transaction to not overwrite concurrent changes.
+func Recount(ctx context.Context, store *Store, model Model, ids ...ID) error {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Recount")
+	defer span.End()
+
+	// get meta
+	meta := GetMeta(model)
+
+	// load all ids if missing
+	if len(ids) == 0 {
+		// find documents
+		iter, err := store.C(model).Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return err
+		}
+		// decode documents
+		var docs []struct {
+			ID ID `bson:"_id"`
+		}
+		err = iter.All(&docs)
+		if err != nil {
+			return err
+		}
+
+		// collect ids
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+	}
+
+	// handle counters
+	for _, counter := range meta.Counters {
+		// skip dependent counters
+		if counter.Owner != meta {
+			continue
+		}
+
+		// get manager
+		manager := store.M(counter.Dependent.Make())
+
+		for _, id := range ids {
+			// prepare filter
+			filter := bson.M{
+				counter.Relationship: id,
+			}
+			if counter.SoftDelete != "" {
+				filter[counter.SoftDelete] = nil
+			}
+
+			// count and set counter
+			err := store.S(model).T(ctx, false, func(ctx context.Context) error {
+				// count dependents
+				count, err := manager.Count(ctx, filter, 0, 0, false)
+				if err != nil {
+					return err
+				}
+
+				// set counter
+				_, err = store.M(model).UpdateAll(ctx, bson.M{
+					"_id": id,
+				}, bson.M{
+					"$set": bson.M{
+						counter.Field: count,
+					},
+				}, false, NoHooks)
+
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Counter) reference(model Model) (ID, bool) {
+	// check soft delete
+	if c.SoftDelete != "" && !reflect.ValueOf(stick.MustGet(model, c.SoftDelete)).IsZero() {
+		return ID{}, false
+	}
+
+	// get reference
+	switch ref := stick.MustGet(model, c.Relationship).(type) {
+	case ID:
+		return ref, !ref.IsZero()
+	case *ID:
+		if ref != nil && !ref.IsZero() {
+			return *ref, true
+		}
+	}
+
+	return ID{}, false
+}
+
+func (m *Manager) counted() bool {
+	// check counters
+	for _, counter := range m.meta.Counters {
+		if counter.Dependent == m.meta {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Manager) countedUpdate(update bson.D) bool {
+	// check counters
+	if !m.counted() {
+		return false
+	}
+
+	// check updated fields
+	for _, op := range update {
+		fields, _ := op.Value.(bson.D)
+		for _, item := range fields {
+			for _, counter := range m.meta.Counters {
+				if counter.Dependent != m.meta {
+					continue
+				}
+				for _, name := range []string{counter.Relationship, counter.SoftDelete} {
+					if name == "" {
+						continue
+					}
+					key := m.meta.Fields[name].BSONKey
+					if item.Key == key || strings.HasPrefix(key, item.Key+".") {
+						return true
+					}
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (m *Manager) snapshot(ctx context.Context, filter, sort interface{}, limit int64) ([]Model, error) {
+	// check counters
+	if !m.counted() {
+		return nil, nil
+	}
+
+	// prepare projection
+	projection := bson.M{
+		"_id": 1,
+	}
+	for _, counter := range m.meta.Counters {
+		if counter.Dependent == m.meta {
+			projection[m.meta.Fields[counter.Relationship].BSONKey] = 1
+			if counter.SoftDelete != "" {
+				projection[m.meta.Fields[counter.SoftDelete].BSONKey] = 1
+			}
+		}
+	}
+
+	// prepare options
+	opts := options.Find().SetProjection(projection)
+	if sort != nil {
+		opts.SetSort(sort)
+	}
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	// find documents
+	iter, err := m.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode documents
+	var list []Model
+	defer iter.Close()
+	for iter.Next() {
+		model := m.meta.Make()
+		err = iter.Decode(model)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, model)
+	}
+
+	// check error
+	err = iter.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (m *Manager) count(ctx context.Context, before, after []Model) error {
+	// handle counters
+	for _, counter := range m.meta.Counters {
+		// skip owned counters
+		if counter.Dependent != m.meta {
+			continue
+		}
+
+		// compute deltas
+		var ids []ID
+		deltas := map[ID]int64{}
+		for i, list := range [][]Model{before, after} {
+			for _, model := range list {
+				id, ok := counter.reference(model)
+				if !ok {
+					continue
+				}
+				if _, ok := deltas[id]; !ok {
+					ids = append(ids, id)
+				}
+				if i == 0 {
+					deltas[id]--
+				} else {
+					deltas[id]++
+				}
+			}
+		}
+
+		// get collection and key
+		coll := m.store.C(counter.Owner.Make())
+		key := counter.Owner.Fields[counter.Field].BSONKey
+
+		// apply deltas
+		for _, id := range ids {
+			if deltas[id] == 0 {
+				continue
+			}
+			_, err := coll.UpdateOne(ctx, bson.M{
+				"_id": id,
+			}, bson.M{
+				"$inc": bson.M{
+					key: deltas[id],
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func idsOf(list []Model) []ID {
+	// collect ids
+	ids := make([]ID, 0, len(list))
+	for _, model := range list {
+		ids = append(ids, model.ID())
+	}
+
+	return ids
+}
+
+func filterByID(list []Model, id ID) []Model {
+	// filter list
+	for _, model := range list {
+		if model.ID() == id {
+			return []Model{model}
+		}
+	}
+
+	return nil
+}
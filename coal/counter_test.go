@@ -0,0 +1,254 @@
+package coal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/256dpi/xo"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type shelfModel struct {
+	Base      `json:"-" bson:",inline" coal:"shelves"`
+	Name      string  `json:"name"`
+	BookCount int     `json:"book-count"`
+	Books     HasMany `json:"-" bson:"-" coal:"books:books:shelf"`
+}
+
+func (m *shelfModel) Validate() error {
+	return nil
+}
+
+type bookModel struct {
+	Base    `json:"-" bson:",inline" coal:"books"`
+	Title   string     `json:"title"`
+	Shelf   *ID        `json:"-" coal:"shelf:shelves"`
+	Deleted *time.Time `json:"deleted" coal:"soft-delete"`
+}
+
+func (m *bookModel) Validate() error {
+	return nil
+}
+
+func init() {
+	AddCounter(&shelfModel{}, "BookCount", "Books", &bookModel{}, "soft-delete")
+}
+
+func TestAddCounter(t *testing.T) {
+	counter := &Counter{
+		Owner:        GetMeta(&shelfModel{}),
+		Field:        "BookCount",
+		Dependent:    GetMeta(&bookModel{}),
+		Relationship: "Shelf",
+		SoftDelete:   "Deleted",
+	}
+	assert.Equal(t, []*Counter{counter}, GetMeta(&shelfModel{}).Counters)
+	assert.Equal(t, []*Counter{counter}, GetMeta(&bookModel{}).Counters)
+
+	assert.PanicsWithValue(t, `coal: unknown or virtual field "Foo"`, func() {
+		AddCounter(&shelfModel{}, "Foo", "Books", &bookModel{}, "")
+	})
+
+	assert.PanicsWithValue(t, `coal: counter field "Name" is not an integer`, func() {
+		AddCounter(&shelfModel{}, "Name", "Books", &bookModel{}, "")
+	})
+
+	assert.PanicsWithValue(t, `coal: field "Name" is not a has-many relationship`, func() {
+		AddCounter(&shelfModel{}, "BookCount", "Name", &bookModel{}, "")
+	})
+
+	assert.PanicsWithValue(t, `coal: relationship "Books" does not reference "posts"`, func() {
+		AddCounter(&shelfModel{}, "BookCount", "Books", &postModel{}, "")
+	})
+}
+
+func TestCounter(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		shelf1 := tester.Insert(&shelfModel{Name: "A"}).(*shelfModel)
+		shelf2 := tester.Insert(&shelfModel{Name: "B"}).(*shelfModel)
+
+		count := func(shelf *shelfModel) int {
+			return tester.Fetch(&shelfModel{}, shelf.ID()).(*shelfModel).BookCount
+		}
+
+		manager := tester.Store.M(&bookModel{})
+
+		transaction := func(fn func(ctx context.Context) error) {
+			err := tester.Store.T(nil, false, fn)
+			assert.NoError(t, err)
+		}
+
+		/* transaction */
+
+		err := manager.Insert(nil, &bookModel{Title: "A", Shelf: stick.P(shelf1.ID())})
+		assert.True(t, ErrTransactionRequired.Is(err))
+
+		_, err = manager.Update(nil, nil, New(), bson.M{
+			"$set": bson.M{
+				"Shelf": shelf1.ID(),
+			},
+		}, false)
+		assert.True(t, ErrTransactionRequired.Is(err))
+
+		_, err = manager.DeleteAll(nil, bson.M{})
+		assert.True(t, ErrTransactionRequired.Is(err))
+
+		/* insert */
+
+		book1 := &bookModel{Base: B(), Title: "A", Shelf: stick.P(shelf1.ID())}
+		book2 := &bookModel{Base: B(), Title: "B", Shelf: stick.P(shelf1.ID())}
+		book3 := &bookModel{Base: B(), Title: "C", Shelf: stick.P(shelf2.ID())}
+		transaction(func(ctx context.Context) error {
+			err := manager.InsertAll(ctx, []Model{book1, book2})
+			assert.NoError(t, err)
+			return manager.Insert(ctx, book3)
+		})
+		assert.Equal(t, 2, count(shelf1))
+		assert.Equal(t, 1, count(shelf2))
+
+		/* reassign */
+
+		book2.Shelf = stick.P(shelf2.ID())
+		transaction(func(ctx context.Context) error {
+			found, err := manager.Replace(ctx, book2, false)
+			assert.True(t, found)
+			return err
+		})
+		assert.Equal(t, 1, count(shelf1))
+		assert.Equal(t, 2, count(shelf2))
+
+		transaction(func(ctx context.Context) error {
+			found, err := manager.Update(ctx, nil, book3.ID(), bson.M{
+				"$set": bson.M{
+					"Shelf": shelf1.ID(),
+				},
+			}, false)
+			assert.True(t, found)
+			return err
+		})
+		assert.Equal(t, 2, count(shelf1))
+		assert.Equal(t, 1, count(shelf2))
+
+		transaction(func(ctx context.Context) error {
+			n, err := manager.UpdateAll(ctx, bson.M{}, bson.M{
+				"$set": bson.M{
+					"Shelf": shelf2.ID(),
+				},
+			}, false)
+			assert.Equal(t, int64(3), n)
+			return err
+		})
+		assert.Equal(t, 0, count(shelf1))
+		assert.Equal(t, 3, count(shelf2))
+
+		/* unrelated update */
+
+		found, err := manager.Update(nil, nil, book1.ID(), bson.M{
+			"$set": bson.M{
+				"Title": "AA",
+			},
+		}, false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, 3, count(shelf2))
+
+		/* soft delete */
+
+		transaction(func(ctx context.Context) error {
+			found, err := manager.Update(ctx, nil, book1.ID(), bson.M{
+				"$set": bson.M{
+					"Deleted": time.Now(),
+				},
+			}, false)
+			assert.True(t, found)
+			return err
+		})
+		assert.Equal(t, 2, count(shelf2))
+
+		/* delete */
+
+		transaction(func(ctx context.Context) error {
+			found, err := manager.Delete(ctx, nil, book2.ID())
+			assert.True(t, found)
+			return err
+		})
+		assert.Equal(t, 1, count(shelf2))
+
+		transaction(func(ctx context.Context) error {
+			n, err := manager.DeleteAll(ctx, bson.M{})
+			assert.Equal(t, int64(2), n)
+			return err
+		})
+		assert.Equal(t, 0, count(shelf1))
+		assert.Equal(t, 0, count(shelf2))
+
+		/* upsert */
+
+		transaction(func(ctx context.Context) error {
+			inserted, err := manager.Upsert(ctx, nil, bson.M{
+				"Title": "D",
+			}, bson.M{
+				"$set": bson.M{
+					"Shelf": shelf1.ID(),
+				},
+			}, nil, false)
+			assert.True(t, inserted)
+			return err
+		})
+		assert.Equal(t, 1, count(shelf1))
+
+		/* abort */
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			err := manager.Insert(ctx, &bookModel{Title: "E", Shelf: stick.P(shelf1.ID())})
+			assert.NoError(t, err)
+			return xo.F("foo")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, count(shelf1))
+	})
+}
+
+func TestRecount(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		shelf1 := tester.Insert(&shelfModel{Name: "A", BookCount: 7}).(*shelfModel)
+		shelf2 := tester.Insert(&shelfModel{Name: "B", BookCount: 7}).(*shelfModel)
+
+		_, err := tester.Store.C(&bookModel{}).InsertMany(nil, []interface{}{
+			&bookModel{Base: B(), Title: "A", Shelf: stick.P(shelf1.ID())},
+			&bookModel{Base: B(), Title: "B", Shelf: stick.P(shelf1.ID())},
+			&bookModel{Base: B(), Title: "C", Shelf: stick.P(shelf1.ID()), Deleted: stick.P(time.Now())},
+		})
+		assert.NoError(t, err)
+
+		err = Recount(nil, tester.Store, &shelfModel{}, shelf1.ID())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, tester.Fetch(&shelfModel{}, shelf1.ID()).(*shelfModel).BookCount)
+		assert.Equal(t, 7, tester.Fetch(&shelfModel{}, shelf2.ID()).(*shelfModel).BookCount)
+
+		err = Recount(nil, tester.Store, &shelfModel{})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, tester.Fetch(&shelfModel{}, shelf1.ID()).(*shelfModel).BookCount)
+		assert.Equal(t, 0, tester.Fetch(&shelfModel{}, shelf2.ID()).(*shelfModel).BookCount)
+	})
+}
+
+func TestCounterTester(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		shelf := tester.Insert(&shelfModel{Name: "A"}).(*shelfModel)
+
+		book := tester.Insert(&bookModel{Title: "A", Shelf: stick.P(shelf.ID())}).(*bookModel)
+		tester.Insert(&bookModel{Title: "B", Shelf: stick.P(shelf.ID())})
+		assert.Equal(t, 2, tester.Fetch(&shelfModel{}, shelf.ID()).(*shelfModel).BookCount)
+
+		tester.Delete(book)
+		assert.Equal(t, 1, tester.Fetch(&shelfModel{}, shelf.ID()).(*shelfModel).BookCount)
+
+		tester.DeleteAll(&bookModel{})
+		assert.Equal(t, 0, tester.Fetch(&shelfModel{}, shelf.ID()).(*shelfModel).BookCount)
+	})
+}
@@ -0,0 +1,343 @@
+package coal
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// Denormalization describes a field that holds a copy of a field of the
+// document referenced by a to-one relationship.
+type Denormalization struct {
+	// The denormalized struct field.
+	Field string
+
+	// The to-one relationship struct field.
+	Relationship string
+
+	// The source model.
+	Source *Meta
+
+	// The source struct field.
+	SourceField string
+}
+
+// AddDenormalization will register a denormalized field with the model. The
+// field holds a copy of the source field of the document referenced by the
+// specified to-one relationship. The source model must match the relationship
+// and both fields must have the same type.
+//
+// The manager of the model fills the field when documents are inserted or
+// replaced and when updates change the relationship. Propagate, Backfill or
+// SyncDenormalizations should be used to keep the field in sync when the source
+// changes.
+func AddDenormalization(model Model, field string, source Model, relationship, sourceField string) {
+	// get metas
+	meta := GetMeta(model)
+	sourceMeta := GetMeta(source)
+
+	// get fields
+	fieldInfo := meta.Fields[field]
+	relInfo := meta.Fields[relationship]
+	sourceInfo := sourceMeta.Fields[sourceField]
+
+	// check fields
+	if fieldInfo == nil || fieldInfo.BSONKey == "" {
+		panic(fmt.Sprintf(`coal: unknown or virtual field "%s"`, field))
+	} else if relInfo == nil || !relInfo.ToOne {
+		panic(fmt.Sprintf(`coal: field "%s" is not a to-one relationship`, relationship))
+	} else if relInfo.RelType != sourceMeta.PluralName {
+		panic(fmt.Sprintf(`coal: relationship "%s" does not reference "%s"`, relationship, sourceMeta.PluralName))
+	} else if sourceInfo == nil || sourceInfo.BSONKey == "" {
+		panic(fmt.Sprintf(`coal: unknown or virtual source field "%s"`, sourceField))
+	} else if fieldInfo.Type != sourceInfo.Type {
+		panic(fmt.Sprintf(`coal: field "%s" and source field "%s" have different types`, field, sourceField))
+	}
+
+	// add denormalization
+	meta.Denormalizations = append(meta.Denormalizations, Denormalization{
+		Field:        field,
+		Relationship: relationship,
+		Source:       sourceMeta,
+		SourceField:  sourceField,
+	})
+}
+
+// Propagate will copy the denormalized fields of the specified source model to
+// all dependent documents of the models in the registry. It returns the number
+// of updated documents.
+func Propagate(ctx context.Context, store *Store, registry *Registry, source Model) (int64, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Propagate")
+	span.Tag("id", source.ID().Hex())
+	defer span.End()
+
+	// get meta
+	meta := GetMeta(source)
+
+	// check all models
+	var total int64
+	for _, model := range registry.All() {
+		for _, denorm := range GetMeta(model).Denormalizations {
+			// skip unrelated denormalizations
+			if denorm.Source != meta {
+				continue
+			}
+
+			// update dependents
+			n, err := updateDependents(ctx, store, model, denorm, source.ID(), stick.MustGet(source, denorm.SourceField))
+			if err != nil {
+				return total, err
+			}
+
+			// increment
+			total += n
+		}
+	}
+
+	return total, nil
+}
+
+// Backfill will update the denormalized fields of all documents of the
+// specified model that are out of sync with their source documents. It returns
+// the number of updated documents.
+func Backfill(ctx context.Context, store *Store, model Model) (int64, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Backfill")
+	defer span.End()
+
+	// handle all denormalizations
+	var total int64
+	for _, denorm := range GetMeta(model).Denormalizations {
+		// prepare source
+		source := denorm.Source.Make()
+
+		// iterate over all source documents
+		var updateErr error
+		err := store.M(source).ProjectEach(ctx, bson.M{}, denorm.SourceField, nil, 0, 0, false, func(id ID, value interface{}) bool {
+			// update dependents
+			n, err := updateDependents(ctx, store, model, denorm, id, value)
+			if err != nil {
+				updateErr = err
+				return false
+			}
+
+			// increment
+			total += n
+
+			return true
+		}, NoTransaction)
+		if err != nil {
+			return total, err
+		} else if updateErr != nil {
+			return total, updateErr
+		}
+	}
+
+	return total, nil
+}
+
+// SyncDenormalizations will open a stream on the specified source model and
+// propagate the denormalized fields of created and updated documents to the
+// dependent documents of the models in the registry. If backfill is true, the
+// dependent models are backfilled whenever the stream has been opened or
+// resumed to catch up with missed changes. Errors are yielded to the provided
+// callback if available.
+func SyncDenormalizations(store *Store, registry *Registry, source Model, backfill bool, errored func(error)) *Stream {
+	// get meta
+	meta := GetMeta(source)
+
+	// collect dependent models
+	var dependents []Model
+	for _, model := range registry.All() {
+		for _, denorm := range GetMeta(model).Denormalizations {
+			if denorm.Source == meta {
+				dependents = append(dependents, model)
+				break
+			}
+		}
+	}
+
+	// open stream
+	return OpenStream(store, source, nil, func(event Event, id ID, model Model, err error, token []byte) error {
+		// handle events
+		switch event {
+		case Opened, Resumed:
+			// backfill dependents
+			if backfill {
+				for _, dependent := range dependents {
+					_, err := Backfill(nil, store, dependent)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		case Created, Updated:
+			// propagate fields
+			_, err := Propagate(nil, store, registry, model)
+			if err != nil {
+				return err
+			}
+		case Errored:
+			// call callback if available
+			if errored != nil {
+				errored(err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func updateDependents(ctx context.Context, store *Store, model Model, denorm Denormalization, id ID, value interface{}) (int64, error) {
+	// update documents that are out of sync
+	n, err := store.M(model).UpdateAll(ctx, bson.M{
+		denorm.Relationship: id,
+		denorm.Field: bson.M{
+			"$ne": value,
+		},
+	}, bson.M{
+		"$set": bson.M{
+			denorm.Field: value,
+		},
+	}, false, NoHooks)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (m *Manager) denormalize(ctx context.Context, models []Model) error {
+	// handle denormalizations
+	for _, denorm := range m.meta.Denormalizations {
+		// prepare cache
+		sources := map[ID]Model{}
+
+		for _, model := range models {
+			// get reference
+			refs := references(model, m.meta.Fields[denorm.Relationship])
+
+			// unset field if missing
+			if len(refs) == 0 {
+				stick.MustSet(model, denorm.Field, reflect.Zero(m.meta.Fields[denorm.Field].Type).Interface())
+				continue
+			}
+
+			// load source if missing
+			source, ok := sources[refs[0].ID]
+			if !ok {
+				var err error
+				source, err = m.denormSource(ctx, denorm, refs[0].ID)
+				if err != nil {
+					return err
+				}
+				sources[refs[0].ID] = source
+			}
+
+			// set field if found
+			if source != nil {
+				stick.MustSet(model, denorm.Field, stick.MustGet(source, denorm.SourceField))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) denormalizeUpdate(ctx context.Context, updateDoc *bson.D) error {
+	// check denormalizations
+	if len(m.meta.Denormalizations) == 0 {
+		return nil
+	}
+
+	// collect updates
+	update := bson.M{}
+	for _, denorm := range m.meta.Denormalizations {
+		// get key
+		key := m.meta.Fields[denorm.Relationship].BSONKey
+
+		for _, op := range *updateDoc {
+			// get fields
+			fields, _ := op.Value.(bson.D)
+			for _, item := range fields {
+				// check field
+				if item.Key != key {
+					continue
+				}
+
+				// prepare operator
+				if update[op.Key] == nil {
+					update[op.Key] = bson.M{}
+				}
+
+				// handle unset
+				if op.Key == "$unset" {
+					update[op.Key].(bson.M)[denorm.Field] = ""
+					continue
+				}
+
+				// handle set
+				if op.Key != "$set" && op.Key != "$setOnInsert" {
+					continue
+				}
+
+				// get reference
+				id, ok := item.Value.(ID)
+				if !ok || id.IsZero() {
+					update[op.Key].(bson.M)[denorm.Field] = reflect.Zero(m.meta.Fields[denorm.Field].Type).Interface()
+					continue
+				}
+
+				// load source
+				source, err := m.denormSource(ctx, denorm, id)
+				if err != nil {
+					return err
+				} else if source != nil {
+					update[op.Key].(bson.M)[denorm.Field] = stick.MustGet(source, denorm.SourceField)
+				}
+			}
+		}
+	}
+	if len(update) == 0 {
+		return nil
+	}
+
+	// translate update
+	doc, err := m.translateUpdate(update)
+	if err != nil {
+		return err
+	}
+
+	// merge update
+	for _, op := range doc {
+		fields, _ := op.Value.(bson.D)
+		for _, item := range fields {
+			_, err = bsonkit.Put(updateDoc, op.Key+"."+item.Key, item.Value, false)
+			if err != nil {
+				return xo.WF(err, "unable to add denormalized field")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) denormSource(ctx context.Context, denorm Denormalization, id ID) (Model, error) {
+	// find source
+	source := denorm.Source.Make()
+	found, err := m.store.M(source).Find(ctx, source, id, false, NoValidation, NoHooks)
+	if err != nil {
+		return nil, err
+	} else if !found {
+		return nil, nil
+	}
+
+	return source, nil
+}
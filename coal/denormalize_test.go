@@ -0,0 +1,238 @@
+package coal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/256dpi/xo"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type authorModel struct {
+	Base     `json:"-" bson:",inline" coal:"authors"`
+	Name     string  `json:"name"`
+	Articles HasMany `json:"-" bson:"-" coal:"articles:articles:author"`
+}
+
+func (m *authorModel) Validate() error {
+	// check name
+	if strings.TrimSpace(m.Name) != m.Name {
+		return xo.F("invalid name")
+	}
+
+	return nil
+}
+
+type articleModel struct {
+	Base       `json:"-" bson:",inline" coal:"articles"`
+	Title      string `json:"title"`
+	AuthorName string `json:"author-name"`
+	Author     ID     `json:"-" coal:"author:authors"`
+}
+
+func (m *articleModel) Validate() error {
+	// check author name
+	if !m.Author.IsZero() && m.AuthorName == "" {
+		return xo.F("missing author name")
+	}
+
+	return nil
+}
+
+func init() {
+	AddDenormalization(&articleModel{}, "AuthorName", &authorModel{}, "Author", "Name")
+}
+
+func TestAddDenormalization(t *testing.T) {
+	assert.Equal(t, []Denormalization{
+		{
+			Field:        "AuthorName",
+			Relationship: "Author",
+			Source:       GetMeta(&authorModel{}),
+			SourceField:  "Name",
+		},
+	}, GetMeta(&articleModel{}).Denormalizations)
+
+	assert.PanicsWithValue(t, `coal: unknown or virtual field "Foo"`, func() {
+		AddDenormalization(&articleModel{}, "Foo", &authorModel{}, "Author", "Name")
+	})
+
+	assert.PanicsWithValue(t, `coal: field "Title" is not a to-one relationship`, func() {
+		AddDenormalization(&articleModel{}, "AuthorName", &authorModel{}, "Title", "Name")
+	})
+
+	assert.PanicsWithValue(t, `coal: relationship "Author" does not reference "posts"`, func() {
+		AddDenormalization(&articleModel{}, "AuthorName", &postModel{}, "Author", "Title")
+	})
+
+	assert.PanicsWithValue(t, `coal: unknown or virtual source field "Bar"`, func() {
+		AddDenormalization(&articleModel{}, "AuthorName", &authorModel{}, "Author", "Bar")
+	})
+
+	assert.PanicsWithValue(t, `coal: field "Author" and source field "Name" have different types`, func() {
+		AddDenormalization(&articleModel{}, "Author", &authorModel{}, "Author", "Name")
+	})
+}
+
+func TestDenormalizeManager(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		author1 := tester.Insert(&authorModel{Name: "Alice"}).(*authorModel)
+		author2 := tester.Insert(&authorModel{Name: "Bob"}).(*authorModel)
+
+		name := func(article *articleModel) string {
+			return tester.Fetch(&articleModel{}, article.ID()).(*articleModel).AuthorName
+		}
+
+		manager := tester.Store.M(&articleModel{})
+
+		/* insert */
+
+		article1 := tester.Insert(&articleModel{Title: "A", Author: author1.ID()}).(*articleModel)
+		assert.Equal(t, "Alice", article1.AuthorName)
+		assert.Equal(t, "Alice", name(article1))
+
+		article2 := &articleModel{Base: B(), Title: "B", Author: author2.ID(), AuthorName: "Stale"}
+		err := manager.InsertAll(nil, []Model{article2})
+		assert.NoError(t, err)
+		assert.Equal(t, "Bob", name(article2))
+
+		/* replace */
+
+		article1.Author = author2.ID()
+		tester.Replace(article1)
+		assert.Equal(t, "Bob", article1.AuthorName)
+		assert.Equal(t, "Bob", name(article1))
+
+		article1.AuthorName = ""
+		tester.Replace(article1)
+		assert.Equal(t, "Bob", article1.AuthorName)
+
+		/* update */
+
+		tester.Update(article1, bson.M{
+			"$set": bson.M{
+				"Author": author1.ID(),
+			},
+		})
+		assert.Equal(t, "Alice", article1.AuthorName)
+		assert.Equal(t, "Alice", name(article1))
+
+		n, err := manager.UpdateAll(nil, bson.M{}, bson.M{
+			"$set": bson.M{
+				"Author": author2.ID(),
+			},
+		}, false)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		assert.Equal(t, "Bob", name(article1))
+		assert.Equal(t, "Bob", name(article2))
+
+		/* unrelated update */
+
+		tester.Update(article1, bson.M{
+			"$set": bson.M{
+				"Title": "AA",
+			},
+		})
+		assert.Equal(t, "Bob", name(article1))
+
+		/* upsert */
+
+		inserted, err := manager.Upsert(nil, nil, bson.M{
+			"Title": "C",
+		}, bson.M{
+			"$set": bson.M{
+				"Author": author1.ID(),
+			},
+		}, nil, false)
+		assert.NoError(t, err)
+		assert.True(t, inserted)
+
+		article3 := tester.FindLast(&articleModel{}).(*articleModel)
+		assert.Equal(t, "Alice", article3.AuthorName)
+
+		/* missing source */
+
+		tester.Update(article3, bson.M{
+			"$set": bson.M{
+				"Author": New(),
+			},
+		})
+		assert.Equal(t, "Alice", name(article3))
+
+		/* invalid source */
+
+		author3 := &authorModel{Base: B(), Name: " Carol "}
+		_, err = tester.Store.C(author3).InsertOne(nil, author3)
+		assert.NoError(t, err)
+
+		article4 := tester.Insert(&articleModel{Title: "D", Author: author3.ID()}).(*articleModel)
+		assert.Equal(t, " Carol ", article4.AuthorName)
+	})
+}
+
+func TestPropagateAndBackfill(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		registry := NewRegistry(&authorModel{}, &articleModel{})
+
+		author1 := tester.Insert(&authorModel{Name: "Alice"}).(*authorModel)
+		author2 := tester.Insert(&authorModel{Name: "Bob"}).(*authorModel)
+		article1 := &articleModel{Base: B(), Title: "A", Author: author1.ID()}
+		article2 := &articleModel{Base: B(), Title: "B", Author: author1.ID(), AuthorName: "Alice"}
+		article3 := &articleModel{Base: B(), Title: "C", Author: author2.ID()}
+		_, err := tester.Store.C(&articleModel{}).InsertMany(nil, []interface{}{article1, article2, article3})
+		assert.NoError(t, err)
+
+		n, err := Backfill(nil, tester.Store, &articleModel{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		assert.Equal(t, "Alice", tester.Fetch(&articleModel{}, article1.ID()).(*articleModel).AuthorName)
+		assert.Equal(t, "Alice", tester.Fetch(&articleModel{}, article2.ID()).(*articleModel).AuthorName)
+		assert.Equal(t, "Bob", tester.Fetch(&articleModel{}, article3.ID()).(*articleModel).AuthorName)
+
+		n, err = Backfill(nil, tester.Store, &articleModel{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+
+		author1.Name = "Alicia"
+		tester.Replace(author1)
+
+		n, err = Propagate(nil, tester.Store, registry, author1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		assert.Equal(t, "Alicia", tester.Fetch(&articleModel{}, article1.ID()).(*articleModel).AuthorName)
+		assert.Equal(t, "Alicia", tester.Fetch(&articleModel{}, article2.ID()).(*articleModel).AuthorName)
+		assert.Equal(t, "Bob", tester.Fetch(&articleModel{}, article3.ID()).(*articleModel).AuthorName)
+	})
+}
+
+func TestSyncDenormalizations(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(10 * time.Millisecond)
+
+		registry := NewRegistry(&authorModel{}, &articleModel{})
+
+		author := tester.Insert(&authorModel{Name: "Alice"}).(*authorModel)
+		article := &articleModel{Base: B(), Title: "A", Author: author.ID()}
+		_, err := tester.Store.C(article).InsertOne(nil, article)
+		assert.NoError(t, err)
+
+		stream := SyncDenormalizations(tester.Store, registry, &authorModel{}, true, func(err error) {
+			panic(err)
+		})
+		defer stream.Close()
+
+		assert.Eventually(t, func() bool {
+			return tester.Fetch(&articleModel{}, article.ID()).(*articleModel).AuthorName == "Alice"
+		}, 5*time.Second, 10*time.Millisecond)
+
+		author.Name = "Alicia"
+		tester.Replace(author)
+
+		assert.Eventually(t, func() bool {
+			return tester.Fetch(&articleModel{}, article.ID()).(*articleModel).AuthorName == "Alicia"
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
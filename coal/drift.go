@@ -0,0 +1,262 @@
+package coal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// DriftField describes an unknown field found in sampled documents.
+type DriftField struct {
+	// The number of documents that contain the field.
+	Count int64
+
+	// The observed BSON types.
+	Types []string
+}
+
+// Drift describes the differences between a sample of stored documents and the
+// database fields of a model.
+type Drift struct {
+	// The plural name of the model.
+	Model string
+
+	// The collection of the model.
+	Collection string
+
+	// The number of sampled documents.
+	Sampled int64
+
+	// The top-level fields that are not known to the model.
+	Unknown map[string]*DriftField
+
+	// The required fields and the number of documents they are missing in.
+	Missing map[string]int64
+
+	// The type mismatches and the number of documents they occur in.
+	Mismatches map[string]int64
+
+	// the known fields that are absent when an unknown field is present
+	absent map[string]map[string]int64
+}
+
+// SampleDrift will sample up to the specified amount of documents of the
+// model and compare their keys and BSON types with the schema derived by
+// Schema from the database fields of the model.
+//
+// Note: Lungo does not support the "$sample" stage and the first documents
+// of the collection are used instead.
+func SampleDrift(ctx context.Context, store *Store, model Model, size int) (*Drift, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/SampleDrift")
+	defer span.End()
+
+	// get meta and schema
+	meta := GetMeta(model)
+	schema := Schema(model)
+	properties := schema["properties"].(bson.M)
+	required := schema["required"].([]string)
+
+	// sample documents
+	var iter *Iterator
+	var err error
+	if store.Lungo() {
+		iter, err = store.C(model).Find(ctx, bson.M{}, options.Find().SetLimit(int64(size)))
+	} else {
+		iter, err = store.C(model).Aggregate(ctx, []bson.M{
+			{"$sample": bson.M{"size": size}},
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// ensure close
+	defer iter.Close()
+
+	// prepare drift
+	drift := &Drift{
+		Model:      meta.PluralName,
+		Collection: meta.Collection,
+		Unknown:    map[string]*DriftField{},
+		Missing:    map[string]int64{},
+		Mismatches: map[string]int64{},
+		absent:     map[string]map[string]int64{},
+	}
+
+	// check documents
+	for iter.Next() {
+		// decode document
+		var doc bson.Raw
+		err = iter.Decode(&doc)
+		if err != nil {
+			return nil, err
+		}
+
+		// increment
+		drift.Sampled++
+
+		// check elements
+		var unknown []string
+		elements, _ := doc.Elements()
+		for _, element := range elements {
+			// get key and type
+			key := element.Key()
+			typ := bsonTypeAliases[element.Value().Type]
+
+			// check known fields
+			if sub, ok := properties[key].(bson.M); ok {
+				for _, msg := range validateSchema(sub, key, element.Value()) {
+					drift.Mismatches[msg]++
+				}
+				continue
+			}
+
+			// add unknown field
+			field := drift.Unknown[key]
+			if field == nil {
+				field = &DriftField{}
+				drift.Unknown[key] = field
+			}
+			field.Count++
+			if !stick.Contains(field.Types, typ) {
+				field.Types = append(field.Types, typ)
+				sort.Strings(field.Types)
+			}
+			unknown = append(unknown, key)
+		}
+
+		// check required fields
+		for _, key := range required {
+			if _, err := doc.LookupErr(key); err != nil {
+				drift.Missing[key]++
+			}
+		}
+
+		// record absent known fields
+		for _, key := range unknown {
+			for dbKey := range meta.DatabaseFields {
+				if _, err := doc.LookupErr(dbKey); err != nil {
+					if drift.absent[key] == nil {
+						drift.absent[key] = map[string]int64{}
+					}
+					drift.absent[key][dbKey]++
+				}
+			}
+		}
+	}
+
+	// check error
+	err = iter.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	return drift, nil
+}
+
+// Clean returns whether no drift has been detected.
+func (d *Drift) Clean() bool {
+	return len(d.Unknown) == 0 && len(d.Missing) == 0 && len(d.Mismatches) == 0
+}
+
+// Suggest will suggest field renames and unsets that would resolve the unknown
+// fields. An unknown field is suggested to be renamed to a known field if the
+// known field is absent in all documents that contain the unknown field and
+// the observed types match. Otherwise, it is suggested to be unset. The
+// suggestions are heuristics and should be reviewed before being applied.
+func (d *Drift) Suggest(model Model) (map[string]string, []string) {
+	// get properties
+	properties := Schema(model)["properties"].(bson.M)
+
+	// get sorted unknown fields
+	keys := make([]string, 0, len(d.Unknown))
+	for key := range d.Unknown {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// prepare result
+	renames := map[string]string{}
+	unsets := []string{}
+
+	// check fields
+	taken := map[string]bool{}
+	for _, key := range keys {
+		// find candidates
+		var candidates []string
+		for dbKey, count := range d.absent[key] {
+			if count == d.Unknown[key].Count && !taken[dbKey] && typesMatch(properties[dbKey].(bson.M), d.Unknown[key].Types) {
+				candidates = append(candidates, dbKey)
+			}
+		}
+
+		// suggest rename if unambiguous
+		if len(candidates) == 1 {
+			renames[key] = candidates[0]
+			taken[candidates[0]] = true
+			continue
+		}
+
+		// otherwise suggest unset
+		unsets = append(unsets, key)
+	}
+
+	return renames, unsets
+}
+
+// Migrations will return migrations that apply the suggested renames and
+// unsets using RenameFields and UnsetFields.
+func (d *Drift) Migrations(model Model) []Migration {
+	// get suggestions
+	renames, unsets := d.Suggest(model)
+
+	// prepare migrations
+	var migrations []Migration
+	if len(renames) > 0 {
+		migrations = append(migrations, Migration{
+			Name: fmt.Sprintf("rename drifted fields in %s", d.Collection),
+			Migrator: func(ctx context.Context, store *Store) (int64, int64, error) {
+				return RenameFields(ctx, store, model, renames)
+			},
+		})
+	}
+	if len(unsets) > 0 {
+		migrations = append(migrations, Migration{
+			Name: fmt.Sprintf("unset drifted fields in %s", d.Collection),
+			Migrator: func(ctx context.Context, store *Store) (int64, int64, error) {
+				return UnsetFields(ctx, store, model, unsets...)
+			},
+		})
+	}
+
+	return migrations
+}
+
+func typesMatch(schema bson.M, types []string) bool {
+	// get schema types
+	var allowed []interface{}
+	switch bsonType := schema["bsonType"].(type) {
+	case string:
+		allowed = bson.A{bsonType}
+	case bson.A:
+		allowed = bsonType
+	default:
+		return true
+	}
+
+	// check types
+	for _, typ := range types {
+		if !hasType(allowed, typ) {
+			return false
+		}
+	}
+
+	return true
+}
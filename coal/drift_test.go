@@ -0,0 +1,70 @@
+package coal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSampleDrift(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester.Insert(&noteModel{Title: "Hello", CreatedAt: time.Now(), UpdatedAt: time.Now(), Post: New()})
+
+		drift, err := SampleDrift(nil, tester.Store, &noteModel{}, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), drift.Sampled)
+		assert.True(t, drift.Clean())
+
+		_, err = tester.Store.C(&noteModel{}).InsertOne(nil, bson.M{
+			"_id":        New(),
+			"name":       "World",
+			"created_at": time.Now(),
+			"updated_at": "yesterday",
+			"post_id":    New(),
+			"legacy":     int32(1),
+		})
+		assert.NoError(t, err)
+
+		drift, err = SampleDrift(nil, tester.Store, &noteModel{}, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), drift.Sampled)
+		assert.False(t, drift.Clean())
+		assert.Equal(t, map[string]*DriftField{
+			"name": {
+				Count: 1,
+				Types: []string{"string"},
+			},
+			"legacy": {
+				Count: 1,
+				Types: []string{"int"},
+			},
+		}, drift.Unknown)
+		assert.Equal(t, map[string]int64{
+			"title": 1,
+		}, drift.Missing)
+		assert.Equal(t, map[string]int64{
+			"updated_at: expected date, got string": 1,
+		}, drift.Mismatches)
+
+		renames, unsets := drift.Suggest(&noteModel{})
+		assert.Equal(t, map[string]string{
+			"name": "title",
+		}, renames)
+		assert.Equal(t, []string{"legacy"}, unsets)
+
+		migrator := NewMigrator()
+		for _, migration := range drift.Migrations(&noteModel{}) {
+			migrator.Add(migration)
+		}
+		err = migrator.Run(tester.Store, nil, nil)
+		assert.NoError(t, err)
+
+		drift, err = SampleDrift(nil, tester.Store, &noteModel{}, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, drift.Unknown)
+		assert.Empty(t, drift.Missing)
+		assert.Len(t, drift.Mismatches, 1)
+	})
+}
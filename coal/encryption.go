@@ -0,0 +1,720 @@
+package coal
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrMissingKeyring is returned if encrypted fields are accessed using a store
+// that has no keyring configured.
+var ErrMissingKeyring = xo.BF("missing keyring")
+
+const encryptionPrefix = "enc:"
+
+type encryptionKey struct {
+	aead cipher.AEAD
+	mac  []byte
+}
+
+// Keyring manages the keys used to encrypt and decrypt the fields of models
+// flagged as "encrypted". Encrypted values are stored as strings in the form
+// "enc:<key-id>:<ciphertext>" which allows rotating keys. Fields that are also
+// flagged as "deterministic" are encrypted using a nonce derived from the
+// value and can therefore be used in equality filters. Empty values are not
+// encrypted.
+type Keyring struct {
+	current string
+	keys    map[string]*encryptionKey
+	ids     []string
+}
+
+// NewKeyring will create and return a new keyring. The current key is used to
+// encrypt values while all keys are used to decrypt values. The keys must be
+// 32 bytes long and should be derived from a secret using heat.Secret.Derive.
+//
+// Note: NewKeyring will panic if the keys are invalid.
+func NewKeyring(current string, keys map[string][]byte) *Keyring {
+	// check current
+	if keys[current] == nil {
+		panic(fmt.Sprintf(`coal: missing current key "%s"`, current))
+	}
+
+	// prepare keyring
+	keyring := &Keyring{
+		current: current,
+		keys:    map[string]*encryptionKey{},
+	}
+
+	// add keys
+	for id, key := range keys {
+		// check id and key
+		if id == "" || strings.Contains(id, ":") {
+			panic(fmt.Sprintf(`coal: invalid key id "%s"`, id))
+		} else if len(key) != 32 {
+			panic(fmt.Sprintf(`coal: expected key "%s" to be 32 bytes long`, id))
+		}
+
+		// create cipher
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			panic(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			panic(err)
+		}
+
+		// derive mac key
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("deterministic"))
+
+		// add key
+		keyring.keys[id] = &encryptionKey{
+			aead: aead,
+			mac:  mac.Sum(nil),
+		}
+		keyring.ids = append(keyring.ids, id)
+	}
+
+	// sort ids
+	sort.Strings(keyring.ids)
+
+	return keyring
+}
+
+// Encrypt will encrypt the provided plaintext using the current key. If
+// deterministic is requested, the same plaintext will always result in the
+// same ciphertext for a given key.
+func (k *Keyring) Encrypt(plaintext []byte, deterministic bool) (string, error) {
+	return k.encrypt(k.current, plaintext, deterministic)
+}
+
+// Decrypt will decrypt the provided ciphertext using the referenced key.
+func (k *Keyring) Decrypt(ciphertext string) ([]byte, error) {
+	// check prefix
+	if !IsEncrypted(ciphertext) {
+		return nil, xo.F("invalid ciphertext")
+	}
+
+	// split key id and data
+	id, data, ok := strings.Cut(strings.TrimPrefix(ciphertext, encryptionPrefix), ":")
+	if !ok {
+		return nil, xo.F("invalid ciphertext")
+	}
+
+	// get key
+	key := k.keys[id]
+	if key == nil {
+		return nil, xo.F("unknown key %q", id)
+	}
+
+	// decode data
+	bytes, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	// check length
+	nonceSize := key.aead.NonceSize()
+	if len(bytes) < nonceSize {
+		return nil, xo.F("invalid ciphertext")
+	}
+
+	// open data
+	plaintext, err := key.aead.Open(nil, bytes[:nonceSize], bytes[nonceSize:], []byte(id))
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	return plaintext, nil
+}
+
+func (k *Keyring) encrypt(id string, plaintext []byte, deterministic bool) (string, error) {
+	// get key
+	key := k.keys[id]
+
+	// prepare nonce
+	nonce := make([]byte, key.aead.NonceSize())
+	if deterministic {
+		mac := hmac.New(sha256.New, key.mac)
+		mac.Write(plaintext)
+		copy(nonce, mac.Sum(nil))
+	} else {
+		_, err := rand.Read(nonce)
+		if err != nil {
+			return "", xo.W(err)
+		}
+	}
+
+	// seal data
+	data := key.aead.Seal(nonce, nonce, plaintext, []byte(id))
+
+	return encryptionPrefix + id + ":" + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (k *Keyring) encryptAll(plaintext []byte) ([]string, error) {
+	// encrypt deterministically with all keys
+	list := make([]string, 0, len(k.ids))
+	for _, id := range k.ids {
+		ciphertext, err := k.encrypt(id, plaintext, true)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ciphertext)
+	}
+
+	return list, nil
+}
+
+// IsEncrypted returns whether the provided value has been encrypted.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptionPrefix)
+}
+
+// EncryptFields will find all documents of the specified model that have
+// values in encrypted fields that are not yet encrypted or have been encrypted
+// with a key other than the current key. The values are (re-)encrypted with the
+// current key and written using a targeted update that only sets the affected
+// fields if they have not been changed concurrently. The documents are not
+// validated and hooks are not run. The number of matched and modified documents
+// is returned.
+func EncryptFields(ctx context.Context, store *Store, model Model, concurrency int) (int64, int64, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/EncryptFields")
+	defer span.End()
+
+	// get manager
+	manager := store.M(model)
+	if len(manager.encrypted) == 0 {
+		return 0, 0, nil
+	}
+
+	// get keyring
+	keyring, err := manager.keyring()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// prepare prefix range
+	prefix := encryptionPrefix + keyring.current + ":"
+	upper := encryptionPrefix + keyring.current + ";"
+
+	// prepare filter and projection, binary values are always selected
+	var filters []bson.M
+	projection := bson.M{
+		"_id": 1,
+	}
+	for _, field := range manager.encrypted {
+		filters = append(filters, bson.M{
+			field.BSONKey: bson.M{"$lt": prefix, "$ne": ""},
+		}, bson.M{
+			field.BSONKey: bson.M{"$gte": upper},
+		}, bson.M{
+			field.BSONKey: bson.M{"$type": "binData"},
+		})
+		projection[field.BSONKey] = 1
+	}
+
+	// find documents
+	iter, err := store.C(model).Find(ctx, bson.M{
+		"$or": filters,
+	}, options.Find().SetProjection(projection))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// ensure close
+	defer iter.Close()
+
+	// ensure concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	// prepare counters
+	var matched, modified int64
+
+	// prepare channels
+	docs := make(chan bson.M, concurrency)
+	errs := make(chan error, concurrency+1)
+
+	// launch workers
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			// ensure done
+			defer wg.Done()
+
+			for doc := range docs {
+				// encrypt document
+				ok, changed, err := manager.encryptDocument(ctx, keyring, prefix, doc)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				// increment
+				if ok {
+					atomic.AddInt64(&matched, 1)
+				}
+				if changed {
+					atomic.AddInt64(&modified, 1)
+				}
+			}
+		}()
+	}
+
+	// queue documents
+	for iter.Next() && len(errs) == 0 {
+		var doc bson.M
+		err = iter.Decode(&doc)
+		if err != nil {
+			errs <- err
+			break
+		}
+		docs <- doc
+	}
+	close(docs)
+
+	// await workers
+	wg.Wait()
+
+	// check errors
+	if len(errs) > 0 {
+		return matched, modified, <-errs
+	}
+	err = iter.Error()
+	if err != nil {
+		return matched, modified, err
+	}
+
+	return matched, modified, nil
+}
+
+func (m *Manager) encryptDocument(ctx context.Context, keyring *Keyring, prefix string, doc bson.M) (bool, bool, error) {
+	// prepare filter and update
+	filter := bson.M{
+		"_id": doc["_id"],
+	}
+	set := bson.M{}
+
+	// encrypt fields
+	for _, field := range m.encrypted {
+		// get value
+		value := doc[field.BSONKey]
+		var data []byte
+		switch value := value.(type) {
+		case string:
+			data = []byte(value)
+		case primitive.Binary:
+			data = value.Data
+		}
+		if len(data) == 0 || strings.HasPrefix(string(data), prefix) {
+			continue
+		}
+
+		// decrypt stale value
+		plaintext := data
+		if IsEncrypted(string(data)) {
+			var err error
+			plaintext, err = keyring.Decrypt(string(data))
+			if err != nil {
+				return false, false, err
+			}
+		}
+
+		// encrypt plaintext
+		ciphertext, err := keyring.Encrypt(plaintext, field.Deterministic)
+		if err != nil {
+			return false, false, err
+		}
+
+		// add field
+		filter[field.BSONKey] = value
+		if binary, ok := value.(primitive.Binary); ok {
+			set[field.BSONKey] = primitive.Binary{Subtype: binary.Subtype, Data: []byte(ciphertext)}
+		} else {
+			set[field.BSONKey] = ciphertext
+		}
+	}
+
+	// check update
+	if len(set) == 0 {
+		return false, false, nil
+	}
+
+	// update document
+	res, err := m.coll.UpdateOne(ctx, filter, bson.M{
+		"$set": set,
+	})
+	if err != nil {
+		return false, false, err
+	}
+
+	return res.MatchedCount > 0, res.ModifiedCount > 0, nil
+}
+
+func (m *Manager) keyring() (*Keyring, error) {
+	// get keyring
+	keyring := m.store.keyring
+	if keyring == nil {
+		return nil, ErrMissingKeyring.Wrap()
+	}
+
+	return keyring, nil
+}
+
+func (m *Manager) encryptModel(model Model) (Model, error) {
+	// check fields
+	if len(m.encrypted) == 0 {
+		return model, nil
+	}
+
+	// get keyring
+	keyring, err := m.keyring()
+	if err != nil {
+		return nil, err
+	}
+
+	// copy model
+	encrypted := m.meta.Make()
+	reflect.ValueOf(encrypted).Elem().Set(reflect.ValueOf(model).Elem())
+
+	// encrypt fields
+	value := reflect.ValueOf(encrypted).Elem()
+	for _, field := range m.encrypted {
+		// get plaintext
+		fieldValue := value.Field(field.Index)
+		plaintext := fieldBytes(fieldValue)
+		if len(plaintext) == 0 {
+			continue
+		}
+
+		// encrypt plaintext
+		ciphertext, err := keyring.Encrypt(plaintext, field.Deterministic)
+		if err != nil {
+			return nil, err
+		}
+
+		// set ciphertext
+		setFieldBytes(fieldValue, []byte(ciphertext))
+	}
+
+	return encrypted, nil
+}
+
+func (m *Manager) decryptModel(model Model) error {
+	// check fields
+	if len(m.encrypted) == 0 {
+		return nil
+	}
+
+	// decrypt fields
+	value := reflect.ValueOf(model).Elem()
+	for _, field := range m.encrypted {
+		// get ciphertext
+		fieldValue := value.Field(field.Index)
+		ciphertext := string(fieldBytes(fieldValue))
+		if !IsEncrypted(ciphertext) {
+			continue
+		}
+
+		// get keyring
+		keyring, err := m.keyring()
+		if err != nil {
+			return err
+		}
+
+		// decrypt ciphertext
+		plaintext, err := keyring.Decrypt(ciphertext)
+		if err != nil {
+			return err
+		}
+
+		// set plaintext
+		setFieldBytes(fieldValue, plaintext)
+	}
+
+	return nil
+}
+
+func (m *Manager) decryptValue(field string, value interface{}) (interface{}, error) {
+	// check field
+	dbField := m.meta.DatabaseFields[field]
+	if dbField == nil || !dbField.Encrypted {
+		return value, nil
+	}
+
+	// get ciphertext
+	var ciphertext string
+	switch value := value.(type) {
+	case string:
+		ciphertext = value
+	case primitive.Binary:
+		ciphertext = string(value.Data)
+	}
+	if !IsEncrypted(ciphertext) {
+		return value, nil
+	}
+
+	// get keyring
+	keyring, err := m.keyring()
+	if err != nil {
+		return nil, err
+	}
+
+	// decrypt ciphertext
+	plaintext, err := keyring.Decrypt(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	// return plaintext
+	if binary, ok := value.(primitive.Binary); ok {
+		return primitive.Binary{Subtype: binary.Subtype, Data: plaintext}, nil
+	}
+
+	return string(plaintext), nil
+}
+
+func (m *Manager) translateFilter(filter bson.M) (bson.D, error) {
+	// translate filter
+	filterDoc, err := m.trans.Document(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// encrypt filter
+	if len(m.encrypted) > 0 {
+		err = m.encryptFilter(filterDoc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return filterDoc, nil
+}
+
+func (m *Manager) translateUpdate(update bson.M) (bson.D, error) {
+	// translate update
+	updateDoc, err := m.trans.Document(update)
+	if err != nil {
+		return nil, err
+	}
+
+	// check fields
+	if len(m.encrypted) == 0 {
+		return updateDoc, nil
+	}
+
+	// encrypt update
+	for _, pair := range updateDoc {
+		// get fields
+		fields, _ := pair.Value.(bson.D)
+		for i, item := range fields {
+			// check field
+			field := m.meta.DatabaseFields[item.Key]
+			if field == nil || !field.Encrypted {
+				continue
+			}
+
+			// check operator
+			switch pair.Key {
+			case "$set", "$setOnInsert":
+				list, err := m.encryptValue(field, item.Value, false)
+				if err != nil {
+					return nil, err
+				}
+				fields[i].Value = list[0]
+			case "$unset":
+			default:
+				return nil, xo.F("unsupported operator %q on encrypted field %q", pair.Key, field.Name)
+			}
+		}
+	}
+
+	return updateDoc, nil
+}
+
+func (m *Manager) encryptFilter(doc bson.D) error {
+	for i, pair := range doc {
+		// handle logical operators
+		switch pair.Key {
+		case "$and", "$or", "$nor":
+			list, _ := pair.Value.(bson.A)
+			for _, item := range list {
+				if sub, ok := item.(bson.D); ok {
+					err := m.encryptFilter(sub)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+
+		// check field
+		field := m.meta.DatabaseFields[pair.Key]
+		if field == nil || !field.Encrypted {
+			continue
+		}
+
+		// handle direct equality
+		ops, ok := pair.Value.(bson.D)
+		if !ok || len(ops) == 0 || !strings.HasPrefix(ops[0].Key, "$") {
+			list, err := m.encryptValue(field, pair.Value, true)
+			if err != nil {
+				return err
+			}
+			doc[i].Value = bson.D{{Key: "$in", Value: list}}
+			continue
+		}
+
+		// handle operators
+		for j, op := range ops {
+			switch op.Key {
+			case "$eq", "$ne":
+				list, err := m.encryptValue(field, op.Value, true)
+				if err != nil {
+					return err
+				}
+				if op.Key == "$eq" {
+					ops[j] = bson.E{Key: "$in", Value: list}
+				} else {
+					ops[j] = bson.E{Key: "$nin", Value: list}
+				}
+			case "$in", "$nin":
+				values, _ := op.Value.(bson.A)
+				list := make(bson.A, 0, len(values))
+				for _, value := range values {
+					items, err := m.encryptValue(field, value, true)
+					if err != nil {
+						return err
+					}
+					list = append(list, items...)
+				}
+				ops[j].Value = list
+			case "$exists":
+			default:
+				return xo.F("unsupported operator %q on encrypted field %q", op.Key, field.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) encryptValue(field *Field, value interface{}, filter bool) (bson.A, error) {
+	// get plaintext
+	var plaintext []byte
+	switch value := value.(type) {
+	case string:
+		plaintext = []byte(value)
+	case primitive.Binary:
+		plaintext = value.Data
+	case []byte:
+		plaintext = value
+	case nil, primitive.Null:
+	default:
+		return nil, xo.F("unsupported value %T for encrypted field %q", value, field.Name)
+	}
+
+	// keep empty values
+	if len(plaintext) == 0 {
+		return bson.A{value}, nil
+	}
+
+	// check filter
+	if filter && !field.Deterministic {
+		return nil, xo.F("cannot filter non-deterministic encrypted field %q", field.Name)
+	}
+
+	// get keyring
+	keyring, err := m.keyring()
+	if err != nil {
+		return nil, err
+	}
+
+	// encrypt plaintext
+	var ciphertexts []string
+	if filter {
+		ciphertexts, err = keyring.encryptAll(plaintext)
+	} else {
+		var ciphertext string
+		ciphertext, err = keyring.Encrypt(plaintext, field.Deterministic)
+		ciphertexts = []string{ciphertext}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// convert ciphertexts
+	list := make(bson.A, 0, len(ciphertexts))
+	for _, ciphertext := range ciphertexts {
+		switch value := value.(type) {
+		case string:
+			list = append(list, ciphertext)
+		case primitive.Binary:
+			list = append(list, primitive.Binary{Subtype: value.Subtype, Data: []byte(ciphertext)})
+		case []byte:
+			list = append(list, []byte(ciphertext))
+		}
+	}
+
+	return list, nil
+}
+
+func encryptedFields(meta *Meta) []*Field {
+	// collect fields
+	var list []*Field
+	for _, field := range meta.OrderedFields {
+		if field.Encrypted {
+			list = append(list, field)
+		}
+	}
+
+	return list
+}
+
+func fieldBytes(value reflect.Value) []byte {
+	switch value.Kind() {
+	case reflect.String:
+		return []byte(value.String())
+	case reflect.Ptr:
+		if value.IsNil() {
+			return nil
+		}
+		return []byte(value.Elem().String())
+	default:
+		return value.Bytes()
+	}
+}
+
+func setFieldBytes(value reflect.Value, bytes []byte) {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(string(bytes))
+	case reflect.Ptr:
+		str := string(bytes)
+		value.Set(reflect.ValueOf(&str))
+	default:
+		value.SetBytes(bytes)
+	}
+}
@@ -0,0 +1,266 @@
+package coal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type secretModel struct {
+	Base               `json:"-" bson:",inline" coal:"secrets"`
+	Name               string
+	Token              string  `coal:"encrypted"`
+	Email              *string `coal:"encrypted,deterministic"`
+	Data               []byte  `coal:"encrypted"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+var testKey1 = bytes.Repeat([]byte("1"), 32)
+var testKey2 = bytes.Repeat([]byte("2"), 32)
+
+func TestKeyring(t *testing.T) {
+	keyring := NewKeyring("k1", map[string][]byte{
+		"k1": testKey1,
+	})
+
+	ct1, err := keyring.Encrypt([]byte("foo"), false)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(ct1, "enc:k1:"))
+	assert.True(t, IsEncrypted(ct1))
+
+	ct2, err := keyring.Encrypt([]byte("foo"), false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, ct1, ct2)
+
+	pt, err := keyring.Decrypt(ct1)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(pt))
+
+	dt1, err := keyring.Encrypt([]byte("foo"), true)
+	assert.NoError(t, err)
+	dt2, err := keyring.Encrypt([]byte("foo"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, dt1, dt2)
+
+	pt, err = keyring.Decrypt(dt1)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(pt))
+
+	/* rotation */
+
+	rotated := NewKeyring("k2", map[string][]byte{
+		"k1": testKey1,
+		"k2": testKey2,
+	})
+
+	pt, err = rotated.Decrypt(ct1)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(pt))
+
+	ct3, err := rotated.Encrypt([]byte("foo"), false)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(ct3, "enc:k2:"))
+
+	_, err = keyring.Decrypt(ct3)
+	assert.Error(t, err)
+	assert.Equal(t, `unknown key "k2"`, err.Error())
+
+	/* errors */
+
+	_, err = keyring.Decrypt("foo")
+	assert.Error(t, err)
+	assert.Equal(t, "invalid ciphertext", err.Error())
+
+	_, err = keyring.Decrypt(ct1[:len(ct1)-2])
+	assert.Error(t, err)
+
+	assert.PanicsWithValue(t, `coal: missing current key "k3"`, func() {
+		NewKeyring("k3", map[string][]byte{
+			"k1": testKey1,
+		})
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid key id "k:1"`, func() {
+		NewKeyring("k:1", map[string][]byte{
+			"k:1": testKey1,
+		})
+	})
+
+	assert.PanicsWithValue(t, `coal: expected key "k1" to be 32 bytes long`, func() {
+		NewKeyring("k1", map[string][]byte{
+			"k1": []byte("foo"),
+		})
+	})
+}
+
+func TestManagerEncryption(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester.Store.SetKeyring(nil)
+		defer tester.Store.SetKeyring(nil)
+
+		m := tester.Store.M(&secretModel{})
+
+		/* missing keyring */
+
+		err := m.Insert(nil, &secretModel{
+			Token: "secret",
+		})
+		assert.Error(t, err)
+		assert.True(t, ErrMissingKeyring.Is(err))
+
+		tester.Store.SetKeyring(NewKeyring("k1", map[string][]byte{
+			"k1": testKey1,
+		}))
+
+		/* insert */
+
+		model := &secretModel{
+			Name:  "Foo",
+			Token: "secret",
+			Email: stick.P("foo@example.com"),
+			Data:  []byte("data"),
+		}
+		err = m.Insert(nil, model)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", model.Token)
+
+		var raw bson.M
+		err = tester.Store.C(&secretModel{}).FindOne(nil, bson.M{}).Decode(&raw)
+		assert.NoError(t, err)
+		assert.Equal(t, "Foo", raw["name"])
+		assert.True(t, IsEncrypted(raw["token"].(string)))
+		assert.True(t, IsEncrypted(raw["email"].(string)))
+		assert.NotContains(t, raw["token"], "secret")
+
+		/* find */
+
+		var found secretModel
+		ok, err := m.Find(nil, &found, model.ID(), false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "secret", found.Token)
+		assert.Equal(t, "foo@example.com", *found.Email)
+		assert.Equal(t, []byte("data"), found.Data)
+
+		/* filter */
+
+		var list []*secretModel
+		err = m.FindAll(nil, &list, bson.M{
+			"Email": "foo@example.com",
+		}, nil, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+		assert.Equal(t, "secret", list[0].Token)
+
+		count, err := m.Count(nil, bson.M{
+			"Email": bson.M{
+				"$in": bson.A{"bar@example.com", "foo@example.com"},
+			},
+		}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		count, err = m.Count(nil, bson.M{
+			"Email": bson.M{
+				"$ne": "foo@example.com",
+			},
+		}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), count)
+
+		_, err = m.Count(nil, bson.M{
+			"Token": "secret",
+		}, 0, 0, false, NoTransaction)
+		assert.Error(t, err)
+		assert.Equal(t, `cannot filter non-deterministic encrypted field "Token"`, err.Error())
+
+		_, err = m.Count(nil, bson.M{
+			"Email": bson.M{
+				"$regex": "foo",
+			},
+		}, 0, 0, false, NoTransaction)
+		assert.Error(t, err)
+		assert.Equal(t, `unsupported operator "$regex" on encrypted field "Email"`, err.Error())
+
+		/* update */
+
+		ok, err = m.Update(nil, &found, model.ID(), bson.M{
+			"$set": bson.M{
+				"Token": "new-secret",
+			},
+		}, false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "new-secret", found.Token)
+
+		value, ok, err := m.Project(nil, model.ID(), "Token", false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "new-secret", value)
+
+		_, err = m.Update(nil, nil, model.ID(), bson.M{
+			"$push": bson.M{
+				"Data": "foo",
+			},
+		}, false)
+		assert.Error(t, err)
+		assert.Equal(t, `unsupported operator "$push" on encrypted field "Data"`, err.Error())
+
+		/* rotation */
+
+		tester.Store.SetKeyring(NewKeyring("k2", map[string][]byte{
+			"k1": testKey1,
+			"k2": testKey2,
+		}))
+
+		count, err = m.Count(nil, bson.M{
+			"Email": "foo@example.com",
+		}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		plain := tester.Insert(&secretModel{
+			Name: "Bar",
+		}).(*secretModel)
+		_, err = tester.Store.C(&secretModel{}).UpdateOne(nil, bson.M{
+			"_id": plain.ID(),
+		}, bson.M{
+			"$set": bson.M{
+				"token": "plain",
+			},
+		})
+		assert.NoError(t, err)
+
+		matched, modified, err := EncryptFields(nil, tester.Store, &secretModel{}, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), matched)
+		assert.Equal(t, int64(2), modified)
+
+		var raws []bson.M
+		iter, err := tester.Store.C(&secretModel{}).Find(nil, bson.M{})
+		assert.NoError(t, err)
+		assert.NoError(t, iter.All(&raws))
+		assert.Len(t, raws, 2)
+		for _, raw := range raws {
+			assert.True(t, strings.HasPrefix(raw["token"].(string), "enc:k2:"))
+			assert.Nil(t, raw["_lk"])
+		}
+
+		matched, modified, err = EncryptFields(nil, tester.Store, &secretModel{}, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), matched)
+		assert.Equal(t, int64(0), modified)
+
+		found = secretModel{}
+		ok, err = m.Find(nil, &found, plain.ID(), false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "plain", found.Token)
+		assert.Nil(t, found.Email)
+	})
+}
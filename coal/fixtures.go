@@ -0,0 +1,381 @@
+package coal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/256dpi/xo"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixtures is a set of records keyed by the plural name of their model and a
+// symbolic record name. Each record maps attribute JSON keys, relationship
+// names or struct field names to values. To-one and to-many relationships
+// reference other records by their symbolic names or raw hex ids. An explicit
+// id may be provided using the "_id" key.
+//
+//	posts:
+//	  hello:
+//	    title: Hello World!
+//	comments:
+//	  first:
+//	    message: Great post!
+//	    post: hello
+type Fixtures map[string]map[string]map[string]interface{}
+
+// Fixture is a single model built from a fixture record.
+type Fixture struct {
+	// The symbolic record name.
+	Name string
+
+	// The built model.
+	Model Model
+}
+
+// ParseFixtures will parse the provided JSON or YAML fixture data.
+func ParseFixtures(data []byte) (Fixtures, error) {
+	// parse data
+	var fixtures Fixtures
+	err := yaml.Unmarshal(data, &fixtures)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	return fixtures, nil
+}
+
+// ReadFixtures will read and merge the provided JSON or YAML fixture files.
+func ReadFixtures(files ...string) (Fixtures, error) {
+	// prepare fixtures
+	fixtures := Fixtures{}
+
+	// read files
+	for _, file := range files {
+		// read file
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+
+		// parse data
+		parsed, err := ParseFixtures(data)
+		if err != nil {
+			return nil, xo.WF(err, "invalid fixtures %q", file)
+		}
+
+		// merge records
+		for pluralName, records := range parsed {
+			if fixtures[pluralName] == nil {
+				fixtures[pluralName] = map[string]map[string]interface{}{}
+			}
+			for name, record := range records {
+				if fixtures[pluralName][name] != nil {
+					return nil, xo.F("duplicate fixture %q", pluralName+"/"+name)
+				}
+				fixtures[pluralName][name] = record
+			}
+		}
+	}
+
+	return fixtures, nil
+}
+
+// Build will build and validate the models of all records using the provided
+// registry. Records without an explicit id receive an id derived from their
+// plural and symbolic name to allow repeated upserts. The optional prepare
+// function may return an amended model before it is validated. The returned
+// fixtures are ordered so that referenced models precede referencing models
+// where possible.
+func (f Fixtures) Build(registry *Registry, prepare func(Model) Model) ([]Fixture, error) {
+	// check models and assign ids
+	ids := map[string]map[string]ID{}
+	for pluralName, records := range f {
+		// check model
+		if registry.Lookup(pluralName) == nil {
+			return nil, xo.F("unknown model %q", pluralName)
+		}
+
+		// assign ids
+		ids[pluralName] = map[string]ID{}
+		for name, record := range records {
+			// use explicit id
+			if str, ok := record["_id"].(string); ok {
+				id, err := FromHex(str)
+				if err != nil {
+					return nil, xo.WF(err, "invalid id for fixture %q", pluralName+"/"+name)
+				}
+				ids[pluralName][name] = id
+				continue
+			}
+
+			// derive id
+			sum := sha256.Sum256([]byte(pluralName + "/" + name))
+			var id ID
+			copy(id[:], sum[:])
+			ids[pluralName][name] = id
+		}
+	}
+
+	// build fixtures
+	var fixtures []Fixture
+	for _, pluralName := range fixtureOrder(registry, f) {
+		// get meta
+		meta := GetMeta(registry.Lookup(pluralName))
+
+		// get sorted names
+		names := make([]string, 0, len(f[pluralName]))
+		for name := range f[pluralName] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// build models
+		for _, name := range names {
+			model, err := buildFixture(meta, ids, pluralName, name, f[pluralName][name])
+			if err != nil {
+				return nil, err
+			}
+
+			// prepare model
+			if prepare != nil {
+				model = prepare(model)
+			}
+
+			// validate model
+			err = model.Validate()
+			if err != nil {
+				return nil, xo.WF(err, "invalid fixture %q", pluralName+"/"+name)
+			}
+
+			// add fixture
+			fixtures = append(fixtures, Fixture{
+				Name:  pluralName + "/" + name,
+				Model: model,
+			})
+		}
+	}
+
+	return fixtures, nil
+}
+
+// Seed will build the fixtures and insert the models as part of a transaction.
+// If upsert is requested existing documents are replaced instead. Fixtures of
+// models that are routed to other stores are inserted using a separate
+// transaction per store.
+func (f Fixtures) Seed(ctx context.Context, store *Store, registry *Registry, upsert bool) ([]Fixture, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Fixtures.Seed")
+	defer span.End()
+
+	// build fixtures
+	fixtures, err := f.Build(registry, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// group fixtures by store
+	var stores []*Store
+	groups := map[*Store][]Fixture{}
+	for _, fixture := range fixtures {
+		s := store.S(fixture.Model)
+		if groups[s] == nil {
+			stores = append(stores, s)
+		}
+		groups[s] = append(groups[s], fixture)
+	}
+
+	// insert or replace models
+	for _, s := range stores {
+		err = s.T(ctx, false, func(ctx context.Context) error {
+			for _, fixture := range groups[s] {
+				// replace model
+				if upsert {
+					found, err := s.M(fixture.Model).Replace(ctx, fixture.Model, false)
+					if err != nil {
+						return err
+					} else if found {
+						continue
+					}
+				}
+
+				// insert model
+				err := s.M(fixture.Model).Insert(ctx, fixture.Model)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fixtures, nil
+}
+
+func buildFixture(meta *Meta, ids map[string]map[string]ID, pluralName, name string, record map[string]interface{}) (Model, error) {
+	// prepare model
+	model := meta.Make()
+	model.GetBase().DocID = ids[pluralName][name]
+	value := reflect.ValueOf(model).Elem()
+
+	// prepare resolver
+	resolve := func(relType string, ref interface{}) (ID, error) {
+		// check reference
+		str, ok := ref.(string)
+		if !ok {
+			return ID{}, xo.F("invalid reference %v in fixture %q", ref, pluralName+"/"+name)
+		}
+
+		// check records
+		if id, ok := ids[relType][str]; ok {
+			return id, nil
+		}
+
+		// check raw id
+		if IsHex(str) {
+			return MustFromHex(str), nil
+		}
+
+		return ID{}, xo.F("unknown reference %q in fixture %q", relType+"/"+str, pluralName+"/"+name)
+	}
+
+	// set fields
+	for key, val := range record {
+		// skip id
+		if key == "_id" {
+			continue
+		}
+
+		// find field
+		field := meta.Attributes[key]
+		if field == nil {
+			field = meta.Relationships[key]
+		}
+		if field == nil {
+			field = meta.Fields[key]
+		}
+		if field == nil || field.HasOne || field.HasMany {
+			return nil, xo.F("unknown field %q in fixture %q", key, pluralName+"/"+name)
+		}
+
+		// get field value
+		fieldValue := value.Field(field.Index)
+
+		// handle relationships
+		if field.ToOne {
+			// handle optional
+			if val == nil && field.Optional {
+				fieldValue.Set(reflect.Zero(field.Type))
+				continue
+			}
+
+			// resolve reference
+			id, err := resolve(field.RelType, val)
+			if err != nil {
+				return nil, err
+			}
+
+			// set id
+			if field.Optional {
+				fieldValue.Set(reflect.ValueOf(&id))
+			} else {
+				fieldValue.Set(reflect.ValueOf(id))
+			}
+
+			continue
+		} else if field.ToMany {
+			// check list
+			refs, ok := val.([]interface{})
+			if !ok && val != nil {
+				return nil, xo.F("invalid references for %q in fixture %q", key, pluralName+"/"+name)
+			}
+
+			// resolve references
+			list := make([]ID, 0, len(refs))
+			for _, ref := range refs {
+				id, err := resolve(field.RelType, ref)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, id)
+			}
+
+			// set ids
+			fieldValue.Set(reflect.ValueOf(list))
+
+			continue
+		}
+
+		// set value using JSON
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+		err = json.Unmarshal(data, fieldValue.Addr().Interface())
+		if err != nil {
+			return nil, xo.WF(err, "invalid value for %q in fixture %q", key, pluralName+"/"+name)
+		}
+	}
+
+	return model, nil
+}
+
+func fixtureOrder(registry *Registry, fixtures Fixtures) []string {
+	// collect dependencies
+	deps := map[string]map[string]bool{}
+	for pluralName := range fixtures {
+		deps[pluralName] = map[string]bool{}
+		for _, field := range GetMeta(registry.Lookup(pluralName)).OrderedFields {
+			if (field.ToOne || field.ToMany) && field.RelType != pluralName && fixtures[field.RelType] != nil {
+				deps[pluralName][field.RelType] = true
+			}
+		}
+	}
+
+	// sort names
+	var remaining []string
+	for pluralName := range fixtures {
+		remaining = append(remaining, pluralName)
+	}
+	sort.Strings(remaining)
+
+	// order names
+	var order []string
+	done := map[string]bool{}
+	for len(remaining) > 0 {
+		// find model with met dependencies
+		index := -1
+		for i, pluralName := range remaining {
+			met := true
+			for dep := range deps[pluralName] {
+				if !done[dep] {
+					met = false
+					break
+				}
+			}
+			if met {
+				index = i
+				break
+			}
+		}
+
+		// break cycles using the first remaining model
+		if index < 0 {
+			index = 0
+		}
+
+		// add model
+		order = append(order, remaining[index])
+		done[remaining[index]] = true
+		remaining = append(remaining[:index], remaining[index+1:]...)
+	}
+
+	return order
+}
@@ -0,0 +1,202 @@
+package coal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var fixturesYAML = `
+posts:
+  hello:
+    title: Hello World!
+    published: true
+comments:
+  first:
+    message: Great post!
+    post: hello
+  reply:
+    message: Thanks!
+    post: hello
+    parent: first
+selections:
+  all:
+    name: All
+    posts: [hello]
+`
+
+func TestParseFixtures(t *testing.T) {
+	fixtures, err := ParseFixtures([]byte(fixturesYAML))
+	assert.NoError(t, err)
+	assert.Equal(t, "Great post!", fixtures["comments"]["first"]["message"])
+
+	fixtures, err = ParseFixtures([]byte(`{"posts":{"hello":{"title":"Hello"}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", fixtures["posts"]["hello"]["title"])
+
+	_, err = ParseFixtures([]byte(`posts: [`))
+	assert.Error(t, err)
+}
+
+func TestReadFixtures(t *testing.T) {
+	dir := t.TempDir()
+
+	file1 := filepath.Join(dir, "posts.yaml")
+	err := os.WriteFile(file1, []byte("posts:\n  hello:\n    title: Hello\n"), 0644)
+	assert.NoError(t, err)
+
+	file2 := filepath.Join(dir, "comments.json")
+	err = os.WriteFile(file2, []byte(`{"comments":{"first":{"post":"hello"}}}`), 0644)
+	assert.NoError(t, err)
+
+	fixtures, err := ReadFixtures(file1, file2)
+	assert.NoError(t, err)
+	assert.Len(t, fixtures, 2)
+
+	_, err = ReadFixtures(file1, file1)
+	assert.Error(t, err)
+	assert.Equal(t, `duplicate fixture "posts/hello"`, err.Error())
+}
+
+func TestFixturesBuild(t *testing.T) {
+	registry := NewRegistry(&postModel{}, &commentModel{}, &selectionModel{})
+
+	fixtures, err := ParseFixtures([]byte(fixturesYAML))
+	assert.NoError(t, err)
+
+	list, err := fixtures.Build(registry, nil)
+	assert.NoError(t, err)
+	assert.Len(t, list, 4)
+
+	names := make([]string, 0, len(list))
+	for _, fixture := range list {
+		names = append(names, fixture.Name)
+	}
+	assert.Equal(t, []string{
+		"posts/hello",
+		"comments/first",
+		"comments/reply",
+		"selections/all",
+	}, names)
+
+	post := list[0].Model.(*postModel)
+	first := list[1].Model.(*commentModel)
+	reply := list[2].Model.(*commentModel)
+	selection := list[3].Model.(*selectionModel)
+	assert.Equal(t, "Hello World!", post.Title)
+	assert.True(t, post.Published)
+	assert.Equal(t, post.ID(), first.Post)
+	assert.Nil(t, first.Parent)
+	assert.Equal(t, first.ID(), *reply.Parent)
+	assert.Equal(t, []ID{post.ID()}, selection.Posts)
+
+	again, err := fixtures.Build(registry, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, list, again)
+
+	list, err = fixtures.Build(registry, func(model Model) Model {
+		if post, ok := model.(*postModel); ok {
+			post.TextBody = "Prepared"
+		}
+		return model
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Prepared", list[0].Model.(*postModel).TextBody)
+
+	/* explicit id */
+
+	id := New()
+	list, err = Fixtures{
+		"posts": {
+			"hello": {"_id": id.Hex()},
+		},
+	}.Build(registry, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, id, list[0].Model.ID())
+
+	/* errors */
+
+	_, err = Fixtures{
+		"foos": {"bar": {}},
+	}.Build(registry, nil)
+	assert.Error(t, err)
+	assert.Equal(t, `unknown model "foos"`, err.Error())
+
+	_, err = Fixtures{
+		"posts": {"hello": {"foo": "bar"}},
+	}.Build(registry, nil)
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "foo" in fixture "posts/hello"`, err.Error())
+
+	_, err = Fixtures{
+		"comments": {"first": {"post": "missing"}},
+	}.Build(registry, nil)
+	assert.Error(t, err)
+	assert.Equal(t, `unknown reference "posts/missing" in fixture "comments/first"`, err.Error())
+
+	_, err = Fixtures{
+		"posts": {"hello": {"published": "yes"}},
+	}.Build(registry, nil)
+	assert.Error(t, err)
+}
+
+func TestFixturesSeed(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		registry := NewRegistry(&postModel{}, &commentModel{}, &selectionModel{})
+
+		fixtures, err := ParseFixtures([]byte(fixturesYAML))
+		assert.NoError(t, err)
+
+		list, err := fixtures.Seed(nil, tester.Store, registry, false)
+		assert.NoError(t, err)
+		assert.Len(t, list, 4)
+		assert.Equal(t, 1, tester.Count(&postModel{}))
+		assert.Equal(t, 2, tester.Count(&commentModel{}))
+		assert.Equal(t, 1, tester.Count(&selectionModel{}))
+
+		_, err = fixtures.Seed(nil, tester.Store, registry, false)
+		assert.Error(t, err)
+
+		fixtures["posts"]["hello"]["title"] = "Updated"
+		_, err = fixtures.Seed(nil, tester.Store, registry, true)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, tester.Count(&postModel{}))
+
+		post := tester.Fetch(&postModel{}, list[0].Model.ID()).(*postModel)
+		assert.Equal(t, "Updated", post.Title)
+	})
+}
+
+func TestFixturesSeedRouter(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		router := NewRouter()
+		router.Add("logs", logStore)
+
+		store := NewStore(tester.Store.Client(), tester.Store.defDB, nil, nil)
+		store.SetRouter(router)
+
+		_, err := logStore.C(&logModel{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		registry := NewRegistry(&postModel{}, &commentModel{}, &selectionModel{}, &logModel{})
+
+		fixtures, err := ParseFixtures([]byte(fixturesYAML + `
+logs:
+  seeded:
+    Message: Seeded!
+`))
+		assert.NoError(t, err)
+
+		list, err := fixtures.Seed(nil, store, registry, false)
+		assert.NoError(t, err)
+		assert.Len(t, list, 5)
+		assert.Equal(t, 1, tester.Count(&postModel{}))
+
+		n, err := logStore.C(&logModel{}).CountDocuments(nil, bson.M{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+}
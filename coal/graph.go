@@ -0,0 +1,428 @@
+package coal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/256dpi/xo"
+)
+
+// Graph is a structured description of models and their relationships.
+type Graph struct {
+	// The models sorted by plural name.
+	Models []GraphModel `json:"models"`
+
+	// The relationships sorted by model and relationship name.
+	Relationships []GraphRelationship `json:"relationships"`
+}
+
+// GraphModel describes a model in a graph.
+type GraphModel struct {
+	// The Go name of the model e.g. "coal.postModel".
+	Name string `json:"name"`
+
+	// The package path of the model.
+	Package string `json:"package"`
+
+	// The plural name of the model.
+	PluralName string `json:"pluralName"`
+
+	// The collection of the model.
+	Collection string `json:"collection"`
+
+	// The fields of the model.
+	Fields []GraphField `json:"fields"`
+
+	// The indexes of the model.
+	Indexes []GraphIndex `json:"indexes,omitempty"`
+}
+
+// GraphField describes a field of a model in a graph.
+type GraphField struct {
+	// The struct field name.
+	Name string `json:"name"`
+
+	// The Go type of the field.
+	Type string `json:"type"`
+
+	// The JSON key of the field.
+	JSONKey string `json:"jsonKey,omitempty"`
+
+	// The BSON key of the field.
+	BSONKey string `json:"bsonKey,omitempty"`
+
+	// Whether the field is optional.
+	Optional bool `json:"optional,omitempty"`
+
+	// The relationship name and type if the field is a relationship.
+	RelName string `json:"relName,omitempty"`
+	RelType string `json:"relType,omitempty"`
+
+	// Whether the field is virtual (has-one or has-many relationship).
+	Virtual bool `json:"virtual,omitempty"`
+}
+
+// GraphIndex describes an index of a model in a graph.
+type GraphIndex struct {
+	// The indexed struct fields.
+	Fields []string `json:"fields"`
+
+	// Whether the index is unique.
+	Unique bool `json:"unique,omitempty"`
+
+	// The automatic expiry of documents.
+	Expiry time.Duration `json:"expiry,omitempty"`
+
+	// Whether the index has a partial filter expression.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// GraphRelationship describes a to-one or to-many relationship in a graph.
+type GraphRelationship struct {
+	// The plural name of the owning model.
+	From string `json:"from"`
+
+	// The plural name of the related model.
+	To string `json:"to"`
+
+	// The relationship name.
+	Name string `json:"name"`
+
+	// The struct field name.
+	Field string `json:"field"`
+
+	// Whether the relationship is optional.
+	Optional bool `json:"optional,omitempty"`
+
+	// Whether the relationship is a to-many relationship.
+	Many bool `json:"many,omitempty"`
+
+	// The on-delete behaviour.
+	OnDelete OnDelete `json:"onDelete,omitempty"`
+
+	// The name of the inverse has-one or has-many relationship, if any.
+	Inverse string `json:"inverse,omitempty"`
+
+	// Whether the inverse relationship is a has-many relationship.
+	InverseMany bool `json:"inverseMany,omitempty"`
+}
+
+// BuildGraph will build a graph from the specified models. Relationships to
+// models that are not part of the list are omitted.
+func BuildGraph(models ...Model) *Graph {
+	// prepare catalog
+	catalog := make(map[string]*Meta)
+	for _, model := range models {
+		meta := GetMeta(model)
+		catalog[meta.PluralName] = meta
+	}
+
+	// get a sorted list of model names
+	names := make([]string, 0, len(catalog))
+	for name := range catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// prepare graph
+	graph := &Graph{
+		Models:        []GraphModel{},
+		Relationships: []GraphRelationship{},
+	}
+
+	// add models
+	for _, name := range names {
+		// get meta
+		meta := catalog[name]
+
+		// prepare model
+		model := GraphModel{
+			Name:       meta.Name,
+			Package:    meta.Type.PkgPath(),
+			PluralName: meta.PluralName,
+			Collection: meta.Collection,
+			Fields:     []GraphField{},
+		}
+
+		// add fields
+		for _, field := range meta.OrderedFields {
+			// get relationship type
+			relType := field.RelType
+			if field.PolyToOne || field.PolyToMany {
+				relType = strings.Join(field.RelTypes, "|")
+			}
+
+			// add field
+			model.Fields = append(model.Fields, GraphField{
+				Name:     field.Name,
+				Type:     strings.ReplaceAll(field.Type.String(), "primitive.ObjectID", "coal.ID"),
+				JSONKey:  field.JSONKey,
+				BSONKey:  field.BSONKey,
+				Optional: field.Optional,
+				RelName:  field.RelName,
+				RelType:  relType,
+				Virtual:  field.HasOne || field.HasMany,
+			})
+		}
+
+		// add indexes
+		for _, index := range meta.Indexes {
+			model.Indexes = append(model.Indexes, GraphIndex{
+				Fields:  index.Fields,
+				Unique:  index.Unique,
+				Expiry:  index.Expiry,
+				Partial: index.Filter != nil,
+			})
+		}
+
+		// add model
+		graph.Models = append(graph.Models, model)
+	}
+
+	// add relationships
+	for _, name := range names {
+		for _, field := range catalog[name].OrderedFields {
+			// get related types
+			var relTypes []string
+			if field.ToOne || field.ToMany {
+				relTypes = []string{field.RelType}
+			} else if field.PolyToOne || field.PolyToMany {
+				relTypes = field.RelTypes
+			}
+
+			// add relationships
+			for _, relType := range relTypes {
+				// check type
+				if catalog[relType] == nil {
+					continue
+				}
+
+				// prepare relationship
+				rel := GraphRelationship{
+					From:     name,
+					To:       relType,
+					Name:     field.RelName,
+					Field:    field.Name,
+					Optional: field.Optional,
+					Many:     field.ToMany || field.PolyToMany,
+					OnDelete: field.RelOnDelete,
+				}
+
+				// find inverse
+				for _, inverse := range catalog[relType].OrderedFields {
+					if (inverse.HasOne || inverse.HasMany) && inverse.RelType == name && inverse.RelInverse == field.RelName {
+						rel.Inverse = inverse.RelName
+						rel.InverseMany = inverse.HasMany
+					}
+				}
+
+				// add relationship
+				graph.Relationships = append(graph.Relationships, rel)
+			}
+		}
+	}
+
+	// sort relationships
+	sort.Slice(graph.Relationships, func(i, j int) bool {
+		a, b := graph.Relationships[i], graph.Relationships[j]
+		return a.From+"-"+a.Name < b.From+"-"+b.Name
+	})
+
+	return graph
+}
+
+// Filter will return a new graph with the models that match the provided
+// predicate. Relationships between removed models are omitted.
+func (g *Graph) Filter(fn func(GraphModel) bool) *Graph {
+	// prepare graph
+	graph := &Graph{
+		Models:        []GraphModel{},
+		Relationships: []GraphRelationship{},
+	}
+
+	// filter models
+	for _, model := range g.Models {
+		if fn(model) {
+			graph.Models = append(graph.Models, model)
+		}
+	}
+
+	// filter relationships
+	for _, rel := range g.Relationships {
+		if graph.lookup(rel.From) != nil && graph.lookup(rel.To) != nil {
+			graph.Relationships = append(graph.Relationships, rel)
+		}
+	}
+
+	return graph
+}
+
+// Group will split the graph into sub graphs per package. Relationships
+// across packages are omitted.
+func (g *Graph) Group() map[string]*Graph {
+	// group models
+	groups := map[string]*Graph{}
+	for _, model := range g.Models {
+		if groups[model.Package] == nil {
+			pkg := model.Package
+			groups[pkg] = g.Filter(func(model GraphModel) bool {
+				return model.Package == pkg
+			})
+		}
+	}
+
+	return groups
+}
+
+// ByPackage returns a graph filter that matches models with one of the
+// specified package paths.
+func ByPackage(packages ...string) func(GraphModel) bool {
+	return func(model GraphModel) bool {
+		for _, pkg := range packages {
+			if model.Package == pkg {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ByName returns a graph filter that matches models whose Go or plural name
+// matches one of the specified patterns. Patterns use the path.Match syntax.
+func ByName(patterns ...string) func(GraphModel) bool {
+	return func(model GraphModel) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, model.Name); ok {
+				return true
+			}
+			if ok, _ := path.Match(pattern, model.PluralName); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// JSON will return the graph as an indented JSON document.
+func (g *Graph) JSON() ([]byte, error) {
+	// encode graph
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	return data, nil
+}
+
+var mermaidInvalid = regexp.MustCompile(`[^A-Za-z0-9_\-]`)
+
+// Mermaid will return the graph as a Mermaid entity relationship diagram.
+// Virtual fields are omitted and relationships without an inverse are drawn
+// as non-identifying (dotted) relationships.
+func (g *Graph) Mermaid(title string) string {
+	// prepare buffer
+	var out bytes.Buffer
+
+	// write title
+	if title != "" {
+		out.WriteString("---\n")
+		out.WriteString("title: " + title + "\n")
+		out.WriteString("---\n")
+	}
+
+	// start diagram
+	out.WriteString("erDiagram\n")
+
+	// add entities
+	for _, model := range g.Models {
+		// write begin of entity
+		out.WriteString(fmt.Sprintf("  %s {\n", mermaidName(model.Name)))
+
+		// write id
+		out.WriteString("    coal_ID _id PK\n")
+
+		// write fields
+		for _, field := range model.Fields {
+			// skip virtual fields
+			if field.Virtual {
+				continue
+			}
+
+			// get key
+			key := ""
+			if field.RelType != "" {
+				key = " FK"
+			}
+
+			// write field
+			out.WriteString(fmt.Sprintf("    %s %s%s\n", mermaidType(field.Type), field.Name, key))
+		}
+
+		// write end of entity
+		out.WriteString("  }\n")
+	}
+
+	// add relationships
+	for _, rel := range g.Relationships {
+		// get cardinality of owning side
+		left := "}o"
+		if rel.Inverse != "" && !rel.InverseMany && !rel.Many {
+			left = "|o"
+		}
+
+		// get cardinality of related side
+		right := "||"
+		if rel.Many {
+			right = "o{"
+		} else if rel.Optional {
+			right = "o|"
+		}
+
+		// get line
+		line := "--"
+		if rel.Inverse == "" {
+			line = ".."
+		}
+
+		// write relationship
+		out.WriteString(fmt.Sprintf("  %s %s%s%s %s : %s\n", mermaidName(g.lookup(rel.From).Name), left, line, right, mermaidName(g.lookup(rel.To).Name), rel.Name))
+	}
+
+	return out.String()
+}
+
+func (g *Graph) lookup(pluralName string) *GraphModel {
+	// find model
+	for i, model := range g.Models {
+		if model.PluralName == pluralName {
+			return &g.Models[i]
+		}
+	}
+
+	return nil
+}
+
+func mermaidName(name string) string {
+	return mermaidInvalid.ReplaceAllString(name, "_")
+}
+
+func mermaidType(typ string) string {
+	// strip pointers and slices
+	typ = strings.TrimLeft(typ, "*")
+	slice := strings.HasPrefix(typ, "[]")
+	typ = strings.TrimLeft(typ, "[]*")
+
+	// sanitize name
+	typ = strings.Trim(mermaidInvalid.ReplaceAllString(typ, "_"), "_")
+	if slice {
+		typ += "[]"
+	}
+
+	return typ
+}
@@ -0,0 +1,102 @@
+package coal
+
+import (
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BeforeInsertHook may be implemented by models to prepare the model before it
+// is validated and inserted by Manager.Insert, InsertAll and InsertIfMissing.
+type BeforeInsertHook interface {
+	BeforeInsert() error
+}
+
+// BeforeReplaceHook may be implemented by models to prepare the model before it
+// is validated and replaced by Manager.Replace, ReplaceFirst and
+// CompareAndReplace.
+type BeforeReplaceHook interface {
+	BeforeReplace() error
+}
+
+// BeforeUpdateHook may be implemented by models to inspect or amend the
+// untranslated update document before it is applied by Manager.Update,
+// UpdateFirst, UpdateAll, Upsert and CompareAndUpdate. The hook is invoked on
+// a zero value of the model.
+type BeforeUpdateHook interface {
+	BeforeUpdate(update bson.M) error
+}
+
+// AfterLoadHook may be implemented by models to prepare the model after it has
+// been loaded and before it is validated by the Manager find methods and the
+// update methods that return the document.
+type AfterLoadHook interface {
+	AfterLoad() error
+}
+
+func beforeInsert(model Model, flags Flags) error {
+	// check flags
+	if flags.Has(NoHooks) {
+		return nil
+	}
+
+	// run hook
+	if hook, ok := model.(BeforeInsertHook); ok {
+		err := hook.BeforeInsert()
+		if err != nil {
+			return xo.W(err)
+		}
+	}
+
+	return nil
+}
+
+func beforeReplace(model Model, flags Flags) error {
+	// check flags
+	if flags.Has(NoHooks) {
+		return nil
+	}
+
+	// run hook
+	if hook, ok := model.(BeforeReplaceHook); ok {
+		err := hook.BeforeReplace()
+		if err != nil {
+			return xo.W(err)
+		}
+	}
+
+	return nil
+}
+
+func beforeUpdate(meta *Meta, update bson.M, flags Flags) error {
+	// check flags
+	if flags.Has(NoHooks) {
+		return nil
+	}
+
+	// run hook
+	if hook, ok := meta.Make().(BeforeUpdateHook); ok {
+		err := hook.BeforeUpdate(update)
+		if err != nil {
+			return xo.W(err)
+		}
+	}
+
+	return nil
+}
+
+func afterLoad(model Model, flags Flags) error {
+	// check flags
+	if flags.Has(NoHooks) {
+		return nil
+	}
+
+	// run hook
+	if hook, ok := model.(AfterLoadHook); ok {
+		err := hook.AfterLoad()
+		if err != nil {
+			return xo.W(err)
+		}
+	}
+
+	return nil
+}
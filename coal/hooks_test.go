@@ -0,0 +1,131 @@
+package coal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/256dpi/xo"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type hookModel struct {
+	Base   `json:"-" bson:",inline" coal:"hooks"`
+	Email  string
+	Domain string `bson:"-"`
+	Saves  int
+}
+
+func (m *hookModel) BeforeInsert() error {
+	return m.normalize()
+}
+
+func (m *hookModel) BeforeReplace() error {
+	return m.normalize()
+}
+
+func (m *hookModel) BeforeUpdate(update bson.M) error {
+	if set, ok := update["$set"].(bson.M); ok {
+		if email, ok := set["Email"].(string); ok {
+			set["Email"] = strings.ToLower(email)
+		}
+	}
+	return nil
+}
+
+func (m *hookModel) AfterLoad() error {
+	if i := strings.Index(m.Email, "@"); i >= 0 {
+		m.Domain = m.Email[i+1:]
+	}
+	return nil
+}
+
+func (m *hookModel) Validate() error {
+	if m.Email == "" {
+		return xo.SF("missing email")
+	}
+	return nil
+}
+
+func (m *hookModel) normalize() error {
+	m.Email = strings.ToLower(m.Email)
+	m.Saves++
+	return nil
+}
+
+func TestManagerHooks(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		m := tester.Store.M(&hookModel{})
+
+		/* insert */
+
+		model := &hookModel{Email: "Foo@Example.COM"}
+		err := m.Insert(nil, model)
+		assert.NoError(t, err)
+		assert.Equal(t, "foo@example.com", model.Email)
+		assert.Equal(t, 1, model.Saves)
+
+		/* find */
+
+		var found hookModel
+		ok, err := m.Find(nil, &found, model.ID(), false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "example.com", found.Domain)
+
+		var list []*hookModel
+		err = m.FindAll(nil, &list, nil, nil, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+		assert.Equal(t, "example.com", list[0].Domain)
+
+		iter, err := m.FindEach(nil, nil, nil, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.True(t, iter.Next())
+		var each hookModel
+		assert.NoError(t, iter.Decode(&each))
+		assert.Equal(t, "example.com", each.Domain)
+		iter.Close()
+
+		/* replace */
+
+		found.Email = "Bar@Example.COM"
+		ok, err = m.Replace(nil, &found, false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "bar@example.com", found.Email)
+		assert.Equal(t, 2, found.Saves)
+
+		/* update */
+
+		var updated hookModel
+		ok, err = m.Update(nil, &updated, model.ID(), bson.M{
+			"$set": bson.M{
+				"Email": "Baz@Example.ORG",
+			},
+		}, false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "baz@example.org", updated.Email)
+		assert.Equal(t, "example.org", updated.Domain)
+
+		/* skip hooks */
+
+		var raw hookModel
+		ok, err = m.Update(nil, &raw, model.ID(), bson.M{
+			"$set": bson.M{
+				"Email": "Qux@Example.ORG",
+			},
+		}, false, NoHooks)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "Qux@Example.ORG", raw.Email)
+		assert.Empty(t, raw.Domain)
+
+		other := &hookModel{Email: "Quz@Example.COM"}
+		err = m.Insert(nil, other, NoHooks)
+		assert.NoError(t, err)
+		assert.Equal(t, "Quz@Example.COM", other.Email)
+		assert.Equal(t, 0, other.Saves)
+	})
+}
@@ -0,0 +1,304 @@
+package coal
+
+import (
+	"sync"
+
+	"github.com/256dpi/xo"
+)
+
+// ErrSlowConsumer is yielded to subscribers that have been disconnected
+// because they did not keep up with the events of a hub.
+var ErrSlowConsumer = xo.BF("slow consumer")
+
+// Policy defines how a hub handles subscribers with a full buffer.
+type Policy int
+
+const (
+	// Block will wait until the subscriber has buffer space available. This
+	// delays the delivery of events to all subscribers of the same model.
+	Block Policy = iota
+
+	// Drop will drop events that do not fit into the buffer.
+	Drop
+
+	// Disconnect will close the subscription and yield ErrSlowConsumer.
+	Disconnect
+)
+
+// SubscriptionOptions defines options for Hub.Subscribe.
+type SubscriptionOptions struct {
+	// The number of buffered events.
+	//
+	// Default: 100.
+	Buffer int
+
+	// The policy applied when the buffer is full. Opened, resumed and errored
+	// events are always delivered.
+	Policy Policy
+
+	// The filter used to select created, updated and deleted events.
+	Filter func(event Event, id ID, model Model) bool
+}
+
+// Hub multiplexes a single stream per model to many subscribers. Streams are
+// opened on the first subscription and closed when the last subscription of a
+// model has been closed.
+type Hub struct {
+	store   *Store
+	streams map[string]*hubStream
+	mutex   sync.Mutex
+}
+
+type hubStream struct {
+	stream *Stream
+	subs   map[*Subscription]bool
+	opened bool
+}
+
+type hubEvent struct {
+	event Event
+	id    ID
+	model Model
+	err   error
+	token []byte
+}
+
+// NewHub will create and return a new hub.
+func NewHub(store *Store) *Hub {
+	return &Hub{
+		store:   store,
+		streams: map[string]*hubStream{},
+	}
+}
+
+// Subscribe will subscribe to the events of the specified model. The receiver
+// is called from a separate goroutine per subscription and receives an opened
+// event once the shared stream is available. Models yielded to the receiver
+// are shared between subscribers and must not be modified.
+//
+// The subscription is closed when the receiver returns ErrStop. Other errors
+// returned by the receiver are yielded back as errored events.
+func (h *Hub) Subscribe(model Model, opts SubscriptionOptions, receiver Receiver) *Subscription {
+	// set default buffer
+	if opts.Buffer <= 0 {
+		opts.Buffer = 100
+	}
+
+	// get name
+	name := GetMeta(model).PluralName
+
+	// prepare subscription
+	sub := &Subscription{
+		hub:      h,
+		name:     name,
+		opts:     opts,
+		receiver: receiver,
+		queue:    make(chan hubEvent, opts.Buffer),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	// acquire mutex
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// get stream
+	hs := h.streams[name]
+	if hs == nil {
+		hs = &hubStream{
+			subs: map[*Subscription]bool{},
+		}
+		h.streams[name] = hs
+		hs.stream = OpenStream(h.store, model, nil, func(event Event, id ID, model Model, err error, token []byte) error {
+			h.dispatch(hs, hubEvent{
+				event: event,
+				id:    id,
+				model: model,
+				err:   err,
+				token: token,
+			})
+			return nil
+		})
+	}
+
+	// add subscription
+	hs.subs[sub] = true
+
+	// queue opened event if already opened
+	if hs.opened {
+		sub.queue <- hubEvent{event: Opened}
+	}
+
+	// run subscription
+	go sub.run()
+
+	return sub
+}
+
+// Close will close all subscriptions and streams.
+func (h *Hub) Close() {
+	// collect subscriptions
+	h.mutex.Lock()
+	var subs []*Subscription
+	for _, hs := range h.streams {
+		for sub := range hs.subs {
+			subs = append(subs, sub)
+		}
+	}
+	h.mutex.Unlock()
+
+	// close subscriptions
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+func (h *Hub) dispatch(hs *hubStream, evt hubEvent) {
+	// ignore stopped events
+	if evt.event == Stopped {
+		return
+	}
+
+	// get subscriptions
+	h.mutex.Lock()
+	if evt.event == Opened {
+		hs.opened = true
+	}
+	subs := make([]*Subscription, 0, len(hs.subs))
+	for sub := range hs.subs {
+		subs = append(subs, sub)
+	}
+	h.mutex.Unlock()
+
+	// deliver event
+	for _, sub := range subs {
+		sub.deliver(evt)
+	}
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	// acquire mutex
+	h.mutex.Lock()
+
+	// get stream
+	hs := h.streams[sub.name]
+	if hs == nil || !hs.subs[sub] {
+		h.mutex.Unlock()
+		return
+	}
+
+	// remove subscription
+	delete(hs.subs, sub)
+
+	// keep stream if still used
+	if len(hs.subs) > 0 {
+		h.mutex.Unlock()
+		return
+	}
+
+	// remove stream
+	delete(h.streams, sub.name)
+	h.mutex.Unlock()
+
+	// close stream
+	hs.stream.Close()
+}
+
+// Subscription is a single subscription to a hub.
+type Subscription struct {
+	hub      *Hub
+	name     string
+	opts     SubscriptionOptions
+	receiver Receiver
+	queue    chan hubEvent
+	closing  chan struct{}
+	done     chan struct{}
+	reason   error
+	once     sync.Once
+}
+
+// Close will close the subscription.
+func (s *Subscription) Close() {
+	// stop and wait
+	s.stop(nil)
+	<-s.done
+}
+
+func (s *Subscription) stop(reason error) {
+	s.once.Do(func() {
+		s.reason = reason
+		close(s.closing)
+	})
+}
+
+func (s *Subscription) deliver(evt hubEvent) {
+	// apply filter
+	control := evt.event == Opened || evt.event == Resumed || evt.event == Errored
+	if !control && s.opts.Filter != nil && !s.opts.Filter(evt.event, evt.id, evt.model) {
+		return
+	}
+
+	// try to queue event
+	select {
+	case s.queue <- evt:
+		return
+	case <-s.closing:
+		return
+	default:
+	}
+
+	// apply policy
+	if !control && s.opts.Policy == Drop {
+		return
+	} else if !control && s.opts.Policy == Disconnect {
+		s.stop(ErrSlowConsumer.Wrap())
+		return
+	}
+
+	// wait for buffer space
+	select {
+	case s.queue <- evt:
+	case <-s.closing:
+	}
+}
+
+func (s *Subscription) run() {
+	// ensure done
+	defer close(s.done)
+
+	for {
+		// check closing
+		select {
+		case <-s.closing:
+			// yield reason
+			if s.reason != nil {
+				_ = s.receiver(Errored, ID{}, nil, s.reason, nil)
+			}
+
+			// signal stopped
+			_ = s.receiver(Stopped, ID{}, nil, nil, nil)
+
+			// remove subscription
+			s.hub.remove(s)
+
+			return
+		default:
+		}
+
+		// await event
+		select {
+		case evt := <-s.queue:
+			// call receiver
+			err := s.receiver(evt.event, evt.id, evt.model, evt.err, evt.token)
+			if ErrStop.Is(err) {
+				s.stop(nil)
+			} else if err != nil {
+				err = s.receiver(Errored, ID{}, nil, err, evt.token)
+				if ErrStop.Is(err) {
+					s.stop(nil)
+				}
+			}
+		case <-s.closing:
+		}
+	}
+}
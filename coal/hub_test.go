@@ -0,0 +1,196 @@
+package coal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(10 * time.Millisecond)
+
+		hub := NewHub(tester.Store)
+
+		open1 := make(chan struct{})
+		done1 := make(chan struct{})
+		var events1 []Event
+
+		sub1 := hub.Subscribe(&postModel{}, SubscriptionOptions{}, func(e Event, id ID, model Model, err error, token []byte) error {
+			events1 = append(events1, e)
+			switch e {
+			case Opened:
+				close(open1)
+			case Deleted:
+				return ErrStop.Wrap()
+			case Stopped:
+				close(done1)
+			case Errored:
+				panic(err)
+			}
+			return nil
+		})
+
+		<-open1
+
+		open2 := make(chan struct{})
+		done2 := make(chan struct{})
+		var titles []string
+
+		sub2 := hub.Subscribe(&postModel{}, SubscriptionOptions{
+			Filter: func(e Event, id ID, model Model) bool {
+				return e == Created && model.(*postModel).Title == "foo"
+			},
+		}, func(e Event, id ID, model Model, err error, token []byte) error {
+			switch e {
+			case Opened:
+				close(open2)
+			case Created:
+				titles = append(titles, model.(*postModel).Title)
+			case Stopped:
+				close(done2)
+			case Errored:
+				panic(err)
+			}
+			return nil
+		})
+
+		<-open2
+
+		assert.Len(t, hub.streams, 1)
+
+		tester.Insert(&postModel{Title: "bar"})
+		post := tester.Insert(&postModel{Title: "foo"}).(*postModel)
+		tester.Delete(post)
+
+		<-done1
+		sub1.Close()
+
+		assert.Equal(t, []Event{Opened, Created, Created, Deleted, Stopped}, events1)
+
+		sub2.Close()
+		<-done2
+
+		assert.Equal(t, []string{"foo"}, titles)
+		assert.Empty(t, hub.streams)
+
+		hub.Close()
+	})
+}
+
+func TestHubPolicies(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(10 * time.Millisecond)
+
+		hub := NewHub(tester.Store)
+
+		open := make(chan struct{}, 3)
+		started := make(chan struct{}, 2)
+		handled := make(chan struct{}, 10)
+		dispatched := make(chan struct{}, 3)
+		release := make(chan struct{})
+		done := make(chan struct{})
+
+		// the sentinel "4" is never delivered, seeing it in the filter
+		// guarantees that "3" has been dispatched to the subscription
+		filter := func(e Event, id ID, model Model) bool {
+			if model.(*postModel).Title == "4" {
+				dispatched <- struct{}{}
+				return false
+			}
+			return true
+		}
+
+		slow := func(e Event, id ID, model Model, err error, token []byte) error {
+			switch e {
+			case Opened:
+				open <- struct{}{}
+			case Created:
+				if model.(*postModel).Title == "1" {
+					started <- struct{}{}
+				}
+				<-release
+				handled <- struct{}{}
+			}
+			return nil
+		}
+
+		var blocked int
+		sub1 := hub.Subscribe(&postModel{}, SubscriptionOptions{
+			Buffer: 1,
+			Policy: Block,
+			Filter: filter,
+		}, func(e Event, id ID, model Model, err error, token []byte) error {
+			if e == Opened {
+				open <- struct{}{}
+			} else if e == Created {
+				blocked++
+				if blocked == 3 {
+					close(done)
+				}
+			}
+			return nil
+		})
+
+		var dropped []string
+		sub2 := hub.Subscribe(&postModel{}, SubscriptionOptions{
+			Buffer: 1,
+			Policy: Drop,
+			Filter: filter,
+		}, func(e Event, id ID, model Model, err error, token []byte) error {
+			if e == Created {
+				dropped = append(dropped, model.(*postModel).Title)
+			}
+			return slow(e, id, model, err, token)
+		})
+
+		var disconnected error
+		stopped := make(chan struct{})
+		sub3 := hub.Subscribe(&postModel{}, SubscriptionOptions{
+			Buffer: 1,
+			Policy: Disconnect,
+			Filter: filter,
+		}, func(e Event, id ID, model Model, err error, token []byte) error {
+			if e == Errored {
+				disconnected = err
+			} else if e == Stopped {
+				close(stopped)
+			}
+			return slow(e, id, model, err, token)
+		})
+
+		<-open
+		<-open
+		<-open
+
+		tester.Insert(&postModel{Title: "1"})
+
+		<-started
+		<-started
+
+		tester.Insert(&postModel{Title: "2"})
+		tester.Insert(&postModel{Title: "3"})
+		tester.Insert(&postModel{Title: "4"})
+
+		<-dispatched
+		<-dispatched
+		<-dispatched
+		<-done
+		close(release)
+
+		<-handled
+		<-handled
+		<-handled
+		<-stopped
+
+		sub1.Close()
+		sub2.Close()
+		sub3.Close()
+
+		assert.Equal(t, 3, blocked)
+		assert.Equal(t, []string{"1", "2"}, dropped)
+		assert.True(t, ErrSlowConsumer.Is(disconnected))
+		assert.Empty(t, hub.streams)
+	})
+}
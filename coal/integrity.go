@@ -0,0 +1,281 @@
+package coal
+
+import (
+	"context"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// DanglingReference describes a (polymorphic) to-one or to-many reference to a
+// document that does not exist.
+type DanglingReference struct {
+	// The plural name of the referencing model.
+	Model string
+
+	// The id of the referencing document.
+	ID ID
+
+	// The relationship struct field.
+	Field string
+
+	// The plural name of the referenced model.
+	RelType string
+
+	// The missing referenced document.
+	Reference ID
+
+	// Whether the reference has been repaired.
+	Repaired bool
+}
+
+// ScanOptions defines options for ScanReferences.
+type ScanOptions struct {
+	// The flag used to detect soft delete fields. Soft deleted documents are
+	// not scanned.
+	SoftDeleteFlag string
+
+	// Whether references to soft deleted documents are considered dangling.
+	Strict bool
+
+	// Whether dangling references should be repaired. Optional (polymorphic)
+	// to-one references are unset and (polymorphic) to-many references are
+	// removed. Required to-one references cannot be repaired and are only
+	// reported. Each document is repaired in a separate transaction.
+	Repair bool
+}
+
+// ScanReferences will check the to-one and to-many relationships of the
+// specified documents against the referenced collections of the models in the
+// registry and return all dangling references. Polymorphic references are
+// checked against the collection of their type. References to models that are
+// not part of the registry are ignored.
+func ScanReferences(ctx context.Context, store *Store, registry *Registry, model Model, ids []ID, opts ScanOptions) ([]DanglingReference, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/ScanReferences")
+	defer span.End()
+
+	// get meta
+	meta := GetMeta(model)
+
+	// prepare filter
+	filter := bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+	}
+
+	// exclude soft deleted documents
+	if opts.SoftDeleteFlag != "" {
+		if field := L(model, opts.SoftDeleteFlag, false); field != "" {
+			filter[field] = nil
+		}
+	}
+
+	// find documents
+	iter, err := store.M(model).FindEach(ctx, filter, nil, 0, 0, false, NoTransaction, NoValidation, NoHooks)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode documents
+	var list []Model
+	defer iter.Close()
+	for iter.Next() {
+		doc := meta.Make()
+		err = iter.Decode(doc)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, doc)
+	}
+
+	// check error
+	err = iter.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	// check relationships
+	var result []DanglingReference
+	for _, field := range meta.OrderedFields {
+		// skip non relationship fields
+		if !field.ToOne && !field.ToMany && !field.PolyToOne && !field.PolyToMany {
+			continue
+		}
+
+		// collect references by type
+		refs := map[string][]ID{}
+		for _, doc := range list {
+			for _, ref := range references(doc, field) {
+				refs[ref.Type] = append(refs[ref.Type], ref.ID)
+			}
+		}
+
+		// find existing references
+		checked := map[string]bool{}
+		existing := map[Ref]bool{}
+		for relType, ids := range refs {
+			// get related model
+			related := registry.Lookup(relType)
+			if related == nil {
+				continue
+			}
+
+			// find existing ids
+			ids, err := existingIDs(ctx, store, related, ids, opts)
+			if err != nil {
+				return nil, err
+			}
+
+			// add references
+			checked[relType] = true
+			for id := range ids {
+				existing[Ref{Type: relType, ID: id}] = true
+			}
+		}
+		if len(checked) == 0 {
+			continue
+		}
+
+		// check documents
+		for _, doc := range list {
+			// collect missing references
+			var missing []Ref
+			var remaining []Ref
+			for _, ref := range references(doc, field) {
+				if !checked[ref.Type] || existing[ref] {
+					remaining = append(remaining, ref)
+				} else {
+					missing = append(missing, ref)
+				}
+			}
+			if len(missing) == 0 {
+				continue
+			}
+
+			// repair document
+			repaired := false
+			if opts.Repair && (field.ToMany || field.PolyToMany || field.Optional) {
+				// prepare value
+				var value interface{}
+				if field.ToMany {
+					ids := make([]ID, 0, len(remaining))
+					for _, ref := range remaining {
+						ids = append(ids, ref.ID)
+					}
+					value = ids
+				} else if field.PolyToMany {
+					if remaining == nil {
+						remaining = []Ref{}
+					}
+					value = remaining
+				}
+
+				// update document
+				err = store.S(model).T(ctx, false, func(ctx context.Context) error {
+					_, err := store.M(model).Update(ctx, nil, doc.ID(), bson.M{
+						"$set": bson.M{
+							field.Name: value,
+						},
+					}, false)
+					return err
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				// set flag
+				repaired = true
+			}
+
+			// add references
+			for _, ref := range missing {
+				result = append(result, DanglingReference{
+					Model:     meta.PluralName,
+					ID:        doc.ID(),
+					Field:     field.Name,
+					RelType:   ref.Type,
+					Reference: ref.ID,
+					Repaired:  repaired,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func references(model Model, field *Field) []Ref {
+	// get references
+	switch ref := stick.MustGet(model, field.Name).(type) {
+	case ID:
+		if !ref.IsZero() {
+			return []Ref{{Type: field.RelType, ID: ref}}
+		}
+	case *ID:
+		if ref != nil && !ref.IsZero() {
+			return []Ref{{Type: field.RelType, ID: *ref}}
+		}
+	case []ID:
+		refs := make([]Ref, 0, len(ref))
+		for _, id := range ref {
+			refs = append(refs, Ref{Type: field.RelType, ID: id})
+		}
+		return refs
+	case Ref:
+		if !ref.IsZero() {
+			return []Ref{ref}
+		}
+	case *Ref:
+		if ref != nil && !ref.IsZero() {
+			return []Ref{*ref}
+		}
+	case []Ref:
+		return ref
+	}
+
+	return nil
+}
+
+func existingIDs(ctx context.Context, store *Store, model Model, ids []ID, opts ScanOptions) (map[ID]bool, error) {
+	// prepare filter
+	filter := bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+	}
+
+	// exclude soft deleted documents
+	if opts.Strict && opts.SoftDeleteFlag != "" {
+		if field := L(model, opts.SoftDeleteFlag, false); field != "" {
+			filter[GetMeta(model).Fields[field].BSONKey] = nil
+		}
+	}
+
+	// find documents
+	iter, err := store.C(model).Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	// decode documents
+	var docs []struct {
+		ID ID `bson:"_id"`
+	}
+	err = iter.All(&docs)
+	if err != nil {
+		return nil, err
+	}
+
+	// collect ids
+	existing := make(map[ID]bool, len(docs))
+	for _, doc := range docs {
+		existing[doc.ID] = true
+	}
+
+	return existing, nil
+}
@@ -0,0 +1,142 @@
+package coal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/256dpi/fire/stick"
+)
+
+func TestScanReferences(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		registry := NewRegistry(&postModel{}, &commentModel{}, &selectionModel{}, &authorModel{}, &articleModel{}, &shelfModel{}, &bookModel{})
+
+		post := tester.Insert(&postModel{Title: "Hello"}).(*postModel)
+		missing1 := New()
+		missing2 := New()
+
+		comment1 := tester.Insert(&commentModel{Post: post.ID(), Parent: &missing1}).(*commentModel)
+		comment2 := tester.Insert(&commentModel{Post: missing2}).(*commentModel)
+		selection := tester.Insert(&selectionModel{Posts: []ID{post.ID(), missing2}}).(*selectionModel)
+
+		/* report */
+
+		refs, err := ScanReferences(nil, tester.Store, registry, &commentModel{}, []ID{comment1.ID(), comment2.ID()}, ScanOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []DanglingReference{
+			{
+				Model:     "comments",
+				ID:        comment2.ID(),
+				Field:     "Post",
+				RelType:   "posts",
+				Reference: missing2,
+			},
+			{
+				Model:     "comments",
+				ID:        comment1.ID(),
+				Field:     "Parent",
+				RelType:   "comments",
+				Reference: missing1,
+			},
+		}, refs)
+
+		refs, err = ScanReferences(nil, tester.Store, registry, &selectionModel{}, []ID{selection.ID()}, ScanOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []DanglingReference{
+			{
+				Model:     "selections",
+				ID:        selection.ID(),
+				Field:     "Posts",
+				RelType:   "posts",
+				Reference: missing2,
+			},
+		}, refs)
+
+		/* repair */
+
+		refs, err = ScanReferences(nil, tester.Store, registry, &commentModel{}, []ID{comment1.ID(), comment2.ID()}, ScanOptions{
+			Repair: true,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, refs, 2)
+		assert.False(t, refs[0].Repaired)
+		assert.True(t, refs[1].Repaired)
+		assert.Nil(t, tester.Fetch(&commentModel{}, comment1.ID()).(*commentModel).Parent)
+		assert.Equal(t, missing2, tester.Fetch(&commentModel{}, comment2.ID()).(*commentModel).Post)
+
+		refs, err = ScanReferences(nil, tester.Store, registry, &selectionModel{}, []ID{selection.ID()}, ScanOptions{
+			Repair: true,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, refs, 1)
+		assert.True(t, refs[0].Repaired)
+		assert.Equal(t, []ID{post.ID()}, tester.Fetch(&selectionModel{}, selection.ID()).(*selectionModel).Posts)
+
+		/* polymorphic */
+
+		ref := tester.Insert(&refModel{
+			Subject: Ref{Type: "posts", ID: missing1},
+			Targets: []Ref{
+				{Type: "posts", ID: post.ID()},
+				{Type: "posts", ID: missing2},
+				{Type: "notes", ID: missing2},
+			},
+		}).(*refModel)
+
+		refs, err = ScanReferences(nil, tester.Store, registry, &refModel{}, []ID{ref.ID()}, ScanOptions{
+			Repair: true,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []DanglingReference{
+			{
+				Model:     "refs",
+				ID:        ref.ID(),
+				Field:     "Subject",
+				RelType:   "posts",
+				Reference: missing1,
+			},
+			{
+				Model:     "refs",
+				ID:        ref.ID(),
+				Field:     "Targets",
+				RelType:   "posts",
+				Reference: missing2,
+				Repaired:  true,
+			},
+		}, refs)
+		assert.Equal(t, []Ref{
+			{Type: "posts", ID: post.ID()},
+			{Type: "notes", ID: missing2},
+		}, tester.Fetch(&refModel{}, ref.ID()).(*refModel).Targets)
+
+		/* counted */
+
+		book1 := tester.Insert(&bookModel{Title: "A", Shelf: &missing1}).(*bookModel)
+
+		refs, err = ScanReferences(nil, tester.Store, registry, &bookModel{}, []ID{book1.ID()}, ScanOptions{
+			Repair: true,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, refs, 1)
+		assert.True(t, refs[0].Repaired)
+		assert.Nil(t, tester.Fetch(&bookModel{}, book1.ID()).(*bookModel).Shelf)
+
+		/* soft delete */
+
+		book := &bookModel{Base: B(), Shelf: &missing1, Deleted: stick.P(time.Now())}
+		_, err = tester.Store.C(book).InsertOne(nil, book)
+		assert.NoError(t, err)
+
+		refs, err = ScanReferences(nil, tester.Store, registry, &bookModel{}, []ID{book.ID()}, ScanOptions{})
+		assert.NoError(t, err)
+		assert.Len(t, refs, 1)
+
+		refs, err = ScanReferences(nil, tester.Store, registry, &bookModel{}, []ID{book.ID()}, ScanOptions{
+			SoftDeleteFlag: "soft-delete",
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, refs)
+	})
+}
@@ -26,6 +26,9 @@ const (
 	// TextScoreSort will prepend the sort with a sort based on the text score
 	// of documents. The Base.Score attribute is set to the respective score.
 	TextScoreSort
+
+	// NoHooks will skip the invocation of model lifecycle hooks.
+	NoHooks
 )
 
 // Has returns whether the receiver has set all provided flags.
@@ -50,6 +53,10 @@ var ErrTransactionRequired = xo.BF("operation requires a transaction")
 // that is manged by the manager.
 var ErrMetaMismatch = xo.BF("provided model does not match managed model")
 
+// ErrVersionConflict is returned if a compare-and-swap operation failed because
+// the stored version of the document did not match the expected version.
+var ErrVersionConflict = xo.BF("version conflict")
+
 var incrementLock = bson.M{
 	"$inc": bson.M{
 		"_lk": 1,
@@ -65,9 +72,11 @@ var returnAfterUpdate = options.FindOneAndUpdate().SetReturnDocument(options.Aft
 // Manager manages operations on collection of documents. It will validate
 // operations and ensure that they are safe under the MongoDB guarantees.
 type Manager struct {
-	meta  *Meta
-	coll  *Collection
-	trans *Translator
+	meta      *Meta
+	store     *Store
+	coll      *Collection
+	trans     *Translator
+	encrypted []*Field
 }
 
 // C is a shorthand to access the underlying collection.
@@ -124,6 +133,18 @@ func (m *Manager) Find(ctx context.Context, model Model, id ID, lock bool, flags
 		return false, err
 	}
 
+	// decrypt model
+	err = m.decryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
+	// run hook
+	err = afterLoad(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
 	// validate model
 	if !Merge(flags).Has(NoValidation) {
 		err = model.Validate()
@@ -170,7 +191,7 @@ func (m *Manager) FindFirst(ctx context.Context, model Model, filter bson.M, sor
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
 	if err != nil {
 		return false, err
 	}
@@ -213,6 +234,18 @@ func (m *Manager) FindFirst(ctx context.Context, model Model, filter bson.M, sor
 		return false, err
 	}
 
+	// decrypt model
+	err = m.decryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
+	// run hook
+	err = afterLoad(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
 	// validate model
 	if !Merge(flags).Has(NoValidation) {
 		err = model.Validate()
@@ -261,7 +294,7 @@ func (m *Manager) FindAll(ctx context.Context, list interface{}, filter bson.M,
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
 	if err != nil {
 		return err
 	}
@@ -322,6 +355,18 @@ func (m *Manager) FindAll(ctx context.Context, list interface{}, filter bson.M,
 		return err
 	}
 
+	// decrypt models and run hooks
+	for _, model := range Slice(list) {
+		err = m.decryptModel(model)
+		if err != nil {
+			return err
+		}
+		err = afterLoad(model, Merge(flags))
+		if err != nil {
+			return err
+		}
+	}
+
 	// validate models
 	if !Merge(flags).Has(NoValidation) {
 		for _, model := range Slice(list) {
@@ -366,7 +411,7 @@ func (m *Manager) FindEach(ctx context.Context, filter bson.M, sort []string, sk
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
 	if err != nil {
 		return nil, err
 	}
@@ -413,9 +458,10 @@ func (m *Manager) FindEach(ctx context.Context, filter bson.M, sort []string, sk
 	validate := !Merge(flags).Has(NoValidation)
 
 	return &ManagedIterator{
-		meta:     m.meta,
+		manager:  m,
 		iterator: iter,
 		validate: validate,
+		flags:    Merge(flags),
 	}, nil
 }
 
@@ -525,7 +571,7 @@ func (m *Manager) project(ctx context.Context, filter bson.M, field string, sort
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
 	if err != nil {
 		return err
 	}
@@ -588,8 +634,14 @@ func (m *Manager) project(ctx context.Context, filter bson.M, field string, sort
 			return err
 		}
 
+		// decrypt value
+		value, err := m.decryptValue(field, item[field])
+		if err != nil {
+			return err
+		}
+
 		// yield pair
-		if !fn(item["_id"].(ID), item[field]) {
+		if !fn(item["_id"].(ID), value) {
 			break
 		}
 	}
@@ -627,7 +679,7 @@ func (m *Manager) Count(ctx context.Context, filter bson.M, skip, limit int64, l
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
 	if err != nil {
 		return 0, err
 	}
@@ -689,7 +741,7 @@ func (m *Manager) Distinct(ctx context.Context, field string, filter bson.M, loc
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
 	if err != nil {
 		return nil, err
 	}
@@ -708,6 +760,14 @@ func (m *Manager) Distinct(ctx context.Context, field string, filter bson.M, loc
 		return nil, err
 	}
 
+	// decrypt values
+	for i, value := range result {
+		result[i], err = m.decryptValue(field, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
@@ -738,6 +798,11 @@ func (m *Manager) insert(ctx context.Context, models []Model, flags ...Flags) er
 		return nil
 	}
 
+	// require transaction
+	if m.counted() && !HasTransaction(ctx) {
+		return ErrTransactionRequired.Wrap()
+	}
+
 	// check models and ensure ids
 	for _, model := range models {
 		// check model
@@ -749,6 +814,30 @@ func (m *Manager) insert(ctx context.Context, models []Model, flags ...Flags) er
 		if model.ID().IsZero() {
 			model.GetBase().DocID = New()
 		}
+
+		// run hook
+		err := beforeInsert(model, Merge(flags))
+		if err != nil {
+			return err
+		}
+	}
+
+	// plant tree
+	err := m.plantTree(ctx, models)
+	if err != nil {
+		return err
+	}
+
+	// assign ranks
+	err = m.rankModels(ctx, models)
+	if err != nil {
+		return err
+	}
+
+	// denormalize models
+	err = m.denormalize(ctx, models)
+	if err != nil {
+		return err
 	}
 
 	// validate models
@@ -764,7 +853,11 @@ func (m *Manager) insert(ctx context.Context, models []Model, flags ...Flags) er
 	// get documents
 	docs := make([]interface{}, 0, len(models))
 	for _, model := range models {
-		docs = append(docs, model)
+		doc, err := m.encryptModel(model)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
 	}
 
 	// insert documents or document
@@ -780,6 +873,12 @@ func (m *Manager) insert(ctx context.Context, models []Model, flags ...Flags) er
 		}
 	}
 
+	// update counters
+	err = m.count(ctx, nil, models)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -800,12 +899,12 @@ func (m *Manager) InsertIfMissing(ctx context.Context, filter bson.M, model Mode
 	defer span.End()
 
 	// require transaction
-	if lock && !HasTransaction(ctx) {
+	if (lock || m.counted()) && !HasTransaction(ctx) {
 		return false, ErrTransactionRequired.Wrap()
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
 	if err != nil {
 		return false, err
 	}
@@ -820,6 +919,30 @@ func (m *Manager) InsertIfMissing(ctx context.Context, filter bson.M, model Mode
 		model.GetBase().DocID = New()
 	}
 
+	// run hook
+	err = beforeInsert(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
+	// plant tree
+	err = m.plantTree(ctx, []Model{model})
+	if err != nil {
+		return false, err
+	}
+
+	// assign ranks
+	err = m.rankModels(ctx, []Model{model})
+	if err != nil {
+		return false, err
+	}
+
+	// denormalize model
+	err = m.denormalize(ctx, []Model{model})
+	if err != nil {
+		return false, err
+	}
+
 	// validate model
 	if !Merge(flags).Has(NoValidation) {
 		err = model.Validate()
@@ -828,12 +951,18 @@ func (m *Manager) InsertIfMissing(ctx context.Context, filter bson.M, model Mode
 		}
 	}
 
+	// encrypt model
+	doc, err := m.encryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
 	// prepare options
 	opts := options.Update().SetUpsert(true)
 
 	// prepare update
 	update := bson.M{
-		"$setOnInsert": model,
+		"$setOnInsert": doc,
 	}
 
 	// increment lock
@@ -849,6 +978,14 @@ func (m *Manager) InsertIfMissing(ctx context.Context, filter bson.M, model Mode
 		return false, err
 	}
 
+	// update counters
+	if res.UpsertedCount == 1 {
+		err = m.count(ctx, nil, []Model{model})
+		if err != nil {
+			return false, err
+		}
+	}
+
 	return res.UpsertedCount == 1, nil
 }
 
@@ -874,13 +1011,25 @@ func (m *Manager) Replace(ctx context.Context, model Model, lock bool, flags ...
 	}
 
 	// require transaction
-	if lock && !HasTransaction(ctx) {
+	if (lock || m.counted()) && !HasTransaction(ctx) {
 		return false, ErrTransactionRequired.Wrap()
 	}
 
+	// run hook
+	err := beforeReplace(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
+	// denormalize model
+	err = m.denormalize(ctx, []Model{model})
+	if err != nil {
+		return false, err
+	}
+
 	// validate model
 	if !Merge(flags).Has(NoValidation) {
-		err := model.Validate()
+		err = model.Validate()
 		if err != nil {
 			return false, xo.W(err)
 		}
@@ -891,14 +1040,50 @@ func (m *Manager) Replace(ctx context.Context, model Model, lock bool, flags ...
 		model.GetBase().Lock += 1000
 	}
 
+	// prepare tree
+	moved, err := m.prepareTree(ctx, model)
+	if err != nil {
+		return false, err
+	}
+
+	// encrypt model
+	doc, err := m.encryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
+	// get counted document
+	before, err := m.snapshot(ctx, bson.M{
+		"_id": model.ID(),
+	}, nil, 0)
+	if err != nil {
+		return false, err
+	}
+
 	// replace document
 	res, err := m.coll.ReplaceOne(ctx, bson.M{
 		"_id": model.ID(),
-	}, model)
+	}, doc)
 	if err != nil {
 		return false, err
 	}
 
+	// update counters
+	if res.MatchedCount == 1 {
+		err = m.count(ctx, before, []Model{model})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// rebase descendants
+	if res.MatchedCount == 1 && moved {
+		err = m.rebase(ctx, model)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	return res.MatchedCount == 1, nil
 }
 
@@ -922,13 +1107,25 @@ func (m *Manager) ReplaceFirst(ctx context.Context, filter bson.M, model Model,
 	}
 
 	// require transaction
-	if lock && !HasTransaction(ctx) {
+	if (lock || m.counted()) && !HasTransaction(ctx) {
 		return false, ErrTransactionRequired.Wrap()
 	}
 
+	// run hook
+	err := beforeReplace(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
+	// denormalize model
+	err = m.denormalize(ctx, []Model{model})
+	if err != nil {
+		return false, err
+	}
+
 	// validate model
 	if !Merge(flags).Has(NoValidation) {
-		err := model.Validate()
+		err = model.Validate()
 		if err != nil {
 			return false, xo.W(err)
 		}
@@ -940,17 +1137,53 @@ func (m *Manager) ReplaceFirst(ctx context.Context, filter bson.M, model Model,
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
+	if err != nil {
+		return false, err
+	}
+
+	// prepare tree
+	moved, err := m.prepareTree(ctx, model)
+	if err != nil {
+		return false, err
+	}
+
+	// encrypt model
+	doc, err := m.encryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
+	// get counted document
+	before, err := m.snapshot(ctx, bson.M{
+		"_id": model.ID(),
+	}, nil, 0)
 	if err != nil {
 		return false, err
 	}
 
 	// replace document
-	res, err := m.coll.ReplaceOne(ctx, filterDoc, model)
+	res, err := m.coll.ReplaceOne(ctx, filterDoc, doc)
 	if err != nil {
 		return false, err
 	}
 
+	// update counters
+	if res.MatchedCount == 1 {
+		err = m.count(ctx, before, []Model{model})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// rebase descendants
+	if res.MatchedCount == 1 && moved {
+		err = m.rebase(ctx, model)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	return res.MatchedCount == 1, nil
 }
 
@@ -960,7 +1193,7 @@ func (m *Manager) ReplaceFirst(ctx context.Context, filter bson.M, model Model,
 // update did not change the document.
 //
 // A transaction is required for locking.
-func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M, lock bool) (bool, error) {
+func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M, lock bool, flags ...Flags) (bool, error) {
 	// trace
 	ctx, span := xo.Trace(ctx, "coal/Manager.Update")
 	defer span.End()
@@ -980,12 +1213,29 @@ func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M,
 		return false, ErrMetaMismatch.Wrap()
 	}
 
+	// run hook
+	err := beforeUpdate(m.meta, update, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
 	// translate update
-	updateDoc, err := m.trans.Document(update)
+	updateDoc, err := m.translateUpdate(update)
 	if err != nil {
 		return false, err
 	}
 
+	// denormalize update
+	err = m.denormalizeUpdate(ctx, &updateDoc)
+	if err != nil {
+		return false, err
+	}
+
+	// require transaction
+	if (m.treeUpdate(updateDoc) || m.countedUpdate(updateDoc)) && !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
 	// increment lock
 	if lock {
 		_, err := bsonkit.Put(&updateDoc, "$inc._lk", 1, false)
@@ -994,6 +1244,17 @@ func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M,
 		}
 	}
 
+	// get counted document
+	var before []Model
+	if m.countedUpdate(updateDoc) {
+		before, err = m.snapshot(ctx, bson.M{
+			"_id": id,
+		}, nil, 0)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// find and update document
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	err = m.coll.FindOneAndUpdate(ctx, bson.M{
@@ -1005,6 +1266,34 @@ func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M,
 		return false, err
 	}
 
+	// update counters
+	if m.countedUpdate(updateDoc) {
+		err = m.count(ctx, before, []Model{model})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// update tree
+	if m.treeUpdate(updateDoc) {
+		err = m.retree(ctx, []Model{model})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// decrypt model
+	err = m.decryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
+	// run hook
+	err = afterLoad(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
@@ -1017,7 +1306,7 @@ func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M,
 //
 // Warning: If the operation depends on interleaving writes to not include or
 // exclude documents from the filter it should be run as part of a transaction.
-func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update bson.M, sort []string, lock bool) (bool, error) {
+func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update bson.M, sort []string, lock bool, flags ...Flags) (bool, error) {
 	// trace
 	ctx, span := xo.Trace(ctx, "coal/Manager.UpdateFirst")
 	defer span.End()
@@ -1038,17 +1327,34 @@ func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update b
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
+	if err != nil {
+		return false, err
+	}
+
+	// run hook
+	err = beforeUpdate(m.meta, update, Merge(flags))
 	if err != nil {
 		return false, err
 	}
 
 	// translate update
-	updateDoc, err := m.trans.Document(update)
+	updateDoc, err := m.translateUpdate(update)
+	if err != nil {
+		return false, err
+	}
+
+	// denormalize update
+	err = m.denormalizeUpdate(ctx, &updateDoc)
 	if err != nil {
 		return false, err
 	}
 
+	// require transaction
+	if (m.treeUpdate(updateDoc) || m.countedUpdate(updateDoc)) && !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
 	// prepare options
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
@@ -1068,6 +1374,15 @@ func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update b
 		}
 	}
 
+	// get counted document
+	var before []Model
+	if m.countedUpdate(updateDoc) {
+		before, err = m.snapshot(ctx, filterDoc, opts.Sort, 1)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// find and update document
 	err = m.coll.FindOneAndUpdate(ctx, filterDoc, updateDoc, opts).Decode(model)
 	if IsMissing(err) {
@@ -1076,9 +1391,272 @@ func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update b
 		return false, err
 	}
 
+	// update counters
+	if m.countedUpdate(updateDoc) {
+		err = m.count(ctx, filterByID(before, model.ID()), []Model{model})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// update tree
+	if m.treeUpdate(updateDoc) {
+		err = m.retree(ctx, []Model{model})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// decrypt model
+	err = m.decryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
+	// run hook
+	err = afterLoad(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
+// CompareAndReplace will replace the existing document with the provided one
+// if the stored version (lock counter) still matches the version of the
+// provided model. On success, the version of the model is incremented. It will
+// return whether a document has been found and ErrVersionConflict if the
+// document has been modified in the meantime.
+//
+// A transaction is not required as the operation uses optimistic concurrency.
+func (m *Manager) CompareAndReplace(ctx context.Context, model Model, flags ...Flags) (bool, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Manager.CompareAndReplace")
+	defer span.End()
+
+	// require transaction
+	if m.counted() && !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
+	// check model
+	if GetMeta(model) != m.meta {
+		return false, ErrMetaMismatch.Wrap()
+	}
+
+	// check id
+	if model.ID().IsZero() {
+		return false, xo.F("model has a zero id")
+	}
+
+	// run hook
+	err := beforeReplace(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
+	// denormalize model
+	err = m.denormalize(ctx, []Model{model})
+	if err != nil {
+		return false, err
+	}
+
+	// validate model
+	if !Merge(flags).Has(NoValidation) {
+		err = model.Validate()
+		if err != nil {
+			return false, xo.W(err)
+		}
+	}
+
+	// prepare tree
+	moved, err := m.prepareTree(ctx, model)
+	if err != nil {
+		return false, err
+	}
+
+	// get version
+	version := model.GetBase().Lock
+
+	// increment version
+	model.GetBase().Lock++
+
+	// encrypt model
+	doc, err := m.encryptModel(model)
+	if err != nil {
+		model.GetBase().Lock = version
+		return false, err
+	}
+
+	// get counted document
+	before, err := m.snapshot(ctx, versionFilter(model.ID(), version), nil, 0)
+	if err != nil {
+		model.GetBase().Lock = version
+		return false, err
+	}
+
+	// replace document
+	res, err := m.coll.ReplaceOne(ctx, versionFilter(model.ID(), version), doc)
+	if err != nil {
+		model.GetBase().Lock = version
+		return false, err
+	}
+
+	// check result
+	if res.MatchedCount == 0 {
+		model.GetBase().Lock = version
+		return m.checkConflict(ctx, model.ID())
+	}
+
+	// update counters
+	err = m.count(ctx, before, []Model{model})
+	if err != nil {
+		return false, err
+	}
+
+	// rebase descendants
+	if moved {
+		err = m.rebase(ctx, model)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// CompareAndUpdate will update the document with the specified id if the
+// stored version (lock counter) still matches the provided version. The version
+// is incremented as part of the update and the updated document decoded into
+// the provided model, if available. It will return whether a document has been
+// found and ErrVersionConflict if the document has been modified in the
+// meantime.
+//
+// A transaction is not required as the operation uses optimistic concurrency.
+func (m *Manager) CompareAndUpdate(ctx context.Context, model Model, id ID, version int64, update bson.M, flags ...Flags) (bool, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Manager.CompareAndUpdate")
+	defer span.End()
+
+	// check model
+	if model == nil {
+		model = m.meta.Make()
+	}
+
+	// check model
+	if GetMeta(model) != m.meta {
+		return false, ErrMetaMismatch.Wrap()
+	}
+
+	// run hook
+	err := beforeUpdate(m.meta, update, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
+	// translate update
+	updateDoc, err := m.translateUpdate(update)
+	if err != nil {
+		return false, err
+	}
+
+	// denormalize update
+	err = m.denormalizeUpdate(ctx, &updateDoc)
+	if err != nil {
+		return false, err
+	}
+
+	// require transaction
+	if (m.treeUpdate(updateDoc) || m.countedUpdate(updateDoc)) && !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
+	// increment version
+	_, err = bsonkit.Put(&updateDoc, "$inc._lk", 1, false)
+	if err != nil {
+		return false, xo.WF(err, "unable to add version")
+	}
+
+	// get counted document
+	var before []Model
+	if m.countedUpdate(updateDoc) {
+		before, err = m.snapshot(ctx, versionFilter(id, version), nil, 0)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// find and update document
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = m.coll.FindOneAndUpdate(ctx, versionFilter(id, version), updateDoc, opts).Decode(model)
+	if IsMissing(err) {
+		return m.checkConflict(ctx, id)
+	} else if err != nil {
+		return false, err
+	}
+
+	// update counters
+	if m.countedUpdate(updateDoc) {
+		err = m.count(ctx, before, []Model{model})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// update tree
+	if m.treeUpdate(updateDoc) {
+		err = m.retree(ctx, []Model{model})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// decrypt model
+	err = m.decryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
+	// run hook
+	err = afterLoad(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (m *Manager) checkConflict(ctx context.Context, id ID) (bool, error) {
+	// check existence
+	count, err := m.coll.CountDocuments(ctx, bson.M{
+		"_id": id,
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	} else if count == 0 {
+		return false, nil
+	}
+
+	return false, ErrVersionConflict.Wrap()
+}
+
+func versionFilter(id ID, version int64) bson.M {
+	// match missing lock field for the initial version
+	if version == 0 {
+		return bson.M{
+			"_id": id,
+			"_lk": bson.M{
+				"$in": bson.A{nil, int64(0)},
+			},
+		}
+	}
+
+	return bson.M{
+		"_id": id,
+		"_lk": version,
+	}
+}
+
 // UpdateAll will update the documents that match the specified filter. It will
 // return the number of matched documents. Lock can be set to true to force a
 // write lock on the documents and prevent a stale read during a transaction in
@@ -1088,7 +1666,7 @@ func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update b
 //
 // Warning: If the operation depends on interleaving writes to not include or
 // exclude documents from the filter it should be run as part of a transaction.
-func (m *Manager) UpdateAll(ctx context.Context, filter, update bson.M, lock bool) (int64, error) {
+func (m *Manager) UpdateAll(ctx context.Context, filter, update bson.M, lock bool, flags ...Flags) (int64, error) {
 	// trace
 	ctx, span := xo.Trace(ctx, "coal/Manager.UpdateAll")
 	defer span.End()
@@ -1099,17 +1677,34 @@ func (m *Manager) UpdateAll(ctx context.Context, filter, update bson.M, lock boo
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	// run hook
+	err = beforeUpdate(m.meta, update, Merge(flags))
 	if err != nil {
 		return 0, err
 	}
 
 	// translate update
-	updateDoc, err := m.trans.Document(update)
+	updateDoc, err := m.translateUpdate(update)
+	if err != nil {
+		return 0, err
+	}
+
+	// denormalize update
+	err = m.denormalizeUpdate(ctx, &updateDoc)
 	if err != nil {
 		return 0, err
 	}
 
+	// require transaction
+	if (m.treeUpdate(updateDoc) || m.countedUpdate(updateDoc)) && !HasTransaction(ctx) {
+		return 0, ErrTransactionRequired.Wrap()
+	}
+
 	// increment lock
 	if lock {
 		_, err := bsonkit.Put(&updateDoc, "$inc._lk", 1, false)
@@ -1118,12 +1713,62 @@ func (m *Manager) UpdateAll(ctx context.Context, filter, update bson.M, lock boo
 		}
 	}
 
+	// get counted documents
+	var before []Model
+	if m.countedUpdate(updateDoc) {
+		before, err = m.snapshot(ctx, filterDoc, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// get tree documents
+	var nodes []Model
+	if m.treeUpdate(updateDoc) {
+		nodes, err = m.nodes(ctx, filterDoc)
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	// update documents
 	res, err := m.coll.UpdateMany(ctx, filterDoc, updateDoc)
 	if err != nil {
 		return 0, err
 	}
 
+	// update counters
+	if len(before) > 0 {
+		after, err := m.snapshot(ctx, bson.M{
+			"_id": bson.M{
+				"$in": idsOf(before),
+			},
+		}, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		err = m.count(ctx, before, after)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// update tree
+	if len(nodes) > 0 {
+		nodes, err = m.nodes(ctx, bson.M{
+			"_id": bson.M{
+				"$in": idsOf(nodes),
+			},
+		})
+		if err != nil {
+			return 0, err
+		}
+		err = m.retree(ctx, nodes)
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	return res.MatchedCount, nil
 }
 
@@ -1137,7 +1782,7 @@ func (m *Manager) UpdateAll(ctx context.Context, filter, update bson.M, lock boo
 //
 // Warning: Even with transactions there is a risk for duplicate inserts when
 // the filter is not covered by a unique index.
-func (m *Manager) Upsert(ctx context.Context, model Model, filter, update bson.M, sort []string, lock bool) (bool, error) {
+func (m *Manager) Upsert(ctx context.Context, model Model, filter, update bson.M, sort []string, lock bool, flags ...Flags) (bool, error) {
 	// trace
 	ctx, span := xo.Trace(ctx, "coal/Manager.Upsert")
 	defer span.End()
@@ -1158,17 +1803,34 @@ func (m *Manager) Upsert(ctx context.Context, model Model, filter, update bson.M
 	}
 
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
+	if err != nil {
+		return false, err
+	}
+
+	// run hook
+	err = beforeUpdate(m.meta, update, Merge(flags))
 	if err != nil {
 		return false, err
 	}
 
 	// translate update
-	updateDoc, err := m.trans.Document(update)
+	updateDoc, err := m.translateUpdate(update)
+	if err != nil {
+		return false, err
+	}
+
+	// denormalize update
+	err = m.denormalizeUpdate(ctx, &updateDoc)
 	if err != nil {
 		return false, err
 	}
 
+	// require transaction
+	if (m.treeUpdate(updateDoc) || m.counted()) && !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
 	// increment lock
 	if lock {
 		_, err := bsonkit.Put(&updateDoc, "$inc._lk", 1, false)
@@ -1195,6 +1857,12 @@ func (m *Manager) Upsert(ctx context.Context, model Model, filter, update bson.M
 		return false, xo.WF(err, "unable to set token")
 	}
 
+	// get counted document
+	before, err := m.snapshot(ctx, filterDoc, opts.Sort, 1)
+	if err != nil {
+		return false, err
+	}
+
 	// find and update document
 	err = m.coll.FindOneAndUpdate(ctx, filterDoc, updateDoc, opts).Decode(model)
 	if IsMissing(err) {
@@ -1203,6 +1871,32 @@ func (m *Manager) Upsert(ctx context.Context, model Model, filter, update bson.M
 		return false, err
 	}
 
+	// update counters
+	err = m.count(ctx, filterByID(before, model.ID()), []Model{model})
+	if err != nil {
+		return false, err
+	}
+
+	// update tree
+	if m.treeUpdate(updateDoc) || (m.meta.Tree != nil && model.GetBase().Token == token) {
+		err = m.retree(ctx, []Model{model})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// decrypt model
+	err = m.decryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
+	// run hook
+	err = afterLoad(model, Merge(flags))
+	if err != nil {
+		return false, err
+	}
+
 	return model.GetBase().Token == token, nil
 }
 
@@ -1213,8 +1907,22 @@ func (m *Manager) Delete(ctx context.Context, model Model, id ID) (bool, error)
 	ctx, span := xo.Trace(ctx, "coal/Manager.Delete")
 	defer span.End()
 
+	// require transaction
+	if m.counted() && !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
 	// delete document
 	if model == nil {
+		// get counted document
+		before, err := m.snapshot(ctx, bson.M{
+			"_id": id,
+		}, nil, 0)
+		if err != nil {
+			return false, err
+		}
+
+		// delete document
 		res, err := m.coll.DeleteOne(ctx, bson.M{
 			"_id": id,
 		})
@@ -1222,6 +1930,14 @@ func (m *Manager) Delete(ctx context.Context, model Model, id ID) (bool, error)
 			return false, err
 		}
 
+		// update counters
+		if res.DeletedCount == 1 {
+			err = m.count(ctx, before, nil)
+			if err != nil {
+				return false, err
+			}
+		}
+
 		return res.DeletedCount == 1, nil
 	}
 
@@ -1240,6 +1956,18 @@ func (m *Manager) Delete(ctx context.Context, model Model, id ID) (bool, error)
 		return false, err
 	}
 
+	// update counters
+	err = m.count(ctx, []Model{model}, nil)
+	if err != nil {
+		return false, err
+	}
+
+	// decrypt model
+	err = m.decryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
@@ -1253,18 +1981,35 @@ func (m *Manager) DeleteAll(ctx context.Context, filter bson.M) (int64, error) {
 	ctx, span := xo.Trace(ctx, "coal/Manager.DeleteAll")
 	defer span.End()
 
+	// require transaction
+	if m.counted() && !HasTransaction(ctx) {
+		return 0, ErrTransactionRequired.Wrap()
+	}
+
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
 	if err != nil {
 		return 0, err
 	}
 
-	// update documents
+	// get counted documents
+	before, err := m.snapshot(ctx, filterDoc, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	// delete documents
 	res, err := m.coll.DeleteMany(ctx, filterDoc)
 	if err != nil {
 		return 0, err
 	}
 
+	// update counters
+	err = m.count(ctx, before, nil)
+	if err != nil {
+		return 0, err
+	}
+
 	return res.DeletedCount, nil
 }
 
@@ -1278,8 +2023,13 @@ func (m *Manager) DeleteFirst(ctx context.Context, model Model, filter bson.M, s
 	ctx, span := xo.Trace(ctx, "coal/Manager.DeleteFirst")
 	defer span.End()
 
+	// require transaction
+	if m.counted() && !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
 	// translate filter
-	filterDoc, err := m.trans.Document(filter)
+	filterDoc, err := m.translateFilter(filter)
 	if err != nil {
 		return false, err
 	}
@@ -1313,14 +2063,27 @@ func (m *Manager) DeleteFirst(ctx context.Context, model Model, filter bson.M, s
 		return false, err
 	}
 
+	// update counters
+	err = m.count(ctx, []Model{model}, nil)
+	if err != nil {
+		return false, err
+	}
+
+	// decrypt model
+	err = m.decryptModel(model)
+	if err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
 // ManagedIterator wraps an iterator to enforce decoding to a model.
 type ManagedIterator struct {
-	meta     *Meta
+	manager  *Manager
 	iterator *Iterator
 	validate bool
+	flags    Flags
 }
 
 // Next will load the next document from the cursor and if available return true.
@@ -1333,7 +2096,7 @@ func (i *ManagedIterator) Next() bool {
 // Decode will decode the loaded document to the specified model.
 func (i *ManagedIterator) Decode(model Model) error {
 	// check model
-	if GetMeta(model) != i.meta {
+	if GetMeta(model) != i.manager.meta {
 		return ErrMetaMismatch.Wrap()
 	}
 
@@ -1343,6 +2106,18 @@ func (i *ManagedIterator) Decode(model Model) error {
 		return err
 	}
 
+	// decrypt
+	err = i.manager.decryptModel(model)
+	if err != nil {
+		return err
+	}
+
+	// run hook
+	err = afterLoad(model, i.flags)
+	if err != nil {
+		return err
+	}
+
 	// validate if requested
 	if i.validate {
 		err = model.Validate()
@@ -868,6 +868,111 @@ func TestManagerUpdateFirst(t *testing.T) {
 	})
 }
 
+func TestManagerCompareAndReplace(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		post := tester.Insert(&postModel{
+			Title: "Hello World!",
+		}).(*postModel)
+
+		m := tester.Store.M(&postModel{})
+
+		// missing
+		found, err := m.CompareAndReplace(nil, &postModel{
+			Base: B(),
+		})
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		// initial version
+		post.Title = "Hello Space!"
+		found, err = m.CompareAndReplace(nil, post)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, int64(1), post.Lock)
+
+		stale := *post
+
+		// next version
+		post.Title = "Hello Moon!"
+		found, err = m.CompareAndReplace(nil, post)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, int64(2), post.Lock)
+
+		// conflict
+		stale.Title = "Hello Mars!"
+		found, err = m.CompareAndReplace(nil, &stale)
+		assert.Error(t, err)
+		assert.True(t, ErrVersionConflict.Is(err))
+		assert.False(t, found)
+		assert.Equal(t, int64(1), stale.Lock)
+
+		var stored postModel
+		found, err = m.Find(nil, &stored, post.ID(), false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "Hello Moon!", stored.Title)
+		assert.Equal(t, int64(2), stored.Lock)
+	})
+}
+
+func TestManagerCompareAndUpdate(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		post := tester.Insert(&postModel{
+			Title: "Hello World!",
+		}).(*postModel)
+
+		m := tester.Store.M(&postModel{})
+
+		// missing
+		found, err := m.CompareAndUpdate(nil, nil, New(), 0, bson.M{
+			"$set": bson.M{
+				"Title": "Hello Space!",
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		// initial version
+		var updated postModel
+		found, err = m.CompareAndUpdate(nil, &updated, post.ID(), 0, bson.M{
+			"$set": bson.M{
+				"Title": "Hello Space!",
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "Hello Space!", updated.Title)
+		assert.Equal(t, int64(1), updated.Lock)
+
+		// next version
+		found, err = m.CompareAndUpdate(nil, nil, post.ID(), 1, bson.M{
+			"$set": bson.M{
+				"Title": "Hello Moon!",
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, found)
+
+		// conflict
+		found, err = m.CompareAndUpdate(nil, nil, post.ID(), 1, bson.M{
+			"$set": bson.M{
+				"Title": "Hello Mars!",
+			},
+		})
+		assert.Error(t, err)
+		assert.True(t, ErrVersionConflict.Is(err))
+		assert.False(t, found)
+
+		var stored postModel
+		found, err = m.Find(nil, &stored, post.ID(), false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "Hello Moon!", stored.Title)
+		assert.Equal(t, int64(2), stored.Lock)
+	})
+}
+
 func TestManagerUpdateAll(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		tester.Insert(&postModel{
@@ -16,8 +16,14 @@ var baseType = reflect.TypeOf(Base{})
 var toOneType = reflect.TypeOf(ID{})
 var optToOneType = reflect.TypeOf(&ID{})
 var toManyType = reflect.TypeOf([]ID{})
+var polyToOneType = reflect.TypeOf(Ref{})
+var optPolyToOneType = reflect.TypeOf(&Ref{})
+var polyToManyType = reflect.TypeOf([]Ref{})
 var hasOneType = reflect.TypeOf(HasOne{})
 var hasManyType = reflect.TypeOf(HasMany{})
+var stringType = reflect.TypeOf("")
+var optStringType = reflect.TypeOf(new(string))
+var bytesType = reflect.TypeOf([]byte{})
 
 // The HasOne type denotes a has-one relationship in a model declaration.
 //
@@ -29,6 +35,29 @@ type HasOne struct{}
 // The HasMany type denotes a has-many relationship in a model declaration.
 type HasMany struct{}
 
+// OnDelete defines the behaviour of a (polymorphic) to-one or to-many
+// relationship when the referenced document is deleted.
+type OnDelete string
+
+// The available on-delete behaviours.
+const (
+	// Cascade will delete the referencing document.
+	Cascade OnDelete = "cascade"
+
+	// Nullify will unset optional to-one references and pull to-many
+	// references.
+	Nullify OnDelete = "nullify"
+
+	// Restrict will prevent the deletion of the referenced document.
+	Restrict OnDelete = "restrict"
+)
+
+var onDeleteBehaviours = map[OnDelete]bool{
+	Cascade:  true,
+	Nullify:  true,
+	Restrict: true,
+}
+
 // A Field contains the meta information about a single field of a model.
 type Field struct {
 	// The index of the field in the struct.
@@ -54,15 +83,23 @@ type Field struct {
 	Optional bool
 
 	// The relationship status.
-	ToOne   bool
-	ToMany  bool
-	HasOne  bool
-	HasMany bool
+	ToOne      bool
+	ToMany     bool
+	HasOne     bool
+	HasMany    bool
+	PolyToOne  bool
+	PolyToMany bool
 
 	// The relationship information.
-	RelName    string
-	RelType    string
-	RelInverse string
+	RelName     string
+	RelType     string
+	RelTypes    []string
+	RelInverse  string
+	RelOnDelete OnDelete
+
+	// The encryption status.
+	Encrypted     bool
+	Deterministic bool
 }
 
 // Meta stores extracted meta data from a model.
@@ -79,6 +116,9 @@ type Meta struct {
 	// The collection name e.g. "car_wheels".
 	Collection string
 
+	// The database name used to route the model to a store e.g. "logs".
+	Database string
+
 	// The struct fields.
 	Fields map[string]*Field
 
@@ -105,6 +145,18 @@ type Meta struct {
 
 	// The registered indexes.
 	Indexes []Index
+
+	// The registered denormalizations.
+	Denormalizations []Denormalization
+
+	// The registered counters the model owns or contributes to.
+	Counters []*Counter
+
+	// The registered tree, if any.
+	Tree *Tree
+
+	// The registered ranking, if any.
+	Ranking *Ranking
 }
 
 // GetMeta returns the meta structure for the specified model. It will always
@@ -167,8 +219,8 @@ func GetMeta(model Model) *Meta {
 			}
 
 			// check tag
-			if len(baseTag) > 2 || baseTag[0] == "" {
-				panic(`coal: expected to find a tag of the form 'coal:"plural-name[:collection]"' on "coal.Base"`)
+			if len(baseTag) > 3 || baseTag[0] == "" || (len(baseTag) == 3 && (baseTag[1] == "" || baseTag[2] == "")) {
+				panic(`coal: expected to find a tag of the form 'coal:"plural-name[:collection[:database]]"' on "coal.Base"`)
 			}
 
 			// infer plural and collection names
@@ -176,10 +228,15 @@ func GetMeta(model Model) *Meta {
 			meta.Collection = baseTag[0]
 
 			// infer collection
-			if len(baseTag) == 2 {
+			if len(baseTag) >= 2 {
 				meta.Collection = baseTag[1]
 			}
 
+			// infer database
+			if len(baseTag) == 3 {
+				meta.Database = baseTag[2]
+			}
+
 			continue
 		}
 
@@ -210,8 +267,8 @@ func GetMeta(model Model) *Meta {
 		if field.Type == toOneType || field.Type == optToOneType {
 			if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
 				// check tag
-				if strings.Count(coalTags[0], ":") > 1 {
-					panic(`coal: expected to find a tag of the form 'coal:"name:type"' on to-one relationship`)
+				if strings.Count(coalTags[0], ":") > 2 {
+					panic(`coal: expected to find a tag of the form 'coal:"name:type[:on-delete]"' on to-one relationship`)
 				}
 
 				// parse special to-one relationship tag
@@ -222,6 +279,22 @@ func GetMeta(model Model) *Meta {
 				metaField.RelName = toOneTag[0]
 				metaField.RelType = toOneTag[1]
 
+				// set on-delete behaviour
+				if len(toOneTag) == 3 {
+					// check behaviour
+					if !onDeleteBehaviours[OnDelete(toOneTag[2])] {
+						panic(`coal: expected to find a tag of the form 'coal:"name:type[:on-delete]"' on to-one relationship`)
+					}
+
+					// set behaviour
+					metaField.RelOnDelete = OnDelete(toOneTag[2])
+				}
+
+				// check nullify
+				if metaField.RelOnDelete == Nullify && !metaField.Optional {
+					panic(`coal: expected an optional to-one relationship for the "nullify" on-delete behaviour`)
+				}
+
 				// remove tag
 				coalTags = coalTags[1:]
 			}
@@ -231,8 +304,8 @@ func GetMeta(model Model) *Meta {
 		if field.Type == toManyType {
 			if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
 				// check tag
-				if strings.Count(coalTags[0], ":") > 1 {
-					panic(`coal: expected to find a tag of the form 'coal:"name:type"' on to-many relationship`)
+				if strings.Count(coalTags[0], ":") > 2 {
+					panic(`coal: expected to find a tag of the form 'coal:"name:type[:on-delete]"' on to-many relationship`)
 				}
 
 				// parse special to-many relationship tag
@@ -243,6 +316,63 @@ func GetMeta(model Model) *Meta {
 				metaField.RelName = toManyTag[0]
 				metaField.RelType = toManyTag[1]
 
+				// set on-delete behaviour
+				if len(toManyTag) == 3 {
+					// check behaviour
+					if !onDeleteBehaviours[OnDelete(toManyTag[2])] {
+						panic(`coal: expected to find a tag of the form 'coal:"name:type[:on-delete]"' on to-many relationship`)
+					}
+
+					// set behaviour
+					metaField.RelOnDelete = OnDelete(toManyTag[2])
+				}
+
+				// remove tag
+				coalTags = coalTags[1:]
+			}
+		}
+
+		// check if field is a valid polymorphic to-one or to-many relationship
+		if field.Type == polyToOneType || field.Type == optPolyToOneType || field.Type == polyToManyType {
+			if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
+				// check tag
+				if strings.Count(coalTags[0], ":") > 2 {
+					panic(`coal: expected to find a tag of the form 'coal:"name:type|type...[:on-delete]"' on polymorphic relationship`)
+				}
+
+				// parse special polymorphic relationship tag
+				polyTag := strings.Split(coalTags[0], ":")
+
+				// parse types
+				relTypes := strings.Split(polyTag[1], "|")
+				for i, relType := range relTypes {
+					if relType == "" || stick.Contains(relTypes[:i], relType) {
+						panic(`coal: expected to find a tag of the form 'coal:"name:type|type...[:on-delete]"' on polymorphic relationship`)
+					}
+				}
+
+				// set relationship data
+				metaField.PolyToOne = field.Type != polyToManyType
+				metaField.PolyToMany = field.Type == polyToManyType
+				metaField.RelName = polyTag[0]
+				metaField.RelTypes = relTypes
+
+				// set on-delete behaviour
+				if len(polyTag) == 3 {
+					// check behaviour
+					if !onDeleteBehaviours[OnDelete(polyTag[2])] {
+						panic(`coal: expected to find a tag of the form 'coal:"name:type|type...[:on-delete]"' on polymorphic relationship`)
+					}
+
+					// set behaviour
+					metaField.RelOnDelete = OnDelete(polyTag[2])
+				}
+
+				// check nullify
+				if metaField.RelOnDelete == Nullify && metaField.PolyToOne && !metaField.Optional {
+					panic(`coal: expected an optional to-one relationship for the "nullify" on-delete behaviour`)
+				}
+
 				// remove tag
 				coalTags = coalTags[1:]
 			}
@@ -288,6 +418,23 @@ func GetMeta(model Model) *Meta {
 			coalTags = coalTags[1:]
 		}
 
+		// check if field is encrypted
+		if stick.Contains(coalTags, "encrypted") {
+			// check type
+			if field.Type != stringType && field.Type != optStringType && field.Type != bytesType {
+				panic(`coal: expected encrypted field to be of type "string", "*string" or "[]byte"`)
+			}
+
+			// set encryption data
+			metaField.Encrypted = true
+			metaField.Deterministic = stick.Contains(coalTags, "deterministic")
+
+			// remove tags
+			coalTags = stick.Subtract(coalTags, []string{"encrypted", "deterministic"})
+		} else if stick.Contains(coalTags, "deterministic") {
+			panic(`coal: expected "deterministic" flag to be used with the "encrypted" flag`)
+		}
+
 		// save additional tags as flags
 		metaField.Flags = coalTags
 		if metaField.Flags == nil {
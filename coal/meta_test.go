@@ -357,7 +357,7 @@ func TestGetMetaErrors(t *testing.T) {
 		GetMeta(&invalidModel{})
 	})
 
-	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"plural-name[:collection]"' on "coal.Base"`, func() {
+	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"plural-name[:collection[:database]]"' on "coal.Base"`, func() {
 		type invalidModel struct {
 			Base `json:"-" bson:",inline" coal:""`
 			Foo  string `json:"foo"`
@@ -377,7 +377,7 @@ func TestGetMetaErrors(t *testing.T) {
 		GetMeta(&invalidModel{})
 	})
 
-	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"name:type"' on to-one relationship`, func() {
+	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"name:type[:on-delete]"' on to-one relationship`, func() {
 		type m struct {
 			Base `json:"-" bson:",inline" coal:"foo:foos"`
 			Foo  ID `coal:"foo:foo:foo"`
@@ -387,7 +387,7 @@ func TestGetMetaErrors(t *testing.T) {
 		GetMeta(&m{})
 	})
 
-	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"name:type"' on to-many relationship`, func() {
+	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"name:type[:on-delete]"' on to-many relationship`, func() {
 		type m struct {
 			Base `json:"-" bson:",inline" coal:"foo:foos"`
 			Foo  []ID `coal:"foo:foo:foo"`
@@ -397,6 +397,76 @@ func TestGetMetaErrors(t *testing.T) {
 		GetMeta(&m{})
 	})
 
+	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"name:type[:on-delete]"' on to-many relationship`, func() {
+		type m struct {
+			Base `json:"-" bson:",inline" coal:"foo:foos"`
+			Foo  []ID `coal:"foo:foo:foo:foo"`
+			stick.NoValidation
+		}
+
+		GetMeta(&m{})
+	})
+
+	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"name:type|type...[:on-delete]"' on polymorphic relationship`, func() {
+		type invalidModel struct {
+			Base `json:"-" bson:",inline" coal:"ms"`
+			Foo  Ref `coal:"foo:foos|bars:foo"`
+			stick.NoValidation
+		}
+
+		GetMeta(&invalidModel{})
+	})
+
+	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"name:type|type...[:on-delete]"' on polymorphic relationship`, func() {
+		type invalidModel struct {
+			Base `json:"-" bson:",inline" coal:"ms"`
+			Foo  Ref `coal:"foo:foos|bars:cascade:foo"`
+			stick.NoValidation
+		}
+
+		GetMeta(&invalidModel{})
+	})
+
+	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"name:type|type...[:on-delete]"' on polymorphic relationship`, func() {
+		type invalidModel struct {
+			Base `json:"-" bson:",inline" coal:"ms"`
+			Foo  []Ref `coal:"foo:foos||bars"`
+			stick.NoValidation
+		}
+
+		GetMeta(&invalidModel{})
+	})
+
+	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"name:type|type...[:on-delete]"' on polymorphic relationship`, func() {
+		type invalidModel struct {
+			Base `json:"-" bson:",inline" coal:"ms"`
+			Foo  *Ref `coal:"foo:foos|foos"`
+			stick.NoValidation
+		}
+
+		GetMeta(&invalidModel{})
+	})
+
+	assert.PanicsWithValue(t, `coal: expected an optional to-one relationship for the "nullify" on-delete behaviour`, func() {
+		type m struct {
+			Base `json:"-" bson:",inline" coal:"foo:foos"`
+			Foo  ID `coal:"foo:foo:nullify"`
+			stick.NoValidation
+		}
+
+		GetMeta(&m{})
+	})
+
+	assert.PanicsWithValue(t, `coal: expected an optional to-one relationship for the "nullify" on-delete behaviour`, func() {
+		type m struct {
+			Base `json:"-" bson:",inline" coal:"foo:foos"`
+			Foo  Ref `coal:"foo:foos|bars:nullify"`
+			stick.NoValidation
+		}
+
+		GetMeta(&m{})
+	})
+
 	assert.PanicsWithValue(t, `coal: expected to find a tag of the form 'coal:"name:type:inverse"' on has-one relationship`, func() {
 		type m struct {
 			Base `json:"-" bson:",inline" coal:"foo:foos"`
@@ -417,6 +487,26 @@ func TestGetMetaErrors(t *testing.T) {
 		GetMeta(&invalidModel{})
 	})
 
+	assert.PanicsWithValue(t, `coal: expected encrypted field to be of type "string", "*string" or "[]byte"`, func() {
+		type invalidModel struct {
+			Base `json:"-" bson:",inline" coal:"foo:foos"`
+			Foo  int `coal:"encrypted"`
+			stick.NoValidation
+		}
+
+		GetMeta(&invalidModel{})
+	})
+
+	assert.PanicsWithValue(t, `coal: expected "deterministic" flag to be used with the "encrypted" flag`, func() {
+		type invalidModel struct {
+			Base `json:"-" bson:",inline" coal:"foo:foos"`
+			Foo  string `coal:"deterministic"`
+			stick.NoValidation
+		}
+
+		GetMeta(&invalidModel{})
+	})
+
 	// assert.PanicsWithValue(t, `coal: duplicate JSON key "text"`, func() {
 	// 	type invalidModel struct {
 	// 		Base  `json:"-" bson:",inline" coal:"ms"`
@@ -450,6 +540,76 @@ func TestGetMetaErrors(t *testing.T) {
 	})
 }
 
+func TestMetaOnDelete(t *testing.T) {
+	type m struct {
+		Base `json:"-" bson:",inline" coal:"foos"`
+		Foo  ID   `coal:"foo:foos:cascade"`
+		Bar  *ID  `coal:"bar:bars:nullify"`
+		Baz  []ID `coal:"baz:bazs:restrict"`
+		Qux  ID   `coal:"qux:quxs"`
+		stick.NoValidation
+	}
+
+	meta := GetMeta(&m{})
+	assert.Equal(t, Cascade, meta.Fields["Foo"].RelOnDelete)
+	assert.Equal(t, "foos", meta.Fields["Foo"].RelType)
+	assert.Equal(t, Nullify, meta.Fields["Bar"].RelOnDelete)
+	assert.Equal(t, Restrict, meta.Fields["Baz"].RelOnDelete)
+	assert.Equal(t, OnDelete(""), meta.Fields["Qux"].RelOnDelete)
+}
+
+func TestMetaEncrypted(t *testing.T) {
+	type m struct {
+		Base `json:"-" bson:",inline" coal:"foos"`
+		Foo  string  `coal:"encrypted,foo"`
+		Bar  *string `coal:"encrypted,deterministic"`
+		Baz  []byte  `coal:"encrypted"`
+		Qux  string
+		stick.NoValidation
+	}
+
+	meta := GetMeta(&m{})
+	assert.True(t, meta.Fields["Foo"].Encrypted)
+	assert.False(t, meta.Fields["Foo"].Deterministic)
+	assert.Equal(t, []string{"foo"}, meta.Fields["Foo"].Flags)
+	assert.True(t, meta.Fields["Bar"].Encrypted)
+	assert.True(t, meta.Fields["Bar"].Deterministic)
+	assert.Equal(t, []string{}, meta.Fields["Bar"].Flags)
+	assert.True(t, meta.Fields["Baz"].Encrypted)
+	assert.False(t, meta.Fields["Qux"].Encrypted)
+}
+
+func TestMetaPolymorphic(t *testing.T) {
+	type m struct {
+		Base `json:"-" bson:",inline" coal:"foos"`
+		Foo  Ref   `json:"-" bson:"foo" coal:"foo:foos|bars"`
+		Bar  *Ref  `json:"-" bson:"bar" coal:"bar:bars"`
+		Baz  []Ref `json:"-" bson:"baz" coal:"baz:foos|bars|bazs"`
+		Qux  Ref   `json:"qux" bson:"qux"`
+		stick.NoValidation
+	}
+
+	meta := GetMeta(&m{})
+	assert.True(t, meta.Fields["Foo"].PolyToOne)
+	assert.False(t, meta.Fields["Foo"].PolyToMany)
+	assert.False(t, meta.Fields["Foo"].ToOne)
+	assert.Equal(t, "foo", meta.Fields["Foo"].RelName)
+	assert.Equal(t, "", meta.Fields["Foo"].RelType)
+	assert.Equal(t, []string{"foos", "bars"}, meta.Fields["Foo"].RelTypes)
+	assert.True(t, meta.Fields["Bar"].PolyToOne)
+	assert.True(t, meta.Fields["Bar"].Optional)
+	assert.Equal(t, []string{"bars"}, meta.Fields["Bar"].RelTypes)
+	assert.True(t, meta.Fields["Baz"].PolyToMany)
+	assert.False(t, meta.Fields["Baz"].PolyToOne)
+	assert.Equal(t, []string{"foos", "bars", "bazs"}, meta.Fields["Baz"].RelTypes)
+	assert.False(t, meta.Fields["Qux"].PolyToOne)
+	assert.Equal(t, "", meta.Fields["Qux"].RelName)
+	assert.Equal(t, meta.Fields["Foo"], meta.Relationships["foo"])
+	assert.Equal(t, meta.Fields["Baz"], meta.Relationships["baz"])
+	assert.Nil(t, meta.Relationships["qux"])
+	assert.Equal(t, meta.Fields["Qux"], meta.Attributes["qux"])
+}
+
 func TestMetaMake(t *testing.T) {
 	post := GetMeta(&postModel{}).Make()
 	assert.Equal(t, "*coal.postModel", reflect.TypeOf(post).String())
@@ -0,0 +1,191 @@
+package coal
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrCollectionScan is returned in explain mode if a query on a collection
+// that requires an index would perform a collection scan.
+var ErrCollectionScan = xo.BF("collection scan")
+
+// SlowQuery is reported to the store reporter if an operation took longer than
+// the configured slow query threshold.
+type SlowQuery struct {
+	// The collection name.
+	Collection string
+
+	// The operation e.g. "find" or "updateMany".
+	Operation string
+
+	// The translated filter or pipeline.
+	Filter interface{}
+
+	// The translated sort, if any.
+	Sort interface{}
+
+	// The operation duration.
+	Duration time.Duration
+
+	// The caller that issued the operation.
+	Caller xo.Caller
+}
+
+// Error implements the error interface.
+func (q *SlowQuery) Error() string {
+	return fmt.Sprintf("slow query: %s on %q took %s (filter: %s, sort: %s, caller: %s)", q.Operation, q.Collection, q.Duration, formatQuery(q.Filter), formatQuery(q.Sort), q.Caller.Short)
+}
+
+// SetSlowQueryThreshold will set the duration after which operations are
+// reported as a SlowQuery to the store reporter. A zero threshold disables
+// the reporting.
+func (s *Store) SetSlowQueryThreshold(threshold time.Duration) {
+	s.slowThreshold = threshold
+}
+
+// SetExplain will enable or disable the explain mode. In explain mode, find,
+// aggregate and count operations on collections that require an index are
+// explained before execution and fail with ErrCollectionScan if the query plan
+// includes a collection scan. The mode is intended to be used in tests.
+//
+// Note: Lungo does not support explain and the mode is a no-op.
+func (s *Store) SetExplain(enabled bool) {
+	s.explain = enabled
+}
+
+// RequireIndex will mark the collections of the provided models as requiring
+// an index for queries in explain mode.
+func (s *Store) RequireIndex(models ...Model) {
+	for _, model := range models {
+		s.indexRequired.Store(GetMeta(model).Collection, true)
+	}
+}
+
+func (c *Collection) observe(op string, filter, sort interface{}, start time.Time) {
+	// check store and threshold
+	if c.store == nil || c.store.slowThreshold <= 0 || c.store.reporter == nil {
+		return
+	}
+
+	// check duration
+	duration := time.Since(start)
+	if duration < c.store.slowThreshold {
+		return
+	}
+
+	// report slow query
+	c.store.reporter(&SlowQuery{
+		Collection: c.coll.Name(),
+		Operation:  op,
+		Filter:     filter,
+		Sort:       sort,
+		Duration:   duration,
+		Caller:     queryCaller(),
+	})
+}
+
+func (c *Collection) explainQuery(cmd bson.D) error {
+	// check mode
+	if c.store == nil || !c.store.explain || c.store.Lungo() {
+		return nil
+	}
+
+	// check collection
+	if _, ok := c.store.indexRequired.Load(c.coll.Name()); !ok {
+		return nil
+	}
+
+	// explain outside any transaction
+	var res bson.Raw
+	err := c.store.DB().RunCommand(context.Background(), bson.D{
+		{Key: "explain", Value: cmd},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).Decode(&res)
+	if err != nil {
+		return xo.W(err)
+	}
+
+	// check plan
+	if hasCollectionScan(bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: res}) {
+		return ErrCollectionScan.WrapF("collection scan on %q", c.coll.Name())
+	}
+
+	return nil
+}
+
+func hasCollectionScan(value bson.RawValue) bool {
+	// check value
+	switch value.Type {
+	case bson.TypeEmbeddedDocument:
+		elements, _ := value.Document().Elements()
+		for _, element := range elements {
+			if stage, ok := element.Value().StringValueOK(); ok && element.Key() == "stage" && stage == "COLLSCAN" {
+				return true
+			}
+			if hasCollectionScan(element.Value()) {
+				return true
+			}
+		}
+	case bson.TypeArray:
+		values, _ := value.Array().Values()
+		for _, item := range values {
+			if hasCollectionScan(item) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func queryCaller() xo.Caller {
+	// get stack
+	stack := make([]uintptr, 32)
+	n := runtime.Callers(2, stack)
+	stack = stack[:n]
+
+	// find first caller outside the store, manager and collection methods
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/256dpi/fire/coal.(*") {
+			short := frame.Function
+			if idx := strings.LastIndex(short, "/"); idx > 0 {
+				short = short[idx+1:]
+			}
+			return xo.Caller{
+				Short: short,
+				Full:  frame.Function,
+				File:  frame.File,
+				Line:  frame.Line,
+				Stack: stack,
+			}
+		}
+		if !more {
+			break
+		}
+	}
+
+	return xo.Caller{}
+}
+
+func formatQuery(query interface{}) string {
+	// check query
+	if query == nil {
+		return "{}"
+	}
+
+	// format as extended JSON
+	data, err := bson.MarshalExtJSON(query, false, false)
+	if err != nil {
+		return fmt.Sprintf("%v", query)
+	}
+
+	return string(data)
+}
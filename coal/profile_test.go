@@ -0,0 +1,111 @@
+package coal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSlowQuery(t *testing.T) {
+	var reports []error
+	store := MustOpen(nil, "test-fire-coal", func(err error) {
+		reports = append(reports, err)
+	})
+
+	_, err := store.C(&postModel{}).CountDocuments(nil, bson.M{})
+	assert.NoError(t, err)
+	assert.Empty(t, reports)
+
+	store.SetSlowQueryThreshold(time.Nanosecond)
+
+	iter, err := store.C(&postModel{}).Find(nil, bson.M{
+		"title": "Hello",
+	}, options.Find().SetSort(bson.M{"title": 1}))
+	assert.NoError(t, err)
+	iter.Close()
+
+	var list []postModel
+	err = store.M(&postModel{}).FindAll(nil, &list, bson.M{
+		"Title": "Hello",
+	}, []string{"-Title"}, 0, 0, false, NoTransaction)
+	assert.NoError(t, err)
+
+	assert.Len(t, reports, 2)
+
+	query := reports[0].(*SlowQuery)
+	assert.Equal(t, "posts", query.Collection)
+	assert.Equal(t, "find", query.Operation)
+	assert.Equal(t, bson.M{"title": "Hello"}, query.Filter)
+	assert.Equal(t, bson.M{"title": 1}, query.Sort)
+	assert.True(t, query.Duration > 0)
+	assert.Equal(t, "coal.TestSlowQuery", query.Caller.Short)
+	assert.True(t, strings.HasPrefix(query.Error(), `slow query: find on "posts" took `))
+
+	query = reports[1].(*SlowQuery)
+	assert.Equal(t, bson.D{{Key: "title", Value: int32(-1)}}, query.Sort)
+	assert.Equal(t, "coal.TestSlowQuery", query.Caller.Short)
+}
+
+func TestExplain(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester.Store.SetExplain(true)
+		tester.Store.RequireIndex(&postModel{})
+		defer tester.Store.SetExplain(false)
+
+		err := EnsureIndexes(tester.Store, &postModel{})
+		assert.NoError(t, err)
+
+		tester.Insert(&postModel{
+			Title:     "Hello",
+			Published: true,
+		})
+
+		count, err := tester.Store.M(&postModel{}).Count(nil, bson.M{
+			"Published": true,
+		}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		_, err = tester.Store.M(&postModel{}).Count(nil, bson.M{
+			"TextBody": "foo",
+		}, 0, 0, false, NoTransaction)
+		if tester.Store.Lungo() {
+			assert.NoError(t, err)
+		} else {
+			assert.Error(t, err)
+			assert.True(t, ErrCollectionScan.Is(err))
+		}
+
+		_, err = tester.Store.M(&commentModel{}).Count(nil, bson.M{
+			"Message": "foo",
+		}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+	})
+}
+
+func TestHasCollectionScan(t *testing.T) {
+	raw := func(doc bson.M) bson.RawValue {
+		bytes, err := bson.Marshal(doc)
+		assert.NoError(t, err)
+		return bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: bytes}
+	}
+
+	assert.False(t, hasCollectionScan(raw(bson.M{
+		"stage": 1,
+	})))
+
+	assert.False(t, hasCollectionScan(raw(bson.M{
+		"winningPlan": bson.M{"stage": "IXSCAN"},
+	})))
+
+	assert.True(t, hasCollectionScan(raw(bson.M{
+		"stage": bson.M{"stage": 1},
+		"inputStages": bson.A{
+			bson.M{"stage": "COLLSCAN"},
+		},
+	})))
+}
@@ -0,0 +1,371 @@
+package coal
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var systemFieldTypes = map[string]reflect.Type{
+	"_id": reflect.TypeOf(ID{}),
+	"_lk": reflect.TypeOf(int64(0)),
+}
+
+// Query is a type-safe query builder for the model M. Field names and values
+// are validated against the model meta when predicates, sorts and updates are
+// added. The compiled filter, sort and update can be used with the Manager and
+// Translator.
+//
+// Note: The builder will panic if an unknown field is referenced or a value is
+// not compatible with the type of the field.
+type Query[M Model] struct {
+	meta    *Meta
+	clauses []bson.M
+	sort    []string
+	update  bson.M
+}
+
+// Q will return a new query builder for the model M.
+func Q[M Model]() *Query[M] {
+	// get meta
+	var zero M
+	meta := GetMeta(reflect.New(reflect.TypeOf(zero).Elem()).Interface().(Model))
+
+	return &Query[M]{
+		meta: meta,
+	}
+}
+
+// Eq will add a predicate that matches documents where the field is equal to
+// the value. For to-many and other list fields the value may also be an item.
+func (q *Query[M]) Eq(field string, value interface{}) *Query[M] {
+	return q.where(field, "$eq", q.value(field, value, true))
+}
+
+// Ne will add a predicate that matches documents where the field is not equal
+// to the value.
+func (q *Query[M]) Ne(field string, value interface{}) *Query[M] {
+	return q.where(field, "$ne", q.value(field, value, true))
+}
+
+// Gt will add a predicate that matches documents where the field is greater
+// than the value.
+func (q *Query[M]) Gt(field string, value interface{}) *Query[M] {
+	return q.where(field, "$gt", q.value(field, value, false))
+}
+
+// Gte will add a predicate that matches documents where the field is greater
+// than or equal to the value.
+func (q *Query[M]) Gte(field string, value interface{}) *Query[M] {
+	return q.where(field, "$gte", q.value(field, value, false))
+}
+
+// Lt will add a predicate that matches documents where the field is less than
+// the value.
+func (q *Query[M]) Lt(field string, value interface{}) *Query[M] {
+	return q.where(field, "$lt", q.value(field, value, false))
+}
+
+// Lte will add a predicate that matches documents where the field is less than
+// or equal to the value.
+func (q *Query[M]) Lte(field string, value interface{}) *Query[M] {
+	return q.where(field, "$lte", q.value(field, value, false))
+}
+
+// In will add a predicate that matches documents where the field is equal to
+// one of the values.
+func (q *Query[M]) In(field string, values ...interface{}) *Query[M] {
+	return q.where(field, "$in", q.values(field, values))
+}
+
+// Nin will add a predicate that matches documents where the field is not equal
+// to any of the values.
+func (q *Query[M]) Nin(field string, values ...interface{}) *Query[M] {
+	return q.where(field, "$nin", q.values(field, values))
+}
+
+// Exists will add a predicate that matches documents where the field is either
+// present or absent.
+func (q *Query[M]) Exists(field string, exists bool) *Query[M] {
+	q.lookup(field)
+	return q.where(field, "$exists", exists)
+}
+
+// Regex will add a predicate that matches documents where the string field
+// matches the provided regular expression and options.
+func (q *Query[M]) Regex(field, pattern, options string) *Query[M] {
+	// check type
+	if kind(q.lookup(field)) != reflect.String {
+		panic(fmt.Sprintf(`coal: expected string field for regex on "%s"`, field))
+	}
+
+	// prepare value
+	value := bson.M{
+		"$regex": pattern,
+	}
+	if options != "" {
+		value["$options"] = options
+	}
+
+	// add clause
+	q.clauses = append(q.clauses, bson.M{
+		field: value,
+	})
+
+	return q
+}
+
+// Or will add a predicate that matches documents that match at least one of
+// the provided queries.
+func (q *Query[M]) Or(queries ...*Query[M]) *Query[M] {
+	// collect filters
+	list := make(bson.A, 0, len(queries))
+	for _, query := range queries {
+		list = append(list, query.Filter())
+	}
+
+	// add clause
+	q.clauses = append(q.clauses, bson.M{
+		"$or": list,
+	})
+
+	return q
+}
+
+// Asc will add an ascending sort on the specified field.
+func (q *Query[M]) Asc(field string) *Query[M] {
+	q.lookup(field)
+	q.sort = append(q.sort, field)
+	return q
+}
+
+// Desc will add a descending sort on the specified field.
+func (q *Query[M]) Desc(field string) *Query[M] {
+	q.lookup(field)
+	q.sort = append(q.sort, "-"+field)
+	return q
+}
+
+// Set will add an update that sets the field to the value.
+func (q *Query[M]) Set(field string, value interface{}) *Query[M] {
+	return q.modify("$set", field, q.value(field, value, false))
+}
+
+// Unset will add an update that removes the field.
+func (q *Query[M]) Unset(field string) *Query[M] {
+	q.lookup(field)
+	return q.modify("$unset", field, "")
+}
+
+// Inc will add an update that increments the numeric field by the value.
+func (q *Query[M]) Inc(field string, value interface{}) *Query[M] {
+	// check type
+	if !numeric(kind(q.lookup(field))) || value == nil || !numeric(reflect.TypeOf(value).Kind()) {
+		panic(fmt.Sprintf(`coal: expected numeric field and value for increment on "%s"`, field))
+	}
+
+	return q.modify("$inc", field, q.value(field, value, false))
+}
+
+// Push will add an update that appends the value to the list field.
+func (q *Query[M]) Push(field string, value interface{}) *Query[M] {
+	// check type
+	if q.lookup(field).Kind() != reflect.Slice {
+		panic(fmt.Sprintf(`coal: expected list field for push on "%s"`, field))
+	}
+
+	return q.modify("$push", field, q.value(field, value, true))
+}
+
+// Filter will return the compiled filter document.
+func (q *Query[M]) Filter() bson.M {
+	// handle single clause
+	if len(q.clauses) == 0 {
+		return bson.M{}
+	} else if len(q.clauses) == 1 {
+		return q.clauses[0]
+	}
+
+	// merge clauses if they do not conflict
+	filter := bson.M{}
+	for _, clause := range q.clauses {
+		for key, value := range clause {
+			// add key if missing
+			existing, ok := filter[key]
+			if !ok {
+				filter[key] = value
+				continue
+			}
+
+			// merge operators
+			a, okA := existing.(bson.M)
+			b, okB := value.(bson.M)
+			if !okA || !okB || key == "$or" {
+				return bson.M{"$and": q.and()}
+			}
+			merged := bson.M{}
+			for op, val := range a {
+				merged[op] = val
+			}
+			for op, val := range b {
+				if _, ok := merged[op]; ok {
+					return bson.M{"$and": q.and()}
+				}
+				merged[op] = val
+			}
+			filter[key] = merged
+		}
+	}
+
+	return filter
+}
+
+// Sort will return the compiled sort fields.
+func (q *Query[M]) Sort() []string {
+	return q.sort
+}
+
+// Update will return the compiled update document.
+func (q *Query[M]) Update() bson.M {
+	if q.update == nil {
+		return bson.M{}
+	}
+
+	return q.update
+}
+
+func (q *Query[M]) and() bson.A {
+	// convert clauses
+	list := make(bson.A, 0, len(q.clauses))
+	for _, clause := range q.clauses {
+		list = append(list, clause)
+	}
+
+	return list
+}
+
+func (q *Query[M]) where(field, op string, value interface{}) *Query[M] {
+	// add clause
+	q.clauses = append(q.clauses, bson.M{
+		field: bson.M{
+			op: value,
+		},
+	})
+
+	return q
+}
+
+func (q *Query[M]) modify(op, field string, value interface{}) *Query[M] {
+	// ensure update
+	if q.update == nil {
+		q.update = bson.M{}
+	}
+
+	// ensure operator
+	doc, _ := q.update[op].(bson.M)
+	if doc == nil {
+		doc = bson.M{}
+		q.update[op] = doc
+	}
+
+	// check field
+	if _, ok := doc[field]; ok {
+		panic(fmt.Sprintf(`coal: duplicate %s update on "%s"`, op, field))
+	}
+
+	// set value
+	doc[field] = value
+
+	return q
+}
+
+func (q *Query[M]) lookup(field string) reflect.Type {
+	// check system fields
+	if typ := systemFieldTypes[field]; typ != nil {
+		return typ
+	}
+
+	// check database fields
+	if dbField := q.meta.DatabaseFields[field]; dbField != nil {
+		return dbField.Type
+	}
+
+	// check struct fields
+	structField := q.meta.Fields[field]
+	if structField == nil {
+		panic(fmt.Sprintf(`coal: unknown field "%s" on "%s"`, field, q.meta.Name))
+	} else if structField.BSONKey == "" {
+		panic(fmt.Sprintf(`coal: virtual field "%s" on "%s"`, field, q.meta.Name))
+	}
+
+	return structField.Type
+}
+
+func (q *Query[M]) values(field string, values []interface{}) bson.A {
+	// check values
+	list := make(bson.A, 0, len(values))
+	for _, value := range values {
+		list = append(list, q.value(field, value, true))
+	}
+
+	return list
+}
+
+func (q *Query[M]) value(field string, value interface{}, item bool) interface{} {
+	// get type
+	typ := q.lookup(field)
+
+	// check nil
+	if value == nil {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			return nil
+		}
+		panic(fmt.Sprintf(`coal: invalid nil value for field "%s" of type %s`, field, typ))
+	}
+
+	// check value type
+	valueType := reflect.TypeOf(value)
+	if valueType.AssignableTo(typ) {
+		return value
+	}
+
+	// get element type of optional and list fields
+	elemType := typ
+	if typ.Kind() == reflect.Ptr || (item && typ.Kind() == reflect.Slice) {
+		elemType = typ.Elem()
+	}
+
+	// check element type
+	if valueType.AssignableTo(elemType) {
+		return value
+	}
+
+	// convert numbers
+	if numeric(valueType.Kind()) && numeric(elemType.Kind()) {
+		return reflect.ValueOf(value).Convert(elemType).Interface()
+	}
+
+	panic(fmt.Sprintf(`coal: invalid value of type %s for field "%s" of type %s`, valueType, field, typ))
+}
+
+func kind(typ reflect.Type) reflect.Kind {
+	// unwrap pointer
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	return typ.Kind()
+}
+
+func numeric(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,158 @@
+package coal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQuery(t *testing.T) {
+	post := New()
+
+	// filter
+	q := Q[*commentModel]().Eq("Message", "Hello").Ne("Parent", nil).Eq("post_id", post)
+	assert.Equal(t, bson.M{
+		"Message": bson.M{"$eq": "Hello"},
+		"Parent":  bson.M{"$ne": nil},
+		"post_id": bson.M{"$eq": post},
+	}, q.Filter())
+	assert.Equal(t, bson.M{}, q.Update())
+	assert.Nil(t, q.Sort())
+
+	// merged
+	q = Q[*commentModel]().Gt("_lk", 1).Lte("_lk", int32(5))
+	assert.Equal(t, bson.M{
+		"_lk": bson.M{
+			"$gt":  int64(1),
+			"$lte": int64(5),
+		},
+	}, q.Filter())
+
+	// conflicting
+	q = Q[*commentModel]().Ne("Message", "foo").Ne("Message", "bar")
+	assert.Equal(t, bson.M{
+		"$and": bson.A{
+			bson.M{"Message": bson.M{"$ne": "foo"}},
+			bson.M{"Message": bson.M{"$ne": "bar"}},
+		},
+	}, q.Filter())
+
+	// lists
+	sq := Q[*selectionModel]().Eq("Posts", post).In("Name", "a", "b").Exists("Posts", true)
+	assert.Equal(t, bson.M{
+		"Posts": bson.M{"$eq": post, "$exists": true},
+		"Name":  bson.M{"$in": bson.A{"a", "b"}},
+	}, sq.Filter())
+
+	// regex and or
+	pq := Q[*postModel]().Regex("Title", "^foo", "i").Or(
+		Q[*postModel]().Eq("Published", true),
+		Q[*postModel]().Eq("TextBody", ""),
+	)
+	assert.Equal(t, bson.M{
+		"Title": bson.M{"$regex": "^foo", "$options": "i"},
+		"$or": bson.A{
+			bson.M{"Published": bson.M{"$eq": true}},
+			bson.M{"TextBody": bson.M{"$eq": ""}},
+		},
+	}, pq.Filter())
+
+	// sort
+	pq = Q[*postModel]().Asc("Title").Desc("_id")
+	assert.Equal(t, []string{"Title", "-_id"}, pq.Sort())
+
+	// update
+	nq := Q[*noteModel]().Set("Title", "Hello").Unset("UpdatedAt").Inc("_lk", 1)
+	assert.Equal(t, bson.M{
+		"$set":   bson.M{"Title": "Hello"},
+		"$unset": bson.M{"UpdatedAt": ""},
+		"$inc":   bson.M{"_lk": int64(1)},
+	}, nq.Update())
+
+	// push
+	sq = Q[*selectionModel]().Push("Posts", post)
+	assert.Equal(t, bson.M{
+		"$push": bson.M{"Posts": post},
+	}, sq.Update())
+
+	// translation
+	doc, err := NewTranslator(&postModel{}).Document(Q[*postModel]().Eq("Title", "foo").Or(
+		Q[*postModel]().Eq("TextBody", "bar"),
+	).Filter())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, bson.D{
+		{Key: "title", Value: bson.D{{Key: "$eq", Value: "foo"}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "text_body", Value: bson.D{{Key: "$eq", Value: "bar"}}}},
+		}},
+	}, doc)
+}
+
+func TestQueryValidation(t *testing.T) {
+	assert.PanicsWithValue(t, `coal: unknown field "Foo" on "coal.postModel"`, func() {
+		Q[*postModel]().Eq("Foo", "bar")
+	})
+
+	assert.PanicsWithValue(t, `coal: virtual field "Comments" on "coal.postModel"`, func() {
+		Q[*postModel]().Asc("Comments")
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid value of type int for field "Title" of type string`, func() {
+		Q[*postModel]().Eq("Title", 1)
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid nil value for field "Title" of type string`, func() {
+		Q[*postModel]().Set("Title", nil)
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid value of type primitive.ObjectID for field "Posts" of type []primitive.ObjectID`, func() {
+		Q[*selectionModel]().Set("Posts", New())
+	})
+
+	assert.PanicsWithValue(t, `coal: expected string field for regex on "Published"`, func() {
+		Q[*postModel]().Regex("Published", "foo", "")
+	})
+
+	assert.PanicsWithValue(t, `coal: expected numeric field and value for increment on "Title"`, func() {
+		Q[*postModel]().Inc("Title", 1)
+	})
+
+	assert.PanicsWithValue(t, `coal: expected list field for push on "Title"`, func() {
+		Q[*postModel]().Push("Title", "foo")
+	})
+
+	assert.PanicsWithValue(t, `coal: duplicate $set update on "Title"`, func() {
+		Q[*postModel]().Set("Title", "foo").Set("Title", "bar")
+	})
+}
+
+func TestQueryManager(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		post1 := tester.Insert(&postModel{Title: "A", Published: true}).(*postModel)
+		post2 := tester.Insert(&postModel{Title: "B", Published: true}).(*postModel)
+		tester.Insert(&postModel{Title: "C"})
+
+		m := tester.Store.M(&postModel{})
+
+		q := Q[*postModel]().Eq("Published", true).Desc("Title")
+
+		var list []*postModel
+		err := m.FindAll(nil, &list, q.Filter(), q.Sort(), 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, list, 2)
+		assert.Equal(t, post2.ID(), list[0].ID())
+		assert.Equal(t, post1.ID(), list[1].ID())
+
+		found, err := m.Update(nil, nil, post1.ID(), Q[*postModel]().Set("TextBody", "Hello").Update(), false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+
+		post := tester.Fetch(&postModel{}, post1.ID()).(*postModel)
+		assert.Equal(t, "Hello", post.TextBody)
+
+		count, err := m.Count(nil, Q[*postModel]().In("Title", "A", "C").Filter(), 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+	})
+}
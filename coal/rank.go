@@ -0,0 +1,567 @@
+package coal
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// ErrInvalidRankTarget is returned if a reorder target does not exist, is not
+// part of the same scope or is the document itself.
+var ErrInvalidRankTarget = xo.BF("invalid rank target")
+
+// MaxRankLength is the maximum length of a rank before the ranks of a scope
+// are rebalanced.
+const MaxRankLength = 16
+
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// Rank is a lexicographically sortable position. Ranks consist of the digits
+// 0-9 and lower case letters a-z and never end with a zero. This guarantees
+// that there is always a rank between two different ranks.
+type Rank string
+
+var rankType = reflect.TypeOf(Rank(""))
+
+// Valid returns whether the rank is non-empty and well-formed.
+func (r Rank) Valid() bool {
+	// check length and trailing zero
+	if r == "" || r[len(r)-1] == '0' {
+		return false
+	}
+
+	// check digits
+	for i := 0; i < len(r); i++ {
+		if strings.IndexByte(rankDigits, r[i]) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RankBetween returns a rank that sorts between the two provided ranks. An
+// empty lower rank denotes the start and an empty upper rank the end of the
+// list. An error is returned if the ranks are invalid or not ordered.
+func RankBetween(lower, upper Rank) (Rank, error) {
+	// check ranks
+	if lower != "" && !lower.Valid() || upper != "" && !upper.Valid() {
+		return "", xo.F("invalid rank")
+	} else if upper != "" && lower >= upper {
+		return "", xo.F("unordered ranks")
+	}
+
+	return Rank(rankMidpoint(string(lower), string(upper))), nil
+}
+
+// RankSpread returns the specified amount of evenly distributed ranks.
+func RankSpread(n int) []Rank {
+	// check count
+	if n <= 0 {
+		return nil
+	}
+
+	// determine length and space
+	length := 1
+	space := uint64(len(rankDigits))
+	for space <= uint64(n) {
+		length++
+		space *= uint64(len(rankDigits))
+	}
+
+	// compute step
+	step := space / uint64(n+1)
+
+	// generate ranks
+	ranks := make([]Rank, 0, n)
+	buf := make([]byte, length)
+	for i := 1; i <= n; i++ {
+		// encode value
+		value := uint64(i) * step
+		for j := length - 1; j >= 0; j-- {
+			buf[j] = rankDigits[value%uint64(len(rankDigits))]
+			value /= uint64(len(rankDigits))
+		}
+
+		// add rank without trailing zeros
+		ranks = append(ranks, Rank(strings.TrimRight(string(buf), "0")))
+	}
+
+	return ranks
+}
+
+func rankMidpoint(lower, upper string) string {
+	// skip common prefix
+	if upper != "" {
+		n := 0
+		for n < len(upper) && rankDigit(lower, n) == rankDigit(upper, n) {
+			n++
+		}
+		if n > 0 {
+			var rest string
+			if n < len(lower) {
+				rest = lower[n:]
+			}
+			return upper[:n] + rankMidpoint(rest, upper[n:])
+		}
+	}
+
+	// get first digits
+	lo := rankDigit(lower, 0)
+	hi := len(rankDigits)
+	if upper != "" {
+		hi = rankDigit(upper, 0)
+	}
+
+	// use middle digit if there is space
+	if hi-lo > 1 {
+		return string(rankDigits[(lo+hi+1)/2])
+	}
+
+	// use first digit of upper if it is followed by more digits
+	if len(upper) > 1 {
+		return upper[:1]
+	}
+
+	// otherwise, append a digit to the first digit of lower
+	var rest string
+	if len(lower) > 0 {
+		rest = lower[1:]
+	}
+
+	return string(rankDigits[lo]) + rankMidpoint(rest, "")
+}
+
+func rankDigit(rank string, i int) int {
+	// pad with zeros
+	if i >= len(rank) {
+		return 0
+	}
+
+	return strings.IndexByte(rankDigits, rank[i])
+}
+
+// Ranking describes a rank field that orders the documents within a scope.
+type Ranking struct {
+	// The rank struct field.
+	Field string
+
+	// The scope struct fields.
+	Scope []string
+}
+
+// AddRanking will register a rank field with the model. Documents that share
+// the same values for the specified scope fields form an ordered list.
+// Documents that are inserted with an empty rank are appended to their list
+// and the list is rebalanced if the appended rank would exceed MaxRankLength.
+// As the rebalance must run in a transaction, inserts return
+// ErrTransactionRequired if a rebalance is needed and no transaction is present.
+// Concurrent appends to the same list may assign duplicate ranks, which are
+// repaired by a rebalance when Manager.Reorder moves a document next to them.
+// Manager.Reorder may be used to move documents within their list.
+//
+// The function also adds an index for the scope and rank fields.
+func AddRanking(model Model, field string, scope ...string) {
+	// get meta
+	meta := GetMeta(model)
+
+	// check field
+	fieldInfo := meta.Fields[field]
+	if fieldInfo == nil || fieldInfo.BSONKey == "" {
+		panic(fmt.Sprintf(`coal: unknown or virtual field "%s"`, field))
+	} else if fieldInfo.Type != rankType {
+		panic(fmt.Sprintf(`coal: rank field "%s" is not of type "coal.Rank"`, field))
+	}
+
+	// check scope
+	for _, name := range scope {
+		if f := meta.Fields[name]; f == nil || f.BSONKey == "" {
+			panic(fmt.Sprintf(`coal: unknown or virtual field "%s"`, name))
+		}
+	}
+
+	// check existing
+	if meta.Ranking != nil {
+		panic(fmt.Sprintf(`coal: ranking already registered on "%s"`, meta.Name))
+	}
+
+	// set ranking
+	meta.Ranking = &Ranking{
+		Field: field,
+		Scope: scope,
+	}
+
+	// add index
+	AddIndex(model, false, 0, append(append([]string{}, scope...), field)...)
+}
+
+// Reorder will move the document with the specified id before or after the
+// target document of the same scope. The updated document is decoded into the
+// provided model, if available. It will return whether the document has been
+// found and ErrInvalidRankTarget if the target is not valid. If the new rank
+// would exceed MaxRankLength or the ranks around the target are not unique,
+// the scope is rebalanced first.
+//
+// A transaction is required.
+func (m *Manager) Reorder(ctx context.Context, model Model, id, target ID, after bool, flags ...Flags) (bool, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Manager.Reorder")
+	span.Tag("id", id.Hex())
+	span.Tag("target", target.Hex())
+	defer span.End()
+
+	// check ranking
+	if m.meta.Ranking == nil {
+		return false, xo.F("model has no ranking")
+	}
+
+	// require transaction
+	if !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
+	// check target
+	if target == id {
+		return false, ErrInvalidRankTarget.Wrap()
+	}
+
+	// load document
+	item, found, err := m.ranked(ctx, bson.M{
+		"_id": id,
+	})
+	if err != nil || !found {
+		return found, err
+	}
+
+	// get scope
+	scope := m.rankScope(item)
+
+	// compute rank
+	rank, ok, err := m.rankAround(ctx, scope, id, target, after)
+	if err != nil {
+		return false, err
+	}
+
+	// rebalance and retry if needed
+	if !ok {
+		_, err = m.Rebalance(ctx, scope)
+		if err != nil {
+			return false, err
+		}
+		rank, ok, err = m.rankAround(ctx, scope, id, target, after)
+		if err != nil {
+			return false, err
+		} else if !ok {
+			return false, xo.F("unable to compute rank")
+		}
+	}
+
+	// update rank
+	return m.Update(ctx, model, id, bson.M{
+		"$set": bson.M{
+			m.meta.Ranking.Field: rank,
+		},
+	}, false, flags...)
+}
+
+// Rebalance will reassign evenly distributed ranks to all documents that match
+// the specified scope filter while preserving their order. Documents with an
+// empty or equal rank are ordered by their id. It returns the number of
+// updated documents.
+//
+// Warning: The operation should be run as part of a transaction.
+func (m *Manager) Rebalance(ctx context.Context, scope bson.M) (int64, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Manager.Rebalance")
+	defer span.End()
+
+	// check ranking
+	if m.meta.Ranking == nil {
+		return 0, xo.F("model has no ranking")
+	}
+
+	// get field
+	field := m.meta.Fields[m.meta.Ranking.Field].BSONKey
+
+	// translate filter
+	filterDoc, err := m.translateFilter(scope)
+	if err != nil {
+		return 0, err
+	}
+
+	// find documents
+	iter, err := m.coll.Find(ctx, filterDoc, options.Find().SetProjection(bson.M{
+		field: 1,
+	}).SetSort(bson.D{
+		{Key: field, Value: 1},
+		{Key: "_id", Value: 1},
+	}))
+	if err != nil {
+		return 0, err
+	}
+
+	// decode documents
+	var list []Model
+	defer iter.Close()
+	for iter.Next() {
+		model := m.meta.Make()
+		err = iter.Decode(model)
+		if err != nil {
+			return 0, err
+		}
+		list = append(list, model)
+	}
+
+	// check error
+	err = iter.Error()
+	if err != nil {
+		return 0, err
+	}
+
+	// update changed documents
+	var updated int64
+	for i, rank := range RankSpread(len(list)) {
+		// check rank
+		if stick.MustGet(list[i], m.meta.Ranking.Field).(Rank) == rank {
+			continue
+		}
+
+		// update document
+		_, err = m.coll.UpdateOne(ctx, bson.M{
+			"_id": list[i].ID(),
+		}, bson.M{
+			"$set": bson.M{
+				field: rank,
+			},
+		})
+		if err != nil {
+			return updated, err
+		}
+
+		updated++
+	}
+
+	return updated, nil
+}
+
+func (m *Manager) rankAround(ctx context.Context, scope bson.M, id, target ID, after bool) (Rank, bool, error) {
+	// get field
+	field := m.meta.Ranking.Field
+
+	// load target
+	filter := bson.M{"_id": target}
+	for key, value := range scope {
+		filter[key] = value
+	}
+	item, found, err := m.ranked(ctx, filter)
+	if err != nil {
+		return "", false, err
+	} else if !found {
+		return "", false, ErrInvalidRankTarget.Wrap()
+	}
+
+	// get rank
+	rank := stick.MustGet(item, field).(Rank)
+	if rank == "" {
+		return "", false, nil
+	}
+
+	// check uniqueness
+	filter = bson.M{"_id": bson.M{"$ne": id}, field: rank}
+	for key, value := range scope {
+		filter[key] = value
+	}
+	filterDoc, err := m.translateFilter(filter)
+	if err != nil {
+		return "", false, err
+	}
+	count, err := m.coll.CountDocuments(ctx, filterDoc, options.Count().SetLimit(2))
+	if err != nil {
+		return "", false, err
+	} else if count > 1 {
+		return "", false, nil
+	}
+
+	// find neighbour
+	op, sort := "$lt", "-"+field
+	if after {
+		op, sort = "$gt", field
+	}
+	filter = bson.M{"_id": bson.M{"$ne": id}, field: bson.M{op: rank}}
+	for key, value := range scope {
+		filter[key] = value
+	}
+	neighbour, found, err := m.ranked(ctx, filter, sort)
+	if err != nil {
+		return "", false, err
+	}
+
+	// get bounds
+	lower, upper := Rank(""), rank
+	if found {
+		lower = stick.MustGet(neighbour, field).(Rank)
+		if lower == "" {
+			return "", false, nil
+		}
+	}
+	if after {
+		lower, upper = rank, ""
+		if found {
+			upper = stick.MustGet(neighbour, field).(Rank)
+		}
+	}
+
+	// compute rank
+	between, err := RankBetween(lower, upper)
+	if err != nil || len(between) > MaxRankLength {
+		return "", false, nil
+	}
+
+	return between, true, nil
+}
+
+func (m *Manager) rankModels(ctx context.Context, models []Model) error {
+	// check ranking
+	ranking := m.meta.Ranking
+	if ranking == nil {
+		return nil
+	}
+
+	// assign missing ranks
+	last := map[string]Rank{}
+	pending := map[string][]Model{}
+	for _, model := range models {
+		// check rank
+		if stick.MustGet(model, ranking.Field).(Rank) != "" {
+			continue
+		}
+
+		// get scope
+		scope := m.rankScope(model)
+		key := fmt.Sprint(scope)
+
+		// load last rank if missing
+		rank, ok := last[key]
+		if !ok {
+			var err error
+			rank, err = m.lastRank(ctx, scope)
+			if err != nil {
+				return err
+			}
+		}
+
+		// compute rank
+		next, err := RankBetween(rank, "")
+		if err != nil {
+			return err
+		}
+
+		// rebalance scope if rank is too long
+		if len(next) > MaxRankLength {
+			// require transaction
+			if !HasTransaction(ctx) {
+				return ErrTransactionRequired.Wrap()
+			}
+
+			// rebalance scope
+			_, err = m.Rebalance(ctx, scope)
+			if err != nil {
+				return err
+			}
+
+			// reload last rank
+			rank, err = m.lastRank(ctx, scope)
+			if err != nil {
+				return err
+			}
+
+			// reassign pending ranks
+			for _, model := range pending[key] {
+				rank, err = RankBetween(rank, "")
+				if err != nil {
+					return err
+				}
+				stick.MustSet(model, ranking.Field, rank)
+			}
+
+			// compute rank
+			next, err = RankBetween(rank, "")
+			if err != nil {
+				return err
+			}
+		}
+
+		// set rank
+		stick.MustSet(model, ranking.Field, next)
+		last[key] = next
+		pending[key] = append(pending[key], model)
+	}
+
+	return nil
+}
+
+func (m *Manager) lastRank(ctx context.Context, scope bson.M) (Rank, error) {
+	// find last document
+	item, found, err := m.ranked(ctx, scope, "-"+m.meta.Ranking.Field)
+	if err != nil || !found {
+		return "", err
+	}
+
+	return stick.MustGet(item, m.meta.Ranking.Field).(Rank), nil
+}
+
+func (m *Manager) rankScope(model Model) bson.M {
+	// collect scope values
+	scope := bson.M{}
+	for _, name := range m.meta.Ranking.Scope {
+		scope[name] = stick.MustGet(model, name)
+	}
+
+	return scope
+}
+
+func (m *Manager) ranked(ctx context.Context, filter bson.M, sort ...string) (Model, bool, error) {
+	// translate filter
+	filterDoc, err := m.translateFilter(filter)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// prepare projection
+	projection := bson.M{
+		m.meta.Fields[m.meta.Ranking.Field].BSONKey: 1,
+	}
+	for _, name := range m.meta.Ranking.Scope {
+		projection[m.meta.Fields[name].BSONKey] = 1
+	}
+
+	// prepare options
+	opts := options.FindOne().SetProjection(projection)
+
+	// set sort
+	if len(sort) > 0 {
+		sortDoc, err := m.trans.Sort(sort)
+		if err != nil {
+			return nil, false, err
+		}
+		opts.SetSort(sortDoc)
+	}
+
+	// find document
+	model := m.meta.Make()
+	err = m.coll.FindOne(ctx, filterDoc, opts).Decode(model)
+	if IsMissing(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return model, true, nil
+}
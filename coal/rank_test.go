@@ -0,0 +1,304 @@
+package coal
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func init() {
+	AddRanking(&itemModel{}, "Rank", "List")
+}
+
+func TestRankValid(t *testing.T) {
+	assert.True(t, Rank("a").Valid())
+	assert.True(t, Rank("0i").Valid())
+	assert.False(t, Rank("").Valid())
+	assert.False(t, Rank("a0").Valid())
+	assert.False(t, Rank("A").Valid())
+	assert.False(t, Rank("a-b").Valid())
+}
+
+func TestRankBetween(t *testing.T) {
+	for _, item := range []struct {
+		lower, upper, rank Rank
+	}{
+		{"", "", "i"},
+		{"", "i", "9"},
+		{"i", "", "r"},
+		{"a", "c", "b"},
+		{"a", "b", "ai"},
+		{"a", "b1", "b"},
+		{"", "1", "0i"},
+		{"az", "b", "azi"},
+		{"a1", "a2", "a1i"},
+		{"z", "", "zi"},
+		{"", "01", "00i"},
+	} {
+		rank, err := RankBetween(item.lower, item.upper)
+		assert.NoError(t, err)
+		assert.Equal(t, item.rank, rank, item)
+		assert.True(t, rank.Valid())
+		assert.True(t, item.lower < rank)
+		if item.upper != "" {
+			assert.True(t, rank < item.upper)
+		}
+	}
+
+	_, err := RankBetween("b", "a")
+	assert.Error(t, err)
+
+	_, err = RankBetween("a", "a")
+	assert.Error(t, err)
+
+	_, err = RankBetween("a0", "")
+	assert.Error(t, err)
+}
+
+func TestRankBetweenRandom(t *testing.T) {
+	ranks := []Rank{"i"}
+	for i := 0; i < 1000; i++ {
+		// pick position
+		pos := rand.Intn(len(ranks) + 1)
+		var lower, upper Rank
+		if pos > 0 {
+			lower = ranks[pos-1]
+		}
+		if pos < len(ranks) {
+			upper = ranks[pos]
+		}
+
+		// insert rank
+		rank, err := RankBetween(lower, upper)
+		assert.NoError(t, err)
+		assert.True(t, rank.Valid())
+		ranks = append(ranks[:pos], append([]Rank{rank}, ranks[pos:]...)...)
+	}
+
+	assert.True(t, sort.SliceIsSorted(ranks, func(i, j int) bool {
+		return ranks[i] < ranks[j]
+	}))
+}
+
+func TestRankSpread(t *testing.T) {
+	assert.Nil(t, RankSpread(0))
+	assert.Equal(t, []Rank{"i"}, RankSpread(1))
+	assert.Equal(t, []Rank{"c", "o"}, RankSpread(2))
+
+	ranks := RankSpread(1000)
+	assert.Len(t, ranks, 1000)
+	for i, rank := range ranks {
+		assert.True(t, rank.Valid())
+		assert.True(t, len(rank) <= 2)
+		if i > 0 {
+			assert.True(t, ranks[i-1] < rank)
+		}
+	}
+}
+
+func TestAddRanking(t *testing.T) {
+	assert.Equal(t, &Ranking{
+		Field: "Rank",
+		Scope: []string{"List"},
+	}, GetMeta(&itemModel{}).Ranking)
+
+	assert.PanicsWithValue(t, `coal: unknown or virtual field "Foo"`, func() {
+		AddRanking(&itemModel{}, "Foo")
+	})
+
+	assert.PanicsWithValue(t, `coal: rank field "Name" is not of type "coal.Rank"`, func() {
+		AddRanking(&itemModel{}, "Name")
+	})
+
+	assert.PanicsWithValue(t, `coal: unknown or virtual field "Foo"`, func() {
+		AddRanking(&itemModel{}, "Rank", "Foo")
+	})
+
+	assert.PanicsWithValue(t, `coal: ranking already registered on "coal.itemModel"`, func() {
+		AddRanking(&itemModel{}, "Rank", "List")
+	})
+}
+
+func TestRankInsert(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		a := tester.Insert(&itemModel{Name: "a", List: "x"}).(*itemModel)
+		assert.Equal(t, Rank("i"), a.Rank)
+
+		b := tester.Insert(&itemModel{Name: "b", List: "x"}).(*itemModel)
+		assert.Equal(t, Rank("r"), b.Rank)
+
+		c := tester.Insert(&itemModel{Name: "c", List: "y"}).(*itemModel)
+		assert.Equal(t, Rank("i"), c.Rank)
+
+		d := &itemModel{Base: B(), Name: "d", List: "x"}
+		e := &itemModel{Base: B(), Name: "e", List: "x"}
+		f := &itemModel{Base: B(), Name: "f", List: "x", Rank: "1"}
+		err := tester.Store.M(&itemModel{}).InsertAll(nil, []Model{d, e, f})
+		assert.NoError(t, err)
+		assert.Equal(t, Rank("w"), d.Rank)
+		assert.Equal(t, Rank("y"), e.Rank)
+		assert.Equal(t, Rank("1"), f.Rank)
+
+		/* rebalance */
+
+		for i := 0; i < 150; i++ {
+			tester.Insert(&itemModel{Name: "z", List: "z"})
+		}
+
+		makeList := func() []Model {
+			var list []Model
+			for i := 0; i < 50; i++ {
+				list = append(list, &itemModel{Base: B(), Name: "z", List: "z"})
+			}
+			return list
+		}
+
+		err = tester.Store.M(&itemModel{}).InsertAll(nil, makeList())
+		assert.True(t, ErrTransactionRequired.Is(err))
+
+		list := makeList()
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			return tester.Store.M(&itemModel{}).InsertAll(ctx, list)
+		})
+		assert.NoError(t, err)
+
+		var items []*itemModel
+		err = tester.Store.M(&itemModel{}).FindAll(nil, &items, bson.M{
+			"List": "z",
+		}, []string{"Rank"}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, items, 200)
+		for i, item := range items {
+			assert.True(t, item.Rank.Valid())
+			assert.True(t, len(item.Rank) <= MaxRankLength)
+			if i > 0 {
+				assert.True(t, items[i-1].Rank < item.Rank)
+			}
+		}
+		assert.Equal(t, list[49].ID(), items[199].ID())
+	})
+}
+
+func TestReorder(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		a := tester.Insert(&itemModel{Name: "a", List: "x"}).(*itemModel)
+		b := tester.Insert(&itemModel{Name: "b", List: "x"}).(*itemModel)
+		c := tester.Insert(&itemModel{Name: "c", List: "x"}).(*itemModel)
+		y := tester.Insert(&itemModel{Name: "y", List: "y"}).(*itemModel)
+
+		manager := tester.Store.M(&itemModel{})
+
+		order := func() string {
+			var list []*itemModel
+			err := manager.FindAll(nil, &list, bson.M{
+				"List": "x",
+			}, []string{"Rank"}, 0, 0, false, NoTransaction)
+			assert.NoError(t, err)
+			var names []string
+			for _, item := range list {
+				names = append(names, item.Name)
+			}
+			return strings.Join(names, "")
+		}
+
+		reorder := func(item, target *itemModel, after bool) (*itemModel, error) {
+			var model itemModel
+			err := tester.Store.T(nil, false, func(ctx context.Context) error {
+				found, err := manager.Reorder(ctx, &model, item.ID(), target.ID(), after)
+				assert.True(t, found || err != nil)
+				return err
+			})
+			return &model, err
+		}
+
+		/* transaction */
+
+		_, err := manager.Reorder(nil, nil, c.ID(), a.ID(), false)
+		assert.True(t, ErrTransactionRequired.Is(err))
+
+		/* move */
+
+		model, err := reorder(c, a, false)
+		assert.NoError(t, err)
+		assert.Equal(t, Rank("9"), model.Rank)
+		assert.Equal(t, "cab", order())
+
+		_, err = reorder(c, a, true)
+		assert.NoError(t, err)
+		assert.Equal(t, "acb", order())
+
+		_, err = reorder(a, b, true)
+		assert.NoError(t, err)
+		assert.Equal(t, "cba", order())
+
+		_, err = reorder(b, a, true)
+		assert.NoError(t, err)
+		assert.Equal(t, "cab", order())
+
+		/* invalid */
+
+		_, err = reorder(a, a, true)
+		assert.True(t, ErrInvalidRankTarget.Is(err))
+
+		_, err = reorder(a, y, true)
+		assert.True(t, ErrInvalidRankTarget.Is(err))
+
+		_, err = reorder(a, &itemModel{Base: B()}, true)
+		assert.True(t, ErrInvalidRankTarget.Is(err))
+
+		/* rebalance */
+
+		for i := 0; i < 100; i++ {
+			_, err = reorder(b, c, true)
+			assert.NoError(t, err)
+			_, err = reorder(a, c, true)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, "cab", order())
+
+		for _, item := range *tester.FindAll(&itemModel{}).(*[]*itemModel) {
+			assert.True(t, item.Rank.Valid())
+			assert.True(t, len(item.Rank) <= MaxRankLength)
+		}
+
+		/* duplicates */
+
+		tester.Update(a, bson.M{"$set": bson.M{"Rank": c.Rank}})
+		tester.Update(b, bson.M{"$set": bson.M{"Rank": c.Rank}})
+
+		_, err = reorder(c, b, true)
+		assert.NoError(t, err)
+		assert.Equal(t, "abc", order())
+	})
+}
+
+func TestRebalance(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		a := tester.Insert(&itemModel{Name: "a", List: "x", Rank: "a"}).(*itemModel)
+		b := tester.Insert(&itemModel{Name: "b", List: "x", Rank: "b"}).(*itemModel)
+		c := tester.Insert(&itemModel{Name: "c", List: "x", Rank: "b"}).(*itemModel)
+		y := tester.Insert(&itemModel{Name: "y", List: "y", Rank: "b"}).(*itemModel)
+
+		n, err := tester.Store.M(&itemModel{}).Rebalance(nil, bson.M{
+			"List": "x",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+
+		assert.Equal(t, Rank("9"), tester.Fetch(&itemModel{}, a.ID()).(*itemModel).Rank)
+		assert.Equal(t, Rank("i"), tester.Fetch(&itemModel{}, b.ID()).(*itemModel).Rank)
+		assert.Equal(t, Rank("r"), tester.Fetch(&itemModel{}, c.ID()).(*itemModel).Rank)
+		assert.Equal(t, Rank("b"), tester.Fetch(&itemModel{}, y.ID()).(*itemModel).Rank)
+
+		n, err = tester.Store.M(&itemModel{}).Rebalance(nil, bson.M{
+			"List": "x",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+	})
+}
@@ -0,0 +1,153 @@
+package coal
+
+import (
+	"context"
+	"time"
+
+	"github.com/256dpi/lungo"
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// ReadPreference defines the members of a replica set that serve reads.
+type ReadPreference string
+
+// The available read preferences.
+const (
+	// Primary reads from the primary.
+	Primary ReadPreference = "primary"
+
+	// PrimaryPreferred reads from the primary if available.
+	PrimaryPreferred ReadPreference = "primaryPreferred"
+
+	// Secondary reads from secondaries.
+	Secondary ReadPreference = "secondary"
+
+	// SecondaryPreferred reads from secondaries if available.
+	SecondaryPreferred ReadPreference = "secondaryPreferred"
+
+	// Nearest reads from the member with the lowest latency.
+	Nearest ReadPreference = "nearest"
+)
+
+// ReadConcern defines the consistency and isolation of reads.
+type ReadConcern string
+
+// The available read concerns.
+const (
+	// Local returns the most recent data of the member.
+	Local ReadConcern = "local"
+
+	// Available returns the most recent data of the member without
+	// guaranteeing causal consistency on sharded clusters.
+	Available ReadConcern = "available"
+
+	// Majority returns data that has been acknowledged by a majority.
+	Majority ReadConcern = "majority"
+
+	// Snapshot returns data from a snapshot of majority committed data.
+	Snapshot ReadConcern = "snapshot"
+)
+
+// ReadOptions defines how reads are served.
+type ReadOptions struct {
+	// The read preference.
+	Preference ReadPreference
+
+	// The maximum replication lag of secondaries that serve reads. Must be
+	// at least 90 seconds if set.
+	MaxStaleness time.Duration
+
+	// The read concern.
+	Concern ReadConcern
+}
+
+type readOptionsKey struct{}
+
+// WithReadOptions will return a context that carries the specified read
+// options. Operations of collections and managers that use the context will
+// apply the options unless a transaction is active.
+//
+// Note: Lungo does not support read preferences and read concerns and the
+// options are ignored.
+func WithReadOptions(ctx context.Context, opts ReadOptions) context.Context {
+	// ensure context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return context.WithValue(ctx, readOptionsKey{}, opts)
+}
+
+// GetReadOptions will return the read options carried by the context.
+func GetReadOptions(ctx context.Context) (ReadOptions, bool) {
+	// check context
+	if ctx == nil {
+		return ReadOptions{}, false
+	}
+
+	// get value
+	opts, ok := ctx.Value(readOptionsKey{}).(ReadOptions)
+
+	return opts, ok
+}
+
+func (c *Collection) read(ctx context.Context) (lungo.ICollection, error) {
+	// get options
+	opts, ok := GetReadOptions(ctx)
+	if !ok || opts == (ReadOptions{}) || HasTransaction(ctx) || c.store == nil || c.store.Lungo() {
+		return c.coll, nil
+	}
+
+	// check cache
+	if coll, ok := c.clones.Load(opts); ok {
+		return coll.(lungo.ICollection), nil
+	}
+
+	// prepare options
+	collOpts := options.Collection()
+
+	// set read preference
+	if opts.Preference != "" || opts.MaxStaleness > 0 {
+		// get mode
+		mode := readpref.PrimaryMode
+		if opts.Preference != "" {
+			var err error
+			mode, err = readpref.ModeFromString(string(opts.Preference))
+			if err != nil {
+				return nil, xo.W(err)
+			}
+		}
+
+		// prepare preference
+		var prefOpts []readpref.Option
+		if opts.MaxStaleness > 0 {
+			prefOpts = append(prefOpts, readpref.WithMaxStaleness(opts.MaxStaleness))
+		}
+		pref, err := readpref.New(mode, prefOpts...)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+
+		// set preference
+		collOpts.SetReadPreference(pref)
+	}
+
+	// set read concern
+	if opts.Concern != "" {
+		collOpts.SetReadConcern(readconcern.New(readconcern.Level(string(opts.Concern))))
+	}
+
+	// clone collection
+	coll, err := c.coll.Clone(collOpts)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	// cache collection
+	c.clones.Store(opts, coll)
+
+	return coll, nil
+}
@@ -0,0 +1,78 @@
+package coal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestReadOptions(t *testing.T) {
+	opts, ok := GetReadOptions(nil)
+	assert.False(t, ok)
+	assert.Zero(t, opts)
+
+	ctx := WithReadOptions(nil, ReadOptions{
+		Preference:   SecondaryPreferred,
+		MaxStaleness: 2 * time.Minute,
+		Concern:      Majority,
+	})
+
+	opts, ok = GetReadOptions(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, ReadOptions{
+		Preference:   SecondaryPreferred,
+		MaxStaleness: 2 * time.Minute,
+		Concern:      Majority,
+	}, opts)
+}
+
+func TestCollectionReadOptions(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		coll := tester.Store.C(&postModel{})
+
+		ctx := WithReadOptions(nil, ReadOptions{
+			Preference: SecondaryPreferred,
+			Concern:    Majority,
+		})
+
+		native, err := coll.read(ctx)
+		assert.NoError(t, err)
+		if tester.Store.Lungo() {
+			assert.Equal(t, coll.Native(), native)
+		} else {
+			assert.NotEqual(t, coll.Native(), native)
+
+			cached, err := coll.read(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, native, cached)
+
+			_, err = coll.read(WithReadOptions(nil, ReadOptions{
+				Preference: "foo",
+			}))
+			assert.Error(t, err)
+		}
+
+		native, err = coll.read(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, coll.Native(), native)
+
+		err = tester.Store.T(ctx, true, func(ctx context.Context) error {
+			native, err := coll.read(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, coll.Native(), native)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		post := tester.Insert(&postModel{Title: "foo"})
+
+		var list []*postModel
+		err = tester.Store.M(&postModel{}).FindAll(ctx, &list, bson.M{}, nil, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+		assert.Equal(t, post.ID(), list[0].ID())
+	})
+}
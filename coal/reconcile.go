@@ -9,6 +9,31 @@ import (
 // After that it will yield all changes to the collection until the returned
 // stream has been closed.
 func Reconcile(store *Store, model Model, loaded func(), created, updated func(Model), deleted func(ID), errored func(error)) *Stream {
+	return ReconcileWithCheckpoint(store, model, nil, loaded, created, updated, deleted, errored)
+}
+
+// ReconcileWithCheckpoint is similar to Reconcile but persists the resume token
+// using the provided checkpoint. If the checkpoint holds a token, the initial
+// load is skipped and only changes since the checkpoint are yielded. If the
+// token has expired from the oplog, existing models are loaded again and
+// yielded as created.
+func ReconcileWithCheckpoint(store *Store, model Model, checkpoint *Checkpoint, loaded func(), created, updated func(Model), deleted func(ID), errored func(error)) *Stream {
+	// prepare receiver
+	receiver := reconciler(store, model, loaded, created, updated, deleted, errored)
+
+	// open stream
+	return openStream(store, model, nil, nil, true, checkpoint, func(event Event, id ID, model Model, _ *Change, err error, token []byte) error {
+		return receiver(event, id, model, err, token)
+	})
+}
+
+// ReconcileWithHub is similar to Reconcile but uses a subscription to the
+// shared stream of the provided hub.
+func ReconcileWithHub(hub *Hub, model Model, loaded func(), created, updated func(Model), deleted func(ID), errored func(error)) *Subscription {
+	return hub.Subscribe(model, SubscriptionOptions{}, reconciler(hub.store, model, loaded, created, updated, deleted, errored))
+}
+
+func reconciler(store *Store, model Model, loaded func(), created, updated func(Model), deleted func(ID), errored func(error)) Receiver {
 	// prepare load
 	load := func() error {
 		// get cursor
@@ -27,6 +52,12 @@ func Reconcile(store *Store, model Model, loaded func(), created, updated func(M
 				return err
 			}
 
+			// decrypt model
+			err = store.M(model).decryptModel(model)
+			if err != nil {
+				return err
+			}
+
 			// call callback if available
 			if created != nil {
 				created(model)
@@ -47,11 +78,18 @@ func Reconcile(store *Store, model Model, loaded func(), created, updated func(M
 		return nil
 	}
 
-	// open stream
-	stream := OpenStream(store, model, nil, func(event Event, id ID, model Model, err error, bytes []byte) error {
+	return func(event Event, id ID, model Model, err error, token []byte) error {
 		// handle events
 		switch event {
 		case Opened:
+			// skip load if resumed from checkpoint
+			if token != nil {
+				if loaded != nil {
+					loaded()
+				}
+				return nil
+			}
+
 			return load()
 		case Created:
 			// call callback if available
@@ -76,7 +114,5 @@ func Reconcile(store *Store, model Model, loaded func(), created, updated func(M
 		}
 
 		return nil
-	})
-
-	return stream
+	}
 }
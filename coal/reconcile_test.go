@@ -48,3 +48,48 @@ func TestReconcile(t *testing.T) {
 		stream.Close()
 	})
 }
+
+func TestReconcileWithHub(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(10 * time.Millisecond)
+
+		hub := NewHub(tester.Store)
+
+		post := &postModel{
+			Base:  B(),
+			Title: "foo",
+		}
+
+		open := make(chan struct{})
+		done := make(chan struct{})
+
+		sub := ReconcileWithHub(hub, &postModel{}, func() {
+			close(open)
+		}, func(model Model) {
+			assert.Equal(t, post.ID(), model.ID())
+			assert.Equal(t, "foo", model.(*postModel).Title)
+		}, func(model Model) {
+			assert.Equal(t, post.ID(), model.ID())
+			assert.Equal(t, "bar", model.(*postModel).Title)
+		}, func(id ID) {
+			assert.Equal(t, post.ID(), id)
+			close(done)
+		}, func(err error) {
+			panic(err)
+		})
+
+		<-open
+
+		tester.Insert(post)
+
+		post.Title = "bar"
+		tester.Replace(post)
+
+		tester.Delete(post)
+
+		<-done
+
+		sub.Close()
+		hub.Close()
+	})
+}
@@ -0,0 +1,59 @@
+package coal
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Ref is a reference to a document of a specific type. It is used as the value
+// of polymorphic to-one and to-many relationships.
+type Ref struct {
+	Type string `json:"type" bson:"type"`
+	ID   ID     `json:"id" bson:"id"`
+}
+
+// R is a shorthand to construct a reference to the provided model.
+func R(model Model) Ref {
+	return Ref{
+		Type: GetMeta(model).PluralName,
+		ID:   model.ID(),
+	}
+}
+
+// IsZero returns whether the reference is zero.
+func (r Ref) IsZero() bool {
+	return r.Type == "" && r.ID.IsZero()
+}
+
+// ToRef will convert a decoded document value to a reference. It returns false
+// if the value is not a reference.
+func ToRef(value interface{}) (Ref, bool) {
+	// handle values
+	switch value := value.(type) {
+	case Ref:
+		return value, true
+	case *Ref:
+		if value == nil {
+			return Ref{}, false
+		}
+		return *value, true
+	case bson.D:
+		var ref Ref
+		for _, e := range value {
+			switch e.Key {
+			case "type":
+				ref.Type, _ = e.Value.(string)
+			case "id":
+				ref.ID, _ = e.Value.(ID)
+			}
+		}
+		return ref, ref.Type != "" && !ref.ID.IsZero()
+	case bson.M:
+		return ToRef(map[string]interface{}(value))
+	case map[string]interface{}:
+		typ, _ := value["type"].(string)
+		id, _ := value["id"].(ID)
+		return Ref{Type: typ, ID: id}, typ != "" && !id.IsZero()
+	default:
+		return Ref{}, false
+	}
+}
@@ -0,0 +1,90 @@
+package coal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type refModel struct {
+	Base    `json:"-" bson:",inline" coal:"refs"`
+	Subject Ref   `json:"-" bson:"subject" coal:"subject:posts|notes"`
+	Targets []Ref `json:"-" bson:"targets" coal:"targets:posts|notes"`
+	stick.NoValidation
+}
+
+func TestR(t *testing.T) {
+	post := &postModel{Base: B()}
+	assert.Equal(t, Ref{Type: "posts", ID: post.ID()}, R(post))
+	assert.False(t, R(post).IsZero())
+	assert.True(t, Ref{}.IsZero())
+}
+
+func TestToRef(t *testing.T) {
+	id := New()
+
+	ref, ok := ToRef(Ref{Type: "posts", ID: id})
+	assert.True(t, ok)
+	assert.Equal(t, Ref{Type: "posts", ID: id}, ref)
+
+	ref, ok = ToRef(&Ref{Type: "posts", ID: id})
+	assert.True(t, ok)
+	assert.Equal(t, Ref{Type: "posts", ID: id}, ref)
+
+	ref, ok = ToRef(bson.D{{Key: "type", Value: "posts"}, {Key: "id", Value: id}})
+	assert.True(t, ok)
+	assert.Equal(t, Ref{Type: "posts", ID: id}, ref)
+
+	ref, ok = ToRef(bson.M{"type": "posts", "id": id})
+	assert.True(t, ok)
+	assert.Equal(t, Ref{Type: "posts", ID: id}, ref)
+
+	_, ok = ToRef((*Ref)(nil))
+	assert.False(t, ok)
+
+	_, ok = ToRef(id)
+	assert.False(t, ok)
+}
+
+func TestRefQuery(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		post := tester.Insert(&postModel{}).(*postModel)
+		note := tester.Insert(&noteModel{}).(*noteModel)
+
+		model1 := tester.Insert(&refModel{
+			Subject: R(post),
+			Targets: []Ref{R(post), R(note)},
+		}).(*refModel)
+		model2 := tester.Insert(&refModel{
+			Subject: R(note),
+			Targets: []Ref{R(note)},
+		}).(*refModel)
+
+		var list []*refModel
+		err := tester.Store.M(&refModel{}).FindAll(nil, &list, bson.M{
+			"Subject": R(post),
+		}, nil, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, []*refModel{model1}, list)
+
+		err = tester.Store.M(&refModel{}).FindAll(nil, &list, bson.M{
+			"Targets": bson.M{
+				"$in": []Ref{R(note)},
+			},
+		}, []string{"_id"}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, []*refModel{model1, model2}, list)
+
+		values, err := tester.Store.M(&refModel{}).ProjectAll(nil, bson.M{}, "Subject", nil, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		ref, ok := ToRef(values[model1.ID()])
+		assert.True(t, ok)
+		assert.Equal(t, R(post), ref)
+		ref, ok = ToRef(values[model2.ID()])
+		assert.True(t, ok)
+		assert.Equal(t, R(note), ref)
+	})
+}
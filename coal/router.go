@@ -0,0 +1,80 @@
+package coal
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/256dpi/xo"
+)
+
+// ErrCrossStoreTransaction is returned if an operation uses a transaction that
+// has been created by a store with a different client.
+var ErrCrossStoreTransaction = xo.BF("transaction spans multiple stores")
+
+// Router routes models to stores using the database declared by the model or
+// a routing table.
+type Router struct {
+	stores map[string]*Store
+	routes map[*Meta]string
+	mutex  sync.RWMutex
+}
+
+// NewRouter will create and return a new router.
+func NewRouter() *Router {
+	return &Router{
+		stores: map[string]*Store{},
+		routes: map[*Meta]string{},
+	}
+}
+
+// Add will add the store for the specified database.
+func (r *Router) Add(database string, store *Store) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// add store
+	r.stores[database] = store
+}
+
+// Route will route the specified model to the specified database, overriding
+// the database declared by the model. An empty database routes the model to
+// the store it is requested from.
+func (r *Router) Route(model Model, database string) {
+	// acquire mutex
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// add route
+	r.routes[GetMeta(model)] = database
+}
+
+// Lookup will return the store for the specified model or nil if the model
+// does not specify a database.
+//
+// Note: This method panics if no store has been added for the database.
+func (r *Router) Lookup(model Model) *Store {
+	// get meta
+	meta := GetMeta(model)
+
+	// acquire mutex
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	// get database
+	database, ok := r.routes[meta]
+	if !ok {
+		database = meta.Database
+	}
+	if database == "" {
+		return nil
+	}
+
+	// get store
+	store := r.stores[database]
+	if store == nil {
+		panic(fmt.Sprintf(`coal: missing store for database "%s"`, database))
+	}
+
+	return store
+}
@@ -0,0 +1,89 @@
+package coal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/256dpi/xo"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type logModel struct {
+	Base    `json:"-" bson:",inline" coal:"logs:logs:logs"`
+	Message string
+	stick.NoValidation
+}
+
+var logStore = MustOpen(nil, "test-fire-coal-logs", xo.Panic)
+
+func TestRouter(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		assert.Equal(t, "logs", GetMeta(&logModel{}).Database)
+		assert.Equal(t, "", GetMeta(&postModel{}).Database)
+
+		store := NewStore(tester.Store.Client(), tester.Store.defDB, nil, nil)
+		assert.Equal(t, store, store.S(&logModel{}))
+
+		router := NewRouter()
+		store.SetRouter(router)
+
+		assert.PanicsWithValue(t, `coal: missing store for database "logs"`, func() {
+			store.S(&logModel{})
+		})
+
+		router.Add("logs", logStore)
+		assert.Equal(t, logStore, store.S(&logModel{}))
+		assert.Equal(t, logStore.C(&logModel{}), store.C(&logModel{}))
+		assert.Equal(t, logStore.M(&logModel{}), store.M(&logModel{}))
+		assert.Equal(t, store, store.S(&postModel{}))
+
+		_, err := logStore.C(&logModel{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		err = store.M(&logModel{}).Insert(nil, &logModel{Base: B(), Message: "foo"})
+		assert.NoError(t, err)
+
+		n, err := logStore.C(&logModel{}).CountDocuments(nil, bson.M{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		n, err = tester.Store.DB().Collection("logs").CountDocuments(nil, bson.M{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+
+		router.Route(&postModel{}, "logs")
+		assert.Equal(t, logStore, store.S(&postModel{}))
+
+		router.Route(&logModel{}, "")
+		assert.Equal(t, store, store.S(&logModel{}))
+	})
+}
+
+func TestCrossStoreTransaction(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		router := NewRouter()
+		router.Add("logs", logStore)
+
+		store := NewStore(tester.Store.Client(), tester.Store.defDB, nil, nil)
+		store.SetRouter(router)
+
+		err := store.T(nil, false, func(ctx context.Context) error {
+			return store.M(&logModel{}).Insert(ctx, &logModel{Base: B()})
+		})
+		assert.True(t, ErrCrossStoreTransaction.Is(err))
+
+		err = store.S(&logModel{}).T(nil, false, func(ctx context.Context) error {
+			return store.M(&logModel{}).Insert(ctx, &logModel{Base: B()})
+		})
+		assert.NoError(t, err)
+
+		err = store.S(&logModel{}).T(nil, false, func(ctx context.Context) error {
+			_, err := store.M(&postModel{}).Find(ctx, &postModel{}, New(), false)
+			return err
+		})
+		assert.True(t, ErrCrossStoreTransaction.Is(err))
+	})
+}
@@ -0,0 +1,385 @@
+package coal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// ValidationLevel defines how strictly MongoDB applies a schema validator.
+type ValidationLevel string
+
+// The available validation levels.
+const (
+	// Strict applies the validator to all inserts and updates.
+	Strict ValidationLevel = "strict"
+
+	// Moderate applies the validator to inserts and updates of documents that
+	// already fulfill the validation criteria.
+	Moderate ValidationLevel = "moderate"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var marshalerType = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+var valueMarshalerType = reflect.TypeOf((*bson.ValueMarshaler)(nil)).Elem()
+
+var bsonTypeAliases = map[bsontype.Type]string{
+	bsontype.Double:           "double",
+	bsontype.String:           "string",
+	bsontype.EmbeddedDocument: "object",
+	bsontype.Array:            "array",
+	bsontype.Binary:           "binData",
+	bsontype.ObjectID:         "objectId",
+	bsontype.Boolean:          "bool",
+	bsontype.DateTime:         "date",
+	bsontype.Null:             "null",
+	bsontype.Regex:            "regex",
+	bsontype.Int32:            "int",
+	bsontype.Timestamp:        "timestamp",
+	bsontype.Int64:            "long",
+	bsontype.Decimal128:       "decimal",
+}
+
+// Schema will derive a "$jsonSchema" document from the database fields of the
+// specified model. Non-optional fields without the "omitempty" option are
+// required and system fields are included.
+func Schema(model Model) bson.M {
+	// get meta
+	meta := GetMeta(model)
+
+	// prepare properties and required fields
+	properties := bson.M{
+		"_id": bson.M{"bsonType": "objectId"},
+		"_lk": bson.M{"bsonType": "long"},
+		"_tk": bson.M{"bsonType": "objectId"},
+		"_sc": bson.M{"bsonType": "double"},
+	}
+	required := []string{"_id"}
+
+	// add database fields
+	for key, field := range meta.DatabaseFields {
+		// add property
+		properties[key] = typeSchema(field.Type)
+
+		// check if required
+		if !field.Optional && !omitEmpty(meta.Type.Field(field.Index).Tag) {
+			required = append(required, key)
+		}
+	}
+
+	// sort required fields
+	sort.Strings(required)
+
+	return bson.M{
+		"bsonType":   "object",
+		"required":   required,
+		"properties": properties,
+	}
+}
+
+// ApplySchema will apply the schema of the specified models to their
+// collections using the "collMod" command and the provided validation level.
+// Missing collections are created.
+//
+// Note: Lungo does not support schema validation and ApplySchema is a no-op.
+func ApplySchema(ctx context.Context, store *Store, level ValidationLevel, models ...Model) error {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/ApplySchema")
+	defer span.End()
+
+	// check lungo
+	if store.Lungo() {
+		return nil
+	}
+
+	// apply schemas
+	for _, model := range models {
+		// get database and collection
+		db := store.S(model).DB()
+		collection := GetMeta(model).Collection
+
+		// ensure collection
+		err := db.CreateCollection(ctx, collection)
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceExists" {
+			err = nil
+		}
+		if err != nil {
+			return xo.W(err)
+		}
+
+		// apply validator
+		err = db.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: collection},
+			{Key: "validator", Value: bson.M{"$jsonSchema": Schema(model)}},
+			{Key: "validationLevel", Value: string(level)},
+			{Key: "validationAction", Value: "error"},
+		}).Err()
+		if err != nil {
+			return xo.W(err)
+		}
+	}
+
+	return nil
+}
+
+// SchemaViolation describes a document that does not match the schema of its
+// model.
+type SchemaViolation struct {
+	// The document id.
+	ID ID
+
+	// The violation messages.
+	Errors []string
+}
+
+// CheckSchema will check all documents of the specified model against the
+// schema derived by Schema and return a report of the violating documents.
+func CheckSchema(ctx context.Context, store *Store, model Model) ([]SchemaViolation, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/CheckSchema")
+	defer span.End()
+
+	// get schema
+	schema := Schema(model)
+
+	// find documents
+	iter, err := store.C(model).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	// ensure close
+	defer iter.Close()
+
+	// check documents
+	var violations []SchemaViolation
+	for iter.Next() {
+		// decode document
+		var doc bson.Raw
+		err = iter.Decode(&doc)
+		if err != nil {
+			return nil, err
+		}
+
+		// validate document
+		errs := validateSchema(schema, "", bson.RawValue{
+			Type:  bsontype.EmbeddedDocument,
+			Value: doc,
+		})
+		if len(errs) == 0 {
+			continue
+		}
+
+		// sort errors
+		sort.Strings(errs)
+
+		// add violation
+		id, _ := doc.Lookup("_id").ObjectIDOK()
+		violations = append(violations, SchemaViolation{
+			ID:     id,
+			Errors: errs,
+		})
+	}
+
+	// check error
+	err = iter.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	return violations, nil
+}
+
+func typeSchema(typ reflect.Type) bson.M {
+	// check custom marshaller
+	if typ.Implements(marshalerType) || typ.Implements(valueMarshalerType) ||
+		reflect.PtrTo(typ).Implements(marshalerType) || reflect.PtrTo(typ).Implements(valueMarshalerType) {
+		return bson.M{}
+	}
+
+	// handle pointers
+	if typ.Kind() == reflect.Ptr {
+		schema := typeSchema(typ.Elem())
+		return nullable(schema)
+	}
+
+	// handle known types
+	switch typ {
+	case toOneType:
+		return bson.M{"bsonType": "objectId"}
+	case timeType:
+		return bson.M{"bsonType": "date"}
+	case decimalType:
+		return bson.M{"bsonType": "decimal"}
+	case bytesType:
+		return bson.M{"bsonType": bson.A{"binData", "null"}}
+	}
+
+	// handle kinds
+	switch typ.Kind() {
+	case reflect.String:
+		return bson.M{"bsonType": "string"}
+	case reflect.Bool:
+		return bson.M{"bsonType": "bool"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return bson.M{"bsonType": bson.A{"int", "long"}}
+	case reflect.Float32, reflect.Float64:
+		return bson.M{"bsonType": "double"}
+	case reflect.Slice:
+		return bson.M{"bsonType": bson.A{"array", "null"}, "items": typeSchema(typ.Elem())}
+	case reflect.Array:
+		return bson.M{"bsonType": "array", "items": typeSchema(typ.Elem())}
+	case reflect.Map:
+		return bson.M{"bsonType": bson.A{"object", "null"}}
+	case reflect.Struct:
+		// collect properties
+		properties := bson.M{}
+		required := []string{}
+		for i := 0; i < typ.NumField(); i++ {
+			// get field
+			field := typ.Field(i)
+			key := stick.BSON.GetKey(field)
+			if key == "" || !field.IsExported() {
+				continue
+			}
+
+			// add property
+			properties[key] = typeSchema(field.Type)
+
+			// check if required
+			if field.Type.Kind() != reflect.Ptr && !omitEmpty(field.Tag) {
+				required = append(required, key)
+			}
+		}
+
+		// prepare schema
+		schema := bson.M{"bsonType": "object", "properties": properties}
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+
+		return schema
+	default:
+		return bson.M{}
+	}
+}
+
+func nullable(schema bson.M) bson.M {
+	// add null to types
+	switch types := schema["bsonType"].(type) {
+	case string:
+		schema["bsonType"] = bson.A{types, "null"}
+	case bson.A:
+		if !hasType(types, "null") {
+			schema["bsonType"] = append(types, "null")
+		}
+	}
+
+	return schema
+}
+
+func omitEmpty(tag reflect.StructTag) bool {
+	// check options
+	options := strings.Split(tag.Get("bson"), ",")
+	return stick.Contains(options[1:], "omitempty")
+}
+
+func validateSchema(schema bson.M, path string, value bson.RawValue) []string {
+	// prepare errors
+	var errs []string
+
+	// prepare name
+	name := path
+	if name == "" {
+		name = "document"
+	}
+
+	// check type
+	var types []interface{}
+	switch bsonType := schema["bsonType"].(type) {
+	case string:
+		types = bson.A{bsonType}
+	case bson.A:
+		types = bsonType
+	}
+	if len(types) > 0 && !hasType(types, bsonTypeAliases[value.Type]) {
+		return append(errs, fmt.Sprintf("%s: expected %s, got %s", name, joinTypes(types), bsonTypeAliases[value.Type]))
+	}
+
+	// check document
+	if value.Type == bsontype.EmbeddedDocument {
+		// get document
+		doc := value.Document()
+
+		// check required fields
+		required, _ := schema["required"].([]string)
+		for _, key := range required {
+			if _, err := doc.LookupErr(key); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: missing required field", join(path, key)))
+			}
+		}
+
+		// check properties
+		properties, _ := schema["properties"].(bson.M)
+		elements, _ := doc.Elements()
+		for _, element := range elements {
+			if sub, ok := properties[element.Key()].(bson.M); ok {
+				errs = append(errs, validateSchema(sub, join(path, element.Key()), element.Value())...)
+			}
+		}
+	}
+
+	// check array
+	if value.Type == bsontype.Array {
+		if items, ok := schema["items"].(bson.M); ok {
+			values, _ := value.Array().Values()
+			for i, item := range values {
+				errs = append(errs, validateSchema(items, join(path, fmt.Sprintf("%d", i)), item)...)
+			}
+		}
+	}
+
+	return errs
+}
+
+func hasType(types []interface{}, typ string) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+
+	return false
+}
+
+func joinTypes(types []interface{}) string {
+	// convert types
+	list := make([]string, 0, len(types))
+	for _, typ := range types {
+		list = append(list, typ.(string))
+	}
+
+	return strings.Join(list, " or ")
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
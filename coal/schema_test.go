@@ -0,0 +1,138 @@
+package coal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type schemaModel struct {
+	Base  `json:"-" bson:",inline" coal:"schemas"`
+	Name  string
+	Count int64
+	Rate  float64    `bson:",omitempty"`
+	Tags  []string   `bson:"tags"`
+	Time  *time.Time `bson:"time"`
+	Meta  struct {
+		Key   string
+		Value *bool
+	}
+	Data               []byte `bson:",omitempty"`
+	Parent             *ID    `coal:"parent:schemas"`
+	Children           []ID   `coal:"children:schemas"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+func TestSchema(t *testing.T) {
+	assert.Equal(t, bson.M{
+		"bsonType": "object",
+		"required": []string{"_id", "children", "count", "meta", "name", "tags"},
+		"properties": bson.M{
+			"_id":  bson.M{"bsonType": "objectId"},
+			"_lk":  bson.M{"bsonType": "long"},
+			"_tk":  bson.M{"bsonType": "objectId"},
+			"_sc":  bson.M{"bsonType": "double"},
+			"name": bson.M{"bsonType": "string"},
+			"count": bson.M{
+				"bsonType": bson.A{"int", "long"},
+			},
+			"rate": bson.M{"bsonType": "double"},
+			"tags": bson.M{
+				"bsonType": bson.A{"array", "null"},
+				"items":    bson.M{"bsonType": "string"},
+			},
+			"time": bson.M{
+				"bsonType": bson.A{"date", "null"},
+			},
+			"meta": bson.M{
+				"bsonType": "object",
+				"required": []string{"key"},
+				"properties": bson.M{
+					"key": bson.M{"bsonType": "string"},
+					"value": bson.M{
+						"bsonType": bson.A{"bool", "null"},
+					},
+				},
+			},
+			"data": bson.M{
+				"bsonType": bson.A{"binData", "null"},
+			},
+			"parent": bson.M{
+				"bsonType": bson.A{"objectId", "null"},
+			},
+			"children": bson.M{
+				"bsonType": bson.A{"array", "null"},
+				"items":    bson.M{"bsonType": "objectId"},
+			},
+		},
+	}, Schema(&schemaModel{}))
+}
+
+func TestApplySchema(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		defer func() {
+			_ = tester.Store.C(&schemaModel{}).Native().Drop(nil)
+		}()
+
+		err := ApplySchema(nil, tester.Store, Strict, &schemaModel{})
+		assert.NoError(t, err)
+
+		err = ApplySchema(nil, tester.Store, Moderate, &schemaModel{})
+		assert.NoError(t, err)
+
+		err = tester.Store.M(&schemaModel{}).Insert(nil, &schemaModel{
+			Name: "Foo",
+		})
+		assert.NoError(t, err)
+
+		_, err = tester.Store.C(&schemaModel{}).InsertOne(nil, bson.M{
+			"name": 42,
+		})
+		if tester.Store.Lungo() {
+			assert.NoError(t, err)
+		} else {
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestCheckSchema(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		note := tester.Insert(&noteModel{
+			Title: "Hello",
+			Post:  New(),
+		}).(*noteModel)
+
+		violations, err := CheckSchema(nil, tester.Store, &noteModel{})
+		assert.NoError(t, err)
+		assert.Empty(t, violations)
+
+		id := New()
+		_, err = tester.Store.C(&noteModel{}).InsertOne(nil, bson.M{
+			"_id":        id,
+			"title":      42,
+			"created_at": time.Now(),
+			"updated_at": "yesterday",
+		})
+		assert.NoError(t, err)
+
+		violations, err = CheckSchema(nil, tester.Store, &noteModel{})
+		assert.NoError(t, err)
+		assert.Equal(t, []SchemaViolation{
+			{
+				ID: id,
+				Errors: []string{
+					"post_id: missing required field",
+					"title: expected string, got int",
+					"updated_at: expected date, got string",
+				},
+			},
+		}, violations)
+
+		tester.Delete(note)
+	})
+}
@@ -0,0 +1,225 @@
+package coal
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// Sequence describes a named sequence of numbers that is optionally scoped and
+// formatted.
+type Sequence struct {
+	// The name of the sequence. It must not contain a colon.
+	Name string
+
+	// The optional function that returns the scope of a document (e.g. the
+	// year of creation). Every scope maintains a separate counter.
+	Scope func(Model) string
+
+	// The optional format that is used with fmt.Sprintf to format the scope
+	// (if configured) and the number (e.g. "INV-%s-%04d").
+	//
+	// Default: "%s-%d" if a scope is configured, otherwise "%d".
+	Format string
+}
+
+// Sequences provides atomic sequence counters that are stored in a
+// collection. If the counters are incremented as part of a transaction, the
+// increments are rolled back with the transaction which keeps the sequences
+// free of gaps. Concurrent transactions that increment the same counter will
+// conflict and all but one will be aborted.
+type Sequences struct {
+	store      *Store
+	collection string
+}
+
+// NewSequences will create and return sequences that are stored in the
+// specified collection.
+func NewSequences(store *Store, collection string) *Sequences {
+	return &Sequences{
+		store:      store,
+		collection: collection,
+	}
+}
+
+// Next will increment the counter of the named sequence and scope and return
+// the new number. The first number of a sequence is 1.
+func (s *Sequences) Next(ctx context.Context, name, scope string) (int64, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Sequences.Next")
+	span.Tag("name", name)
+	span.Tag("scope", scope)
+	defer span.End()
+
+	// get key
+	key, err := sequenceKey(name, scope)
+	if err != nil {
+		return 0, err
+	}
+
+	// increment counter
+	var doc struct {
+		Value int64 `bson:"value"`
+	}
+	err = s.store.DB().Collection(s.collection).FindOneAndUpdate(ctx, bson.M{
+		"_id": key,
+	}, bson.M{
+		"$inc": bson.M{
+			"value": 1,
+		},
+		"$set": bson.M{
+			"name":    name,
+			"scope":   scope,
+			"updated": time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&doc)
+	if err != nil {
+		return 0, xo.W(err)
+	}
+
+	return doc.Value, nil
+}
+
+// Current will return the current number of the named sequence and scope. It
+// returns zero if the counter does not exist.
+func (s *Sequences) Current(ctx context.Context, name, scope string) (int64, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Sequences.Current")
+	span.Tag("name", name)
+	span.Tag("scope", scope)
+	defer span.End()
+
+	// get key
+	key, err := sequenceKey(name, scope)
+	if err != nil {
+		return 0, err
+	}
+
+	// find counter
+	var doc struct {
+		Value int64 `bson:"value"`
+	}
+	err = s.store.DB().Collection(s.collection).FindOne(ctx, bson.M{
+		"_id": key,
+	}).Decode(&doc)
+	if IsMissing(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, xo.W(err)
+	}
+
+	return doc.Value, nil
+}
+
+// Set will set the current number of the named sequence and scope. The next
+// number will be the provided number plus one.
+func (s *Sequences) Set(ctx context.Context, name, scope string, value int64) error {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Sequences.Set")
+	span.Tag("name", name)
+	span.Tag("scope", scope)
+	defer span.End()
+
+	// get key
+	key, err := sequenceKey(name, scope)
+	if err != nil {
+		return err
+	}
+
+	// upsert counter
+	_, err = s.store.DB().Collection(s.collection).UpdateOne(ctx, bson.M{
+		"_id": key,
+	}, bson.M{
+		"$set": bson.M{
+			"name":    name,
+			"scope":   scope,
+			"value":   value,
+			"updated": time.Now(),
+		},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return xo.W(err)
+	}
+
+	return nil
+}
+
+// Assign will increment the specified sequence for the scope of the model and
+// assign the number to the specified field. Integer fields receive the plain
+// number while string fields receive the formatted number.
+func (s *Sequences) Assign(ctx context.Context, sequence Sequence, model Model, field string) error {
+	// get field
+	value := stick.MustGetRaw(model, field)
+
+	// check field
+	switch value.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.String:
+	default:
+		return xo.F("sequence field %q is not an integer or string", field)
+	}
+
+	// get scope
+	var scope string
+	if sequence.Scope != nil {
+		scope = sequence.Scope(model)
+	}
+
+	// get number
+	number, err := s.Next(ctx, sequence.Name, scope)
+	if err != nil {
+		return err
+	}
+
+	// set integer
+	if value.Kind() != reflect.String {
+		value.SetInt(number)
+		return nil
+	}
+
+	// set string
+	value.SetString(sequence.Render(scope, number))
+
+	return nil
+}
+
+// Render will format the provided scope and number using the sequence format.
+func (s Sequence) Render(scope string, number int64) string {
+	// format scoped number
+	if s.Scope != nil {
+		format := s.Format
+		if format == "" {
+			format = "%s-%d"
+		}
+		return fmt.Sprintf(format, scope, number)
+	}
+
+	// get format
+	format := s.Format
+	if format == "" {
+		format = "%d"
+	}
+
+	return fmt.Sprintf(format, number)
+}
+
+func sequenceKey(name, scope string) (string, error) {
+	// check name
+	if strings.Contains(name, ":") {
+		return "", xo.F("invalid sequence name %q", name)
+	}
+
+	// check scope
+	if scope == "" {
+		return name, nil
+	}
+
+	return name + ":" + scope, nil
+}
@@ -0,0 +1,160 @@
+package coal
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/256dpi/xo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type invoiceModel struct {
+	Base   `json:"-" bson:",inline" coal:"invoices"`
+	Year   int
+	Number string
+	Index  int64
+	Flag   bool
+	stick.NoValidation
+}
+
+func TestSequences(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		_, _ = tester.Store.DB().Collection("sequences").DeleteMany(nil, struct{}{})
+
+		sequences := NewSequences(tester.Store, "sequences")
+
+		n, err := sequences.Current(nil, "foo", "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+
+		n, err = sequences.Next(nil, "foo", "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		n, err = sequences.Next(nil, "foo", "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+
+		n, err = sequences.Next(nil, "foo", "bar")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		n, err = sequences.Current(nil, "foo", "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+
+		_, err = sequences.Next(nil, "foo:bar", "")
+		assert.Error(t, err)
+		assert.Equal(t, `invalid sequence name "foo:bar"`, err.Error())
+
+		err = sequences.Set(nil, "foo", "", 41)
+		assert.NoError(t, err)
+
+		n, err = sequences.Next(nil, "foo", "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), n)
+
+		/* transaction */
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			n, err := sequences.Next(ctx, "foo", "")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(43), n)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			n, err := sequences.Next(ctx, "foo", "")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(44), n)
+			return xo.F("foo")
+		})
+		assert.Error(t, err)
+
+		n, err = sequences.Current(nil, "foo", "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(43), n)
+
+		/* concurrency */
+
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		numbers := map[int64]bool{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				n, err := sequences.Next(nil, "baz", "")
+				assert.NoError(t, err)
+				mutex.Lock()
+				numbers[n] = true
+				mutex.Unlock()
+			}()
+		}
+		wg.Wait()
+		assert.Len(t, numbers, 10)
+		for i := int64(1); i <= 10; i++ {
+			assert.True(t, numbers[i])
+		}
+	})
+}
+
+func TestSequencesAssign(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		_, _ = tester.Store.DB().Collection("sequences").DeleteMany(nil, struct{}{})
+
+		sequences := NewSequences(tester.Store, "sequences")
+
+		invoices := Sequence{
+			Name: "invoices",
+			Scope: func(model Model) string {
+				return strconv.Itoa(model.(*invoiceModel).Year)
+			},
+			Format: "INV-%s-%04d",
+		}
+
+		invoice := &invoiceModel{Year: 2026}
+		err := sequences.Assign(nil, invoices, invoice, "Number")
+		assert.NoError(t, err)
+		assert.Equal(t, "INV-2026-0001", invoice.Number)
+
+		invoice = &invoiceModel{Year: 2026}
+		err = sequences.Assign(nil, invoices, invoice, "Number")
+		assert.NoError(t, err)
+		assert.Equal(t, "INV-2026-0002", invoice.Number)
+
+		invoice = &invoiceModel{Year: 2027}
+		err = sequences.Assign(nil, invoices, invoice, "Number")
+		assert.NoError(t, err)
+		assert.Equal(t, "INV-2027-0001", invoice.Number)
+
+		err = sequences.Assign(nil, Sequence{Name: "plain"}, invoice, "Index")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), invoice.Index)
+
+		err = sequences.Assign(nil, Sequence{Name: "plain"}, invoice, "Number")
+		assert.NoError(t, err)
+		assert.Equal(t, "2", invoice.Number)
+
+		err = sequences.Assign(nil, Sequence{Name: "plain"}, invoice, "Flag")
+		assert.Error(t, err)
+		assert.Equal(t, `sequence field "Flag" is not an integer or string`, err.Error())
+	})
+}
+
+func TestSequenceRender(t *testing.T) {
+	assert.Equal(t, "42", Sequence{}.Render("", 42))
+	assert.Equal(t, "T-0042", Sequence{Format: "T-%04d"}.Render("", 42))
+	assert.Equal(t, "INV-2026-0042", Sequence{
+		Scope:  func(Model) string { return "" },
+		Format: "INV-%s-%04d",
+	}.Render("2026", 42))
+	assert.Equal(t, "2026-42", Sequence{
+		Scope: func(Model) string { return "" },
+	}.Render("2026", 42))
+}
@@ -112,12 +112,17 @@ func NewStore(client lungo.IClient, defaultDB string, engine *lungo.Engine, repo
 
 // A Store manages the usage of a database client.
 type Store struct {
-	client   lungo.IClient
-	defDB    string
-	engine   *lungo.Engine
-	reporter func(error)
-	colls    sync.Map
-	managers sync.Map
+	client        lungo.IClient
+	defDB         string
+	engine        *lungo.Engine
+	reporter      func(error)
+	keyring       *Keyring
+	router        *Router
+	slowThreshold time.Duration
+	explain       bool
+	indexRequired sync.Map
+	colls         sync.Map
+	managers      sync.Map
 }
 
 // Client returns the client used by this store.
@@ -131,6 +136,36 @@ func (s *Store) Lungo() bool {
 	return ok
 }
 
+// SetKeyring will set the keyring used by managers to encrypt and decrypt
+// fields flagged as "encrypted".
+func (s *Store) SetKeyring(keyring *Keyring) {
+	s.keyring = keyring
+}
+
+// SetRouter will set the router used to resolve the stores of models that are
+// routed to other databases. The collections, managers and transactions of
+// these models must be obtained using S, C or M.
+func (s *Store) SetRouter(router *Router) {
+	s.router = router
+}
+
+// S will return the store for the specified model. If no router is set or the
+// model is not routed, the store itself is returned.
+func (s *Store) S(model Model) *Store {
+	// check router
+	if s.router == nil {
+		return s
+	}
+
+	// lookup store
+	store := s.router.Lookup(model)
+	if store == nil {
+		return s
+	}
+
+	return store
+}
+
 // DB returns the database used by this store.
 func (s *Store) DB() lungo.IDatabase {
 	return s.client.Database(s.defDB)
@@ -139,8 +174,14 @@ func (s *Store) DB() lungo.IDatabase {
 // C will return the collection for the specified model. The collection is just
 // a thin wrapper around the driver collection API to integrate tracing. Since
 // it does not perform any checks, it is recommended to use the manager to
-// perform safe CRUD operations.
+// perform safe CRUD operations. If the model is routed to another store, the
+// collection of that store is returned.
 func (s *Store) C(model Model) *Collection {
+	// route model
+	if store := s.S(model); store != s {
+		return store.C(model)
+	}
+
 	// get meta
 	meta := GetMeta(model)
 
@@ -152,7 +193,8 @@ func (s *Store) C(model Model) *Collection {
 
 	// create collection
 	coll := &Collection{
-		coll: s.DB().Collection(meta.Collection),
+		coll:  s.DB().Collection(meta.Collection),
+		store: s,
 	}
 
 	// cache collection
@@ -163,8 +205,14 @@ func (s *Store) C(model Model) *Collection {
 
 // M will return the manager for the specified model. The manager will translate
 // query and update documents as well as perform extensive checks before running
-// operations to ensure they are as safe as possible.
+// operations to ensure they are as safe as possible. If the model is routed to
+// another store, the manager of that store is returned.
 func (s *Store) M(model Model) *Manager {
+	// route model
+	if store := s.S(model); store != s {
+		return store.M(model)
+	}
+
 	// get meta
 	meta := GetMeta(model)
 
@@ -176,9 +224,11 @@ func (s *Store) M(model Model) *Manager {
 
 	// create manager
 	manager := &Manager{
-		meta:  meta,
-		coll:  s.C(model),
-		trans: NewTranslator(model),
+		meta:      meta,
+		store:     s,
+		coll:      s.C(model),
+		trans:     NewTranslator(model),
+		encrypted: encryptedFields(meta),
 	}
 
 	// cache collection
@@ -1,6 +1,13 @@
 package coal
 
 import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/256dpi/lungo"
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
 	"github.com/256dpi/xo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -47,13 +54,52 @@ const (
 // Receiver is a callback that receives stream events.
 type Receiver func(event Event, id ID, model Model, err error, token []byte) error
 
+// Change describes the fields that have been changed by an update. Known
+// database fields are reported using their struct field names, other fields
+// are reported using their raw (possibly dotted) keys.
+type Change struct {
+	// The updated fields.
+	Updated []string
+
+	// The removed fields.
+	Removed []string
+}
+
+// ChangeReceiver is a callback that receives stream events. The change is
+// only provided for updated events that originate from an update operation.
+type ChangeReceiver func(event Event, id ID, model Model, change *Change, err error, token []byte) error
+
+// StreamOptions defines options for OpenChangeStream.
+type StreamOptions struct {
+	// The filter that is matched against the documents of created and updated
+	// events. The filter is written with struct field names and translated
+	// using the models translator. Deleted events are always received.
+	Filter bson.M
+
+	// Whether the full document should not be looked up for updated events
+	// that originate from an update operation. These events will not carry a
+	// model and are not matched against the filter.
+	NoFullDocument bool
+
+	// The checkpoint used to persist the resume token. If the checkpoint
+	// holds a token, it is used to resume the stream unless a token has been
+	// provided explicitly.
+	Checkpoint *Checkpoint
+}
+
 // Stream simplifies the handling of change streams to receive changes to
 // documents.
 type Stream struct {
 	store    *Store
 	model    Model
 	token    []byte
-	receiver Receiver
+	match    bson.D
+	lookup   bool
+	receiver ChangeReceiver
+
+	checkpoint *Checkpoint
+	restored   bool
+	saved      time.Time
 
 	opened bool
 	tomb   tomb.Tomb
@@ -65,14 +111,63 @@ type Stream struct {
 //
 // The stream automatically resumes on errors using an internally stored resume
 // token. Applications that need more control should store the token externally
-// and reopen the stream manually to resume from a specific position.
+// and reopen the stream manually to resume from a specific position or use
+// OpenChangeStream with a checkpoint.
 func OpenStream(store *Store, model Model, token []byte, receiver Receiver) *Stream {
+	return openStream(store, model, token, nil, true, nil, func(event Event, id ID, model Model, _ *Change, err error, token []byte) error {
+		return receiver(event, id, model, err, token)
+	})
+}
+
+// OpenChangeStream is similar to OpenStream but allows filtering the events on
+// the server, disabling the full document lookup and receiving the changed
+// fields of updated documents. If a checkpoint is configured, the resume token
+// is loaded when the stream is opened and saved periodically while events are
+// received. If the token has expired from the oplog, the checkpoint is removed
+// and the stream is restarted at the current position. The opened event is
+// then emitted again without a token to allow receivers to perform a full
+// resync.
+//
+// Note: Lungo does not support change stream pipelines and the filter is
+// applied on the client.
+func OpenChangeStream(store *Store, model Model, token []byte, opts StreamOptions, receiver ChangeReceiver) (*Stream, error) {
+	// prepare match
+	var match bson.D
+	if len(opts.Filter) > 0 {
+		// translate filter
+		filter, err := NewTranslator(model).Document(opts.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		// prepare operations that are always received
+		passed := bson.A{"delete", "drop", "rename", "dropDatabase", "invalidate"}
+		if opts.NoFullDocument {
+			passed = append(passed, "update")
+		}
+
+		// prepare match
+		match = bson.D{
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: passed}}}},
+				prefixFilter(filter, "fullDocument."),
+			}},
+		}
+	}
+
+	return openStream(store, model, token, match, !opts.NoFullDocument, opts.Checkpoint, receiver), nil
+}
+
+func openStream(store *Store, model Model, token []byte, match bson.D, lookup bool, checkpoint *Checkpoint, receiver ChangeReceiver) *Stream {
 	// create stream
 	s := &Stream{
-		store:    store,
-		model:    model,
-		token:    token,
-		receiver: receiver,
+		store:      store.S(model),
+		model:      model,
+		token:      token,
+		match:      match,
+		lookup:     lookup,
+		receiver:   receiver,
+		checkpoint: checkpoint,
 	}
 
 	// open stream
@@ -92,28 +187,89 @@ func (s *Stream) open() error {
 	for {
 		// check if alive
 		if !s.tomb.Alive() {
-			return xo.W(s.receiver(Stopped, ID{}, nil, nil, s.token))
+			return s.stop()
 		}
 
 		// tail stream
 		err := s.tail()
 		if ErrStop.Is(err) {
-			return xo.W(s.receiver(Stopped, ID{}, nil, nil, s.token))
-		} else if err != nil {
-			err = xo.W(s.receiver(Errored, ID{}, nil, err, s.token))
+			return s.stop()
+		} else if err != nil && s.checkpoint != nil && s.token != nil && expiredToken(err) {
+			// remove checkpoint and restart at the current position
+			s.token = nil
+			s.opened = false
+			err = s.checkpoint.Checkpoints.Save(nil, s.checkpoint.Name, nil)
+		}
+		if err != nil {
+			err = xo.W(s.receiver(Errored, ID{}, nil, nil, err, s.token))
 			if ErrStop.Is(err) {
-				return xo.W(s.receiver(Stopped, ID{}, nil, nil, s.token))
+				return s.stop()
 			}
 		}
 	}
 }
 
+func (s *Stream) stop() error {
+	// save token
+	err := s.save()
+	if err != nil {
+		_ = s.receiver(Errored, ID{}, nil, nil, err, s.token)
+	}
+
+	return xo.W(s.receiver(Stopped, ID{}, nil, nil, nil, s.token))
+}
+
+func (s *Stream) advance(token []byte) error {
+	// set token
+	s.token = token
+
+	// save token if due
+	if s.checkpoint != nil && time.Since(s.saved) >= s.checkpoint.Interval {
+		return s.save()
+	}
+
+	return nil
+}
+
+func (s *Stream) save() error {
+	// check checkpoint and token
+	if s.checkpoint == nil || s.token == nil {
+		return nil
+	}
+
+	// save token
+	err := s.checkpoint.Checkpoints.Save(nil, s.checkpoint.Name, s.token)
+	if err != nil {
+		return err
+	}
+
+	// set time
+	s.saved = time.Now()
+
+	return nil
+}
+
 func (s *Stream) tail() error {
 	// prepare context
 	ctx := s.tomb.Context(nil)
 
+	// restore token from checkpoint
+	if s.checkpoint != nil && !s.restored {
+		token, err := s.checkpoint.Checkpoints.Load(ctx, s.checkpoint.Name)
+		if err != nil {
+			return err
+		}
+		if s.token == nil {
+			s.token = token
+		}
+		s.restored = true
+	}
+
 	// prepare opts
-	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	opts := options.ChangeStream()
+	if s.lookup {
+		opts.SetFullDocument(options.UpdateLookup)
+	}
 	if s.token != nil {
 		opts.SetResumeAfter(bson.Raw(s.token))
 	}
@@ -121,8 +277,14 @@ func (s *Stream) tail() error {
 	// get collection
 	coll := s.store.DB().Collection(GetMeta(s.model).Collection, options.Collection().SetReadConcern(readconcern.Majority()))
 
+	// prepare pipeline
+	pipeline := []bson.D{}
+	if s.match != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: s.match}})
+	}
+
 	// open change stream
-	cs, err := coll.Watch(ctx, []bson.M{}, opts)
+	cs, err := coll.Watch(ctx, pipeline, opts)
 	if err != nil {
 		return xo.W(err)
 	}
@@ -133,13 +295,13 @@ func (s *Stream) tail() error {
 	// check if stream has been opened before
 	if !s.opened {
 		// signal opened
-		err = s.receiver(Opened, ID{}, nil, nil, s.token)
+		err = s.receiver(Opened, ID{}, nil, nil, nil, s.token)
 		if err != nil {
 			return xo.W(err)
 		}
 	} else {
 		// signal resumed
-		err = s.receiver(Resumed, ID{}, nil, nil, s.token)
+		err = s.receiver(Resumed, ID{}, nil, nil, nil, s.token)
 		if err != nil {
 			return xo.W(err)
 		}
@@ -157,6 +319,28 @@ func (s *Stream) tail() error {
 			return xo.W(err)
 		}
 
+		// apply pipeline and options manually for lungo
+		if s.store.Lungo() {
+			// match event
+			if s.match != nil {
+				ok, err := matchChange(cs, s.match)
+				if err != nil {
+					return err
+				} else if !ok {
+					err = s.advance(ch.ResumeToken)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
+			// drop full document
+			if !s.lookup && ch.OperationType == "update" {
+				ch.FullDocument = nil
+			}
+		}
+
 		// prepare type
 		var event Event
 		switch ch.OperationType {
@@ -181,29 +365,50 @@ func (s *Stream) tail() error {
 
 			// continue if document hast just been locked or is unavailable due
 			// to a following a delete or drop event
-			if locked || len(ch.FullDocument) == 0 {
+			if locked || (len(ch.FullDocument) == 0 && (s.lookup || ch.OperationType != "update")) {
 				// save token
-				s.token = ch.ResumeToken
+				err = s.advance(ch.ResumeToken)
+				if err != nil {
+					return err
+				}
 
 				continue
 			}
 
-			// decode document
-			doc = GetMeta(s.model).Make()
-			err = bson.Unmarshal(ch.FullDocument, doc)
-			if err != nil {
-				return xo.W(err)
+			// decode document if available
+			if len(ch.FullDocument) > 0 {
+				// decode document
+				doc = GetMeta(s.model).Make()
+				err = bson.Unmarshal(ch.FullDocument, doc)
+				if err != nil {
+					return xo.W(err)
+				}
+
+				// decrypt document
+				err = s.store.M(s.model).decryptModel(doc)
+				if err != nil {
+					return err
+				}
 			}
 		}
 
+		// prepare change
+		var chg *Change
+		if ch.OperationType == "update" {
+			chg = s.change(&ch)
+		}
+
 		// call receiver
-		err = s.receiver(event, ch.DocumentKey.ID, doc, nil, ch.ResumeToken)
+		err = s.receiver(event, ch.DocumentKey.ID, doc, chg, nil, ch.ResumeToken)
 		if err != nil {
 			return xo.W(err)
 		}
 
 		// save token
-		s.token = ch.ResumeToken
+		err = s.advance(ch.ResumeToken)
+		if err != nil {
+			return err
+		}
 	}
 
 	// close stream and check error
@@ -227,3 +432,94 @@ type change struct {
 		RemovedFields []string `bson:"removedFields"`
 	} `bson:"updateDescription"`
 }
+
+func (s *Stream) change(ch *change) *Change {
+	// get meta
+	meta := GetMeta(s.model)
+
+	// prepare name mapper
+	name := func(key string) string {
+		if field := meta.DatabaseFields[key]; field != nil {
+			return field.Name
+		}
+		return key
+	}
+
+	// collect updated fields
+	chg := &Change{
+		Updated: []string{},
+		Removed: []string{},
+	}
+	for key := range ch.UpdateDescription.UpdatedFields {
+		if key != "_lk" {
+			chg.Updated = append(chg.Updated, name(key))
+		}
+	}
+	for _, key := range ch.UpdateDescription.RemovedFields {
+		chg.Removed = append(chg.Removed, name(key))
+	}
+
+	// sort fields
+	sort.Strings(chg.Updated)
+	sort.Strings(chg.Removed)
+
+	return chg
+}
+
+func matchChange(cs lungo.IChangeStream, match bson.D) (bool, error) {
+	// decode event
+	var raw bson.Raw
+	err := cs.Decode(&raw)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	// convert event
+	event, err := bsonkit.Transform(raw)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	// convert query
+	query, err := bsonkit.Transform(match)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	// match event
+	ok, err := mongokit.Match(event, query)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	return ok, nil
+}
+
+func prefixFilter(filter bson.D, prefix string) bson.D {
+	// prefix keys
+	result := make(bson.D, 0, len(filter))
+	for _, item := range filter {
+		switch item.Key {
+		case "$and", "$or", "$nor":
+			// prefix sub filters
+			list, _ := item.Value.(bson.A)
+			sub := make(bson.A, 0, len(list))
+			for _, value := range list {
+				if doc, ok := value.(bson.D); ok {
+					sub = append(sub, prefixFilter(doc, prefix))
+				} else {
+					sub = append(sub, value)
+				}
+			}
+			result = append(result, bson.E{Key: item.Key, Value: sub})
+		default:
+			// prefix field
+			if !strings.HasPrefix(item.Key, "$") {
+				item.Key = prefix + item.Key
+			}
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
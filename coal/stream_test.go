@@ -482,3 +482,148 @@ func TestStreamInvalidation(t *testing.T) {
 		stream.Close()
 	})
 }
+
+func TestChangeStream(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(100 * time.Millisecond)
+
+		open := make(chan struct{})
+		done := make(chan struct{})
+
+		i := 0
+		stream, err := OpenChangeStream(tester.Store, &postModel{}, nil, StreamOptions{
+			Filter: bson.M{
+				"Published": true,
+			},
+		}, func(e Event, id ID, model Model, change *Change, err error, token []byte) error {
+			i++
+
+			switch i {
+			case 1:
+				assert.Equal(t, Opened, e)
+
+				close(open)
+			case 2:
+				assert.Equal(t, Created, e)
+				assert.Equal(t, "bar", model.(*postModel).Title)
+				assert.Nil(t, change)
+			case 3:
+				assert.Equal(t, Updated, e)
+				assert.Equal(t, "baz", model.(*postModel).Title)
+				assert.Equal(t, &Change{
+					Updated: []string{"Title"},
+					Removed: []string{},
+				}, change)
+			case 4:
+				assert.Equal(t, Deleted, e)
+				assert.NotZero(t, id)
+				assert.Nil(t, model)
+
+				return ErrStop.Wrap()
+			case 5:
+				assert.Equal(t, Stopped, e)
+
+				close(done)
+			default:
+				panic(e)
+			}
+
+			return nil
+		})
+		assert.NoError(t, err)
+
+		<-open
+
+		tester.Insert(&postModel{
+			Title: "foo",
+		})
+
+		post := tester.Insert(&postModel{
+			Title:     "bar",
+			Published: true,
+		}).(*postModel)
+
+		tester.Update(post, bson.M{
+			"$set": bson.M{
+				"Title": "baz",
+			},
+		})
+
+		tester.Delete(post)
+
+		<-done
+
+		stream.Close()
+
+		_, err = OpenChangeStream(tester.Store, &postModel{}, nil, StreamOptions{
+			Filter: bson.M{
+				"Foo": true,
+			},
+		}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestChangeStreamNoFullDocument(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(100 * time.Millisecond)
+
+		open := make(chan struct{})
+		done := make(chan struct{})
+
+		i := 0
+		stream, err := OpenChangeStream(tester.Store, &postModel{}, nil, StreamOptions{
+			Filter: bson.M{
+				"Published": true,
+			},
+			NoFullDocument: true,
+		}, func(e Event, id ID, model Model, change *Change, err error, token []byte) error {
+			i++
+
+			switch i {
+			case 1:
+				assert.Equal(t, Opened, e)
+
+				close(open)
+			case 2:
+				assert.Equal(t, Updated, e)
+				assert.NotZero(t, id)
+				assert.Nil(t, model)
+				assert.Equal(t, &Change{
+					Updated: []string{"Title"},
+					Removed: []string{"TextBody"},
+				}, change)
+
+				return ErrStop.Wrap()
+			case 3:
+				assert.Equal(t, Stopped, e)
+
+				close(done)
+			default:
+				panic(e)
+			}
+
+			return nil
+		})
+		assert.NoError(t, err)
+
+		<-open
+
+		post := tester.Insert(&postModel{
+			Title: "foo",
+		}).(*postModel)
+
+		tester.Update(post, bson.M{
+			"$set": bson.M{
+				"Title": "bar",
+			},
+			"$unset": bson.M{
+				"TextBody": true,
+			},
+		})
+
+		<-done
+
+		stream.Close()
+	})
+}
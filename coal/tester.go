@@ -139,7 +139,9 @@ func (t *Tester) Fetch(model Model, id ID) Model {
 // Insert will insert the specified model.
 func (t *Tester) Insert(model Model) Model {
 	// insert to collection
-	err := t.Store.M(model).Insert(nil, model)
+	err := t.Store.S(model).T(nil, false, func(ctx context.Context) error {
+		return t.Store.M(model).Insert(ctx, model)
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -154,7 +156,12 @@ func (t *Tester) Insert(model Model) Model {
 // Replace will replace the specified model.
 func (t *Tester) Replace(model Model) Model {
 	// replace model
-	found, err := t.Store.M(model).Replace(nil, model, false)
+	var found bool
+	err := t.Store.S(model).T(nil, false, func(ctx context.Context) error {
+		var err error
+		found, err = t.Store.M(model).Replace(ctx, model, false)
+		return err
+	})
 	if err != nil {
 		panic(err)
 	} else if !found {
@@ -170,8 +177,13 @@ func (t *Tester) Replace(model Model) Model {
 
 // Update will update the specified model.
 func (t *Tester) Update(model Model, update bson.M) Model {
-	// replace model
-	found, err := t.Store.M(model).Update(nil, model, model.ID(), update, false)
+	// update model
+	var found bool
+	err := t.Store.S(model).T(nil, false, func(ctx context.Context) error {
+		var err error
+		found, err = t.Store.M(model).Update(ctx, model, model.ID(), update, false)
+		return err
+	})
 	if err != nil {
 		panic(err)
 	} else if !found {
@@ -188,7 +200,12 @@ func (t *Tester) Update(model Model, update bson.M) Model {
 // Delete will delete the specified model.
 func (t *Tester) Delete(model Model) {
 	// delete model
-	found, err := t.Store.M(model).Delete(nil, nil, model.ID())
+	var found bool
+	err := t.Store.S(model).T(nil, false, func(ctx context.Context) error {
+		var err error
+		found, err = t.Store.M(model).Delete(ctx, nil, model.ID())
+		return err
+	})
 	if err != nil {
 		panic(err)
 	} else if !found {
@@ -205,7 +222,10 @@ func (t *Tester) DeleteAll(model Model, query ...bson.M) {
 	}
 
 	// delete models
-	_, err := t.Store.M(model).DeleteAll(nil, qry)
+	err := t.Store.S(model).T(nil, false, func(ctx context.Context) error {
+		_, err := t.Store.M(model).DeleteAll(ctx, qry)
+		return err
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -226,6 +246,9 @@ func (t *Tester) Drop(models ...Model) {
 func (t *Tester) Clean() {
 	// clear all models
 	for _, model := range t.Models {
-		t.DeleteAll(model)
+		_, err := t.Store.C(model).DeleteMany(nil, bson.M{})
+		if err != nil {
+			panic(err)
+		}
 	}
 }
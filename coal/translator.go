@@ -61,7 +61,7 @@ func (t *Translator) Document(query bson.M) (bson.D, error) {
 	}
 
 	// translate
-	err = t.value(doc, false)
+	err = t.value(doc, false, t.field)
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +76,7 @@ func (t *Translator) Sort(fields []string) (bson.D, error) {
 	doc := Sort(fields...)
 
 	// translate
-	err := t.value(doc, false)
+	err := t.value(doc, false, t.field)
 	if err != nil {
 		return nil, err
 	}
@@ -84,7 +84,422 @@ func (t *Translator) Sort(fields []string) (bson.D, error) {
 	return doc, nil
 }
 
-func (t *Translator) value(value interface{}, skipTranslation bool) error {
+// Pipeline will convert the provided aggregation pipeline and translate all
+// field names and field references (e.g. "$Title") to refer to known database
+// fields. The stages "$match", "$sort", "$project", "$group", "$lookup",
+// "$unwind", "$addFields", "$set", "$replaceRoot", "$count", "$limit" and
+// "$skip" are supported. The sort of a "$sort" stage may be provided as a list
+// of fields (see Sort). The "from" of a "$lookup" stage may be a model in which
+// case its "foreignField" and "pipeline" are translated using the translator
+// of that model. Expressions of "$expr" conditions in "$match" stages are
+// translated like the expressions of "$project" and "$group" stages.
+//
+// Fields added by "$lookup", "$addFields" and "$set" stages are used as is.
+// Since "$group", "$project", "$replaceRoot" and "$count" stages reshape the
+// documents, fields in subsequent stages are not translated.
+func (t *Translator) Pipeline(pipeline []bson.M) ([]bson.D, error) {
+	return t.pipeline(pipeline, &pipelineState{
+		extra: map[string]bool{},
+	})
+}
+
+type pipelineState struct {
+	raw   bool
+	extra map[string]bool
+}
+
+func (t *Translator) pipeline(pipeline []bson.M, state *pipelineState) ([]bson.D, error) {
+	// prepare field translation
+	field := func(field *string) error {
+		// handle raw fields
+		if state.raw {
+			*field = strings.TrimPrefix(*field, "#")
+			return nil
+		}
+
+		// handle extra fields
+		if state.extra[strings.SplitN(*field, ".", 2)[0]] {
+			return nil
+		}
+
+		return t.field(field)
+	}
+
+	// translate stages
+	stages := make([]bson.D, 0, len(pipeline))
+	for _, stage := range pipeline {
+		// check stage
+		if len(stage) != 1 {
+			return nil, xo.F("expected stage to have a single operator")
+		}
+
+		// get operator and value
+		var op string
+		var value interface{}
+		for key, val := range stage {
+			op, value = key, val
+		}
+
+		// translate stage
+		var err error
+		switch op {
+		case "$match":
+			value, err = t.pipelineDocument(value, func(doc bson.D) error {
+				return t.match(doc, field)
+			})
+		case "$sort":
+			if fields, ok := value.([]string); ok {
+				value = Sort(fields...)
+			} else if doc, ok := value.(bson.M); ok && len(doc) > 1 {
+				return nil, xo.F("ambiguous sort order")
+			}
+			value, err = t.pipelineDocument(value, func(doc bson.D) error {
+				for i := range doc {
+					err := field(&doc[i].Key)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		case "$project":
+			value, err = t.pipelineDocument(value, func(doc bson.D) error {
+				for i := range doc {
+					err := field(&doc[i].Key)
+					if err != nil {
+						return err
+					}
+					doc[i].Value, err = t.expression(doc[i].Value, field)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			state.raw = true
+		case "$group", "$replaceRoot":
+			value, err = t.pipelineDocument(value, func(doc bson.D) error {
+				for i := range doc {
+					var err error
+					doc[i].Value, err = t.expression(doc[i].Value, field)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			state.raw = true
+		case "$addFields", "$set":
+			value, err = t.pipelineDocument(value, func(doc bson.D) error {
+				for i := range doc {
+					var err error
+					doc[i].Value, err = t.expression(doc[i].Value, field)
+					if err != nil {
+						return err
+					}
+				}
+				for _, item := range doc {
+					state.extra[item.Key] = true
+				}
+				return nil
+			})
+		case "$unwind":
+			if path, ok := value.(string); ok {
+				value, err = t.expression(path, field)
+				break
+			}
+			value, err = t.pipelineDocument(value, func(doc bson.D) error {
+				for i, item := range doc {
+					if item.Key == "path" {
+						var err error
+						doc[i].Value, err = t.expression(item.Value, field)
+						if err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			})
+		case "$lookup":
+			value, err = t.lookup(value, state, field)
+		case "$count":
+			state.raw = true
+		case "$limit", "$skip":
+		default:
+			return nil, xo.F("unsupported stage %q", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// add stage
+		stages = append(stages, bson.D{{Key: op, Value: value}})
+	}
+
+	return stages, nil
+}
+
+func (t *Translator) lookup(value interface{}, state *pipelineState, field func(*string) error) (interface{}, error) {
+	// check value
+	spec, ok := value.(bson.M)
+	if !ok {
+		return nil, xo.F("expected lookup to be a document")
+	}
+
+	// check keys
+	for key := range spec {
+		switch key {
+		case "from", "localField", "foreignField", "let", "pipeline", "as":
+		default:
+			return nil, xo.F("unsupported lookup key %q", key)
+		}
+	}
+
+	// get target translator
+	var target *Translator
+	if model, ok := spec["from"].(Model); ok {
+		target = NewTranslator(model)
+	}
+
+	// prepare lookup
+	var lookup bson.D
+
+	// translate from
+	if target != nil {
+		lookup = append(lookup, bson.E{Key: "from", Value: target.meta.Collection})
+	} else if from, ok := spec["from"].(string); ok {
+		lookup = append(lookup, bson.E{Key: "from", Value: from})
+	} else {
+		return nil, xo.F("expected lookup from to be a model or string")
+	}
+
+	// translate local field
+	if val, ok := spec["localField"]; ok {
+		localField, ok := val.(string)
+		if !ok {
+			return nil, xo.F("expected lookup local field to be a string")
+		}
+		err := field(&localField)
+		if err != nil {
+			return nil, err
+		}
+		lookup = append(lookup, bson.E{Key: "localField", Value: localField})
+	}
+
+	// translate foreign field
+	if val, ok := spec["foreignField"]; ok {
+		foreignField, ok := val.(string)
+		if !ok {
+			return nil, xo.F("expected lookup foreign field to be a string")
+		}
+		if target != nil {
+			err := target.field(&foreignField)
+			if err != nil {
+				return nil, err
+			}
+		}
+		lookup = append(lookup, bson.E{Key: "foreignField", Value: foreignField})
+	}
+
+	// translate variables
+	if let, ok := spec["let"]; ok {
+		doc, err := t.pipelineDocument(let, func(doc bson.D) error {
+			for i := range doc {
+				var err error
+				doc[i].Value, err = t.expression(doc[i].Value, field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		lookup = append(lookup, bson.E{Key: "let", Value: doc})
+	}
+
+	// translate pipeline
+	if val, ok := spec["pipeline"]; ok {
+		// get stages
+		pipeline, err := pipelineStages(val)
+		if err != nil {
+			return nil, err
+		}
+
+		// get translator
+		translator := target
+		if translator == nil {
+			translator = t
+		}
+
+		// translate sub pipeline
+		stages, err := translator.pipeline(pipeline, &pipelineState{
+			raw:   target == nil,
+			extra: map[string]bool{},
+		})
+		if err != nil {
+			return nil, err
+		}
+		lookup = append(lookup, bson.E{Key: "pipeline", Value: stages})
+	}
+
+	// get output field
+	as, ok := spec["as"].(string)
+	if !ok {
+		return nil, xo.F("expected lookup as to be a string")
+	}
+	lookup = append(lookup, bson.E{Key: "as", Value: as})
+	state.extra[as] = true
+
+	return lookup, nil
+}
+
+func pipelineStages(value interface{}) ([]bson.M, error) {
+	// get list
+	var list []interface{}
+	switch value := value.(type) {
+	case []bson.M:
+		return value, nil
+	case []bson.D:
+		for _, stage := range value {
+			list = append(list, stage)
+		}
+	case bson.A:
+		list = value
+	case []interface{}:
+		list = value
+	default:
+		return nil, xo.F("expected pipeline, got %T", value)
+	}
+
+	// convert stages
+	stages := make([]bson.M, 0, len(list))
+	for _, item := range list {
+		switch item := item.(type) {
+		case bson.M:
+			stages = append(stages, item)
+		case bson.D:
+			stage := bson.M{}
+			for _, e := range item {
+				stage[e.Key] = e.Value
+			}
+			stages = append(stages, stage)
+		default:
+			return nil, xo.F("expected stage to be a document, got %T", item)
+		}
+	}
+
+	return stages, nil
+}
+
+func (t *Translator) pipelineDocument(value interface{}, fn func(bson.D) error) (bson.D, error) {
+	// convert value
+	var doc bson.D
+	switch value := value.(type) {
+	case bson.D:
+		doc = value
+	case bson.M:
+		var err error
+		doc, err = t.convert(value)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, xo.F("expected document, got %T", value)
+	}
+
+	// translate document
+	err := fn(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+func (t *Translator) match(doc bson.D, field func(*string) error) error {
+	// translate conditions
+	for i, item := range doc {
+		switch item.Key {
+		case "$expr":
+			// translate expression
+			var err error
+			doc[i].Value, err = t.expression(item.Value, field)
+			if err != nil {
+				return err
+			}
+		case "$and", "$or", "$nor":
+			// translate nested conditions
+			list, ok := item.Value.(bson.A)
+			if !ok {
+				return xo.F("expected array for %q", item.Key)
+			}
+			for _, cond := range list {
+				sub, ok := cond.(bson.D)
+				if !ok {
+					return xo.F("expected document in %q", item.Key)
+				}
+				err := t.match(sub, field)
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			// translate condition
+			cond := bson.D{item}
+			err := t.value(cond, false, field)
+			if err != nil {
+				return err
+			}
+			doc[i] = cond[0]
+		}
+	}
+
+	return nil
+}
+
+func (t *Translator) expression(value interface{}, field func(*string) error) (interface{}, error) {
+	// check value
+	switch value := value.(type) {
+	case string:
+		// check reference
+		if !strings.HasPrefix(value, "$") || strings.HasPrefix(value, "$$") {
+			return value, nil
+		}
+
+		// translate reference
+		name := value[1:]
+		err := field(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		return "$" + name, nil
+	case bson.A:
+		for i, item := range value {
+			var err error
+			value[i], err = t.expression(item, field)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	case bson.D:
+		for i, item := range value {
+			var err error
+			value[i].Value, err = t.expression(item.Value, field)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+func (t *Translator) value(value interface{}, skipTranslation bool, field func(*string) error) error {
 	// translate document
 	if doc, ok := value.(bson.D); ok {
 		for i, pair := range doc {
@@ -96,7 +511,7 @@ func (t *Translator) value(value interface{}, skipTranslation bool) error {
 				}
 			} else if !skipTranslation {
 				// translate field
-				err := t.field(&doc[i].Key)
+				err := field(&doc[i].Key)
 				if err != nil {
 					return err
 				}
@@ -108,7 +523,7 @@ func (t *Translator) value(value interface{}, skipTranslation bool) error {
 	switch value := value.(type) {
 	case bson.A:
 		for _, item := range value {
-			err := t.value(item, skipTranslation)
+			err := t.value(item, skipTranslation, field)
 			if err != nil {
 				return err
 			}
@@ -116,7 +531,7 @@ func (t *Translator) value(value interface{}, skipTranslation bool) error {
 		return nil
 	case bson.D:
 		for _, item := range value {
-			err := t.value(item.Value, skipTranslation || !strings.HasPrefix(item.Key, "$"))
+			err := t.value(item.Value, skipTranslation || !strings.HasPrefix(item.Key, "$"), field)
 			if err != nil {
 				return err
 			}
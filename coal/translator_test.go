@@ -317,3 +317,260 @@ func BenchmarkTranslatorSort(b *testing.B) {
 		}
 	}
 }
+
+func TestTranslatorPipeline(t *testing.T) {
+	trans := NewTranslator(&commentModel{})
+
+	// translated
+	pipeline, err := trans.Pipeline([]bson.M{
+		{"$match": bson.M{"Message": bson.M{"$ne": ""}}},
+		{"$lookup": bson.M{
+			"from":         &postModel{},
+			"localField":   "Post",
+			"foreignField": "_id",
+			"let":          bson.M{"parent": "$Parent"},
+			"pipeline": []bson.M{
+				{"$match": bson.M{"Published": true}},
+				{"$project": bson.M{"Title": 1}},
+			},
+			"as": "posts",
+		}},
+		{"$unwind": "$posts"},
+		{"$sort": []string{"-Message"}},
+		{"$group": bson.M{
+			"_id":   "$Post",
+			"count": bson.M{"$sum": 1},
+			"title": bson.M{"$first": "$posts.title"},
+		}},
+		{"$sort": bson.M{"count": -1}},
+		{"$limit": 10},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.D{
+		{{Key: "$match", Value: bson.D{
+			{Key: "message", Value: bson.D{{Key: "$ne", Value: ""}}},
+		}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "posts"},
+			{Key: "localField", Value: "post_id"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "let", Value: bson.D{{Key: "parent", Value: "$parent"}}},
+			{Key: "pipeline", Value: []bson.D{
+				{{Key: "$match", Value: bson.D{{Key: "published", Value: true}}}},
+				{{Key: "$project", Value: bson.D{{Key: "title", Value: int64(1)}}}},
+			}},
+			{Key: "as", Value: "posts"},
+		}}},
+		{{Key: "$unwind", Value: "$posts"}},
+		{{Key: "$sort", Value: bson.D{{Key: "message", Value: int32(-1)}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$post_id"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: int64(1)}}},
+			{Key: "title", Value: bson.D{{Key: "$first", Value: "$posts.title"}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: int64(-1)}}}},
+		{{Key: "$limit", Value: 10}},
+	}, pipeline)
+
+	// lookup pipelines
+	for _, sub := range []interface{}{
+		[]bson.D{
+			{{Key: "$match", Value: bson.M{"Published": true}}},
+		},
+		bson.A{
+			bson.M{"$match": bson.M{"Published": true}},
+		},
+		[]interface{}{
+			bson.D{{Key: "$match", Value: bson.M{"Published": true}}},
+		},
+	} {
+		pipeline, err = trans.Pipeline([]bson.M{
+			{"$lookup": bson.M{
+				"from":     &postModel{},
+				"pipeline": sub,
+				"as":       "posts",
+			}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.D{
+			{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: "posts"},
+				{Key: "pipeline", Value: []bson.D{
+					{{Key: "$match", Value: bson.D{{Key: "published", Value: true}}}},
+				}},
+				{Key: "as", Value: "posts"},
+			}}},
+		}, pipeline)
+	}
+
+	// expression
+	pipeline, err = trans.Pipeline([]bson.M{
+		{"$match": bson.M{
+			"$expr": bson.M{"$eq": bson.A{"$Post", "$$post"}},
+		}},
+		{"$match": bson.M{
+			"$or": bson.A{
+				bson.M{"$expr": bson.M{"$gt": bson.A{bson.M{"$strLenCP": "$Message"}, 3}}},
+				bson.M{"Parent": nil},
+			},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.D{
+		{{Key: "$match", Value: bson.D{
+			{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$post_id", "$$post"}}}},
+		}}},
+		{{Key: "$match", Value: bson.D{
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "$expr", Value: bson.D{{Key: "$gt", Value: bson.A{
+					bson.D{{Key: "$strLenCP", Value: "$message"}},
+					int64(3),
+				}}}}},
+				bson.D{{Key: "parent", Value: nil}},
+			}},
+		}}},
+	}, pipeline)
+
+	// unknown expression field
+	_, err = trans.Pipeline([]bson.M{
+		{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$Foo", 1}}}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "Foo"`, err.Error())
+
+	// unknown field
+	_, err = trans.Pipeline([]bson.M{
+		{"$match": bson.M{"Foo": "bar"}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "Foo"`, err.Error())
+
+	// unknown reference
+	_, err = trans.Pipeline([]bson.M{
+		{"$group": bson.M{"_id": "$Foo"}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "Foo"`, err.Error())
+
+	// unknown foreign field
+	_, err = trans.Pipeline([]bson.M{
+		{"$lookup": bson.M{
+			"from":         &postModel{},
+			"localField":   "Post",
+			"foreignField": "Foo",
+			"as":           "posts",
+		}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "Foo"`, err.Error())
+
+	// invalid local field
+	_, err = trans.Pipeline([]bson.M{
+		{"$lookup": bson.M{
+			"from":       &postModel{},
+			"localField": 1,
+			"as":         "posts",
+		}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `expected lookup local field to be a string`, err.Error())
+
+	// invalid foreign field
+	_, err = trans.Pipeline([]bson.M{
+		{"$lookup": bson.M{
+			"from":         &postModel{},
+			"foreignField": 1,
+			"as":           "posts",
+		}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `expected lookup foreign field to be a string`, err.Error())
+
+	// invalid lookup pipeline
+	_, err = trans.Pipeline([]bson.M{
+		{"$lookup": bson.M{
+			"from":     &postModel{},
+			"pipeline": bson.M{},
+			"as":       "posts",
+		}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `expected pipeline, got primitive.M`, err.Error())
+
+	// invalid lookup stage
+	_, err = trans.Pipeline([]bson.M{
+		{"$lookup": bson.M{
+			"from":     &postModel{},
+			"pipeline": bson.A{"foo"},
+			"as":       "posts",
+		}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `expected stage to be a document, got string`, err.Error())
+
+	// unsupported lookup key
+	_, err = trans.Pipeline([]bson.M{
+		{"$lookup": bson.M{
+			"from": &postModel{},
+			"foo":  "bar",
+			"as":   "posts",
+		}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unsupported lookup key "foo"`, err.Error())
+
+	// unsafe operator
+	_, err = trans.Pipeline([]bson.M{
+		{"$match": bson.M{"$where": "true"}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unsafe operator "$where"`, err.Error())
+
+	// unsupported stage
+	_, err = trans.Pipeline([]bson.M{
+		{"$out": "foo"},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unsupported stage "$out"`, err.Error())
+
+	// ambiguous sort
+	_, err = trans.Pipeline([]bson.M{
+		{"$sort": bson.M{"Message": 1, "Post": 1}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `ambiguous sort order`, err.Error())
+}
+
+func TestTranslatorPipelineAggregate(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		if tester.Store.Lungo() {
+			return
+		}
+
+		post1 := tester.Insert(&postModel{Title: "Foo"}).(*postModel)
+		post2 := tester.Insert(&postModel{Title: "Bar"}).(*postModel)
+		tester.Insert(&commentModel{Message: "A", Post: post1.ID()})
+		tester.Insert(&commentModel{Message: "B", Post: post1.ID()})
+		tester.Insert(&commentModel{Message: "C", Post: post2.ID()})
+
+		pipeline, err := NewTranslator(&commentModel{}).Pipeline([]bson.M{
+			{"$group": bson.M{
+				"_id":   "$Post",
+				"count": bson.M{"$sum": 1},
+			}},
+			{"$sort": bson.M{"count": -1}},
+		})
+		assert.NoError(t, err)
+
+		iter, err := tester.Store.C(&commentModel{}).Aggregate(nil, pipeline)
+		assert.NoError(t, err)
+
+		var result []bson.M
+		err = iter.All(&result)
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"_id": post1.ID(), "count": int32(2)},
+			{"_id": post2.ID(), "count": int32(1)},
+		}, result)
+	})
+}
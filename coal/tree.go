@@ -0,0 +1,625 @@
+package coal
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// ErrTreeCycle is returned if a document would become its own ancestor.
+var ErrTreeCycle = xo.BF("tree cycle")
+
+// ErrMissingParent is returned if the parent of a document does not exist.
+var ErrMissingParent = xo.BF("missing parent")
+
+// Tree describes a hierarchy of documents that is formed by an optional to-one
+// relationship referencing the same model. The ancestors and depth of every
+// document are materialized to support efficient ancestry queries.
+type Tree struct {
+	// The optional to-one parent relationship struct field.
+	Parent string
+
+	// The ancestors struct field. The ancestors are ordered from the root to
+	// the parent of the document.
+	Ancestors string
+
+	// The depth struct field. Root documents have a depth of zero.
+	Depth string
+}
+
+// AddTree will register a tree with the model that is formed by the specified
+// parent relationship. The ancestors and depth fields are maintained by the
+// manager. Inserts and replaces compute the fields from the parent and updates
+// that change the parent additionally rebase all descendants. Replaces and
+// updates that move documents require a transaction to keep the tree
+// consistent. Documents that are written without the manager are not
+// maintained, Retree may be used to repair the tree in this case.
+//
+// The function also adds an index for the ancestors field.
+func AddTree(model Model, parent, ancestors, depth string) {
+	// get meta
+	meta := GetMeta(model)
+
+	// get fields
+	parentInfo := meta.Fields[parent]
+	ancestorsInfo := meta.Fields[ancestors]
+	depthInfo := meta.Fields[depth]
+
+	// check fields
+	if parentInfo == nil || !parentInfo.ToOne || !parentInfo.Optional || parentInfo.RelType != meta.PluralName {
+		panic(fmt.Sprintf(`coal: field "%s" is not an optional to-one relationship referencing "%s"`, parent, meta.PluralName))
+	} else if ancestorsInfo == nil || ancestorsInfo.BSONKey == "" || ancestorsInfo.Type != toManyType {
+		panic(fmt.Sprintf(`coal: ancestors field "%s" is not of type "[]coal.ID"`, ancestors))
+	} else if depthInfo == nil || depthInfo.BSONKey == "" {
+		panic(fmt.Sprintf(`coal: unknown or virtual field "%s"`, depth))
+	} else if k := depthInfo.Type.Kind(); k != reflect.Int && k != reflect.Int32 && k != reflect.Int64 {
+		panic(fmt.Sprintf(`coal: depth field "%s" is not an integer`, depth))
+	} else if meta.Tree != nil {
+		panic(fmt.Sprintf(`coal: tree already registered on "%s"`, meta.Name))
+	}
+
+	// set tree
+	meta.Tree = &Tree{
+		Parent:    parent,
+		Ancestors: ancestors,
+		Depth:     depth,
+	}
+
+	// add index
+	AddIndex(model, false, 0, ancestors)
+}
+
+// Move will move the document with the specified id and its descendants below
+// the specified parent. A nil parent will move the document to the root. It
+// will return whether a document has been found and ErrTreeCycle if the parent
+// is the document itself or one of its descendants.
+//
+// A transaction is required.
+func (m *Manager) Move(ctx context.Context, id ID, parent *ID) (bool, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Manager.Move")
+	span.Tag("id", id.Hex())
+	defer span.End()
+
+	// check tree
+	if m.meta.Tree == nil {
+		return false, xo.F("model has no tree")
+	}
+
+	// require transaction
+	if !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
+	// update parent
+	return m.Update(ctx, nil, id, bson.M{
+		"$set": bson.M{
+			m.meta.Tree.Parent: parent,
+		},
+	}, false)
+}
+
+// Ancestors will load the ancestors of the document with the specified id
+// ordered from the root to the parent. It will return whether the document has
+// been found.
+//
+// A transaction is always required for the query unless the NoTransaction flag
+// is passed.
+func (m *Manager) Ancestors(ctx context.Context, list interface{}, id ID, flags ...Flags) (bool, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Manager.Ancestors")
+	span.Tag("id", id.Hex())
+	defer span.End()
+
+	// load node
+	node, found, err := m.node(ctx, id)
+	if err != nil || !found {
+		return found, err
+	}
+
+	// get ancestors
+	ancestors := stick.MustGet(node, m.meta.Tree.Ancestors).([]ID)
+
+	// find ancestors
+	err = m.FindAll(ctx, list, bson.M{
+		"_id": bson.M{
+			"$in": ancestors,
+		},
+	}, []string{m.meta.Tree.Depth}, 0, 0, false, flags...)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Descendants will load the descendants of the document with the specified id
+// ordered by depth. If a positive depth is specified, only descendants up to
+// the specified relative depth are loaded. It will return whether the document
+// has been found.
+//
+// A transaction is always required for the query unless the NoTransaction flag
+// is passed.
+func (m *Manager) Descendants(ctx context.Context, list interface{}, id ID, depth int64, flags ...Flags) (bool, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Manager.Descendants")
+	span.Tag("id", id.Hex())
+	defer span.End()
+
+	// load node
+	node, found, err := m.node(ctx, id)
+	if err != nil || !found {
+		return found, err
+	}
+
+	// prepare filter
+	filter := bson.M{
+		m.meta.Tree.Ancestors: id,
+	}
+
+	// limit depth
+	if depth > 0 {
+		filter[m.meta.Tree.Depth] = bson.M{
+			"$lte": stick.MustGetRaw(node, m.meta.Tree.Depth).Int() + depth,
+		}
+	}
+
+	// find descendants
+	err = m.FindAll(ctx, list, filter, []string{m.meta.Tree.Depth, "_id"}, 0, 0, false, flags...)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Retree will recompute the ancestors and depth of all documents of the
+// specified model. It returns the number of updated documents.
+func Retree(ctx context.Context, store *Store, model Model) (int64, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Retree")
+	defer span.End()
+
+	// get manager and tree
+	manager := store.M(model)
+	tree := manager.meta.Tree
+	if tree == nil {
+		return 0, xo.F("model has no tree")
+	}
+
+	// load all nodes
+	nodes, err := manager.nodes(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+
+	// index nodes
+	index := make(map[ID]Model, len(nodes))
+	children := map[ID][]Model{}
+	var roots []Model
+	for _, node := range nodes {
+		index[node.ID()] = node
+	}
+	for _, node := range nodes {
+		parent := stick.MustGet(node, tree.Parent).(*ID)
+		if parent != nil && index[*parent] != nil {
+			children[*parent] = append(children[*parent], node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	// walk tree
+	changed := map[ID]bool{}
+	queue := make([]Model, 0, len(nodes))
+	for _, root := range roots {
+		var dirty bool
+		manager.setTree(root, nil, &dirty)
+		changed[root.ID()] = dirty
+		queue = append(queue, root)
+	}
+	for len(queue) > 0 {
+		// get node
+		node := queue[0]
+		queue = queue[1:]
+
+		// compute path
+		ancestors := stick.MustGet(node, tree.Ancestors).([]ID)
+		path := make([]ID, 0, len(ancestors)+1)
+		path = append(path, ancestors...)
+		path = append(path, node.ID())
+
+		// handle children
+		for _, child := range children[node.ID()] {
+			var dirty bool
+			manager.setTree(child, path, &dirty)
+			changed[child.ID()] = dirty
+			queue = append(queue, child)
+		}
+	}
+
+	// save changed nodes
+	var updated int64
+	for _, node := range nodes {
+		if !changed[node.ID()] {
+			continue
+		}
+		err = manager.saveTree(ctx, node)
+		if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, nil
+}
+
+func (m *Manager) node(ctx context.Context, id ID) (Model, bool, error) {
+	// check tree
+	if m.meta.Tree == nil {
+		return nil, false, xo.F("model has no tree")
+	}
+
+	// find nodes
+	nodes, err := m.nodes(ctx, bson.M{
+		"_id": id,
+	})
+	if err != nil {
+		return nil, false, err
+	} else if len(nodes) == 0 {
+		return nil, false, nil
+	}
+
+	return nodes[0], true, nil
+}
+
+func (m *Manager) nodes(ctx context.Context, filter interface{}) ([]Model, error) {
+	// get tree
+	tree := m.meta.Tree
+
+	// find documents
+	iter, err := m.coll.Find(ctx, filter, options.Find().SetProjection(bson.M{
+		m.meta.Fields[tree.Parent].BSONKey:    1,
+		m.meta.Fields[tree.Ancestors].BSONKey: 1,
+		m.meta.Fields[tree.Depth].BSONKey:     1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	// decode documents
+	var list []Model
+	defer iter.Close()
+	for iter.Next() {
+		model := m.meta.Make()
+		err = iter.Decode(model)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, model)
+	}
+
+	// check error
+	err = iter.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (m *Manager) treeUpdate(update bson.D) bool {
+	// check tree
+	tree := m.meta.Tree
+	if tree == nil {
+		return false
+	}
+
+	// check updated fields
+	for _, op := range update {
+		fields, _ := op.Value.(bson.D)
+		for _, item := range fields {
+			for _, name := range []string{tree.Parent, tree.Ancestors, tree.Depth} {
+				key := m.meta.Fields[name].BSONKey
+				if item.Key == key || strings.HasPrefix(key, item.Key+".") || strings.HasPrefix(item.Key, key+".") {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (m *Manager) lineage(ctx context.Context, model Model, batch map[ID]Model) ([]ID, error) {
+	// get tree
+	tree := m.meta.Tree
+
+	// get parent
+	parent := stick.MustGet(model, tree.Parent).(*ID)
+	if parent == nil {
+		return []ID{}, nil
+	}
+
+	// check self reference
+	if *parent == model.ID() {
+		return nil, ErrTreeCycle.Wrap()
+	}
+
+	// get parent node
+	node := batch[*parent]
+	if node == nil {
+		var found bool
+		var err error
+		node, found, err = m.node(ctx, *parent)
+		if err != nil {
+			return nil, err
+		} else if !found {
+			return nil, ErrMissingParent.Wrap()
+		}
+	}
+
+	// get ancestors
+	ancestors := stick.MustGet(node, tree.Ancestors).([]ID)
+
+	// check cycle
+	if stick.Contains(ancestors, model.ID()) {
+		return nil, ErrTreeCycle.Wrap()
+	}
+
+	// prepare lineage
+	lineage := make([]ID, 0, len(ancestors)+1)
+	lineage = append(lineage, ancestors...)
+	lineage = append(lineage, *parent)
+
+	return lineage, nil
+}
+
+func (m *Manager) plantTree(ctx context.Context, models []Model) error {
+	// check tree
+	tree := m.meta.Tree
+	if tree == nil {
+		return nil
+	}
+
+	// index batch
+	batch := make(map[ID]Model, len(models))
+	for _, model := range models {
+		batch[model.ID()] = model
+	}
+
+	// prepare plant
+	planted := map[ID]bool{}
+	var plant func(Model, int) error
+	plant = func(model Model, level int) error {
+		// check planted
+		if planted[model.ID()] {
+			return nil
+		}
+
+		// check cycle
+		if level > len(models) {
+			return ErrTreeCycle.Wrap()
+		}
+
+		// plant parent first if part of batch
+		parent := stick.MustGet(model, tree.Parent).(*ID)
+		if parent != nil && *parent != model.ID() && batch[*parent] != nil {
+			err := plant(batch[*parent], level+1)
+			if err != nil {
+				return err
+			}
+		}
+
+		// get lineage
+		lineage, err := m.lineage(ctx, model, batch)
+		if err != nil {
+			return err
+		}
+
+		// set tree
+		m.setTree(model, lineage, nil)
+		planted[model.ID()] = true
+
+		return nil
+	}
+
+	// plant models
+	for _, model := range models {
+		err := plant(model, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) prepareTree(ctx context.Context, model Model) (bool, error) {
+	// check tree
+	if m.meta.Tree == nil {
+		return false, nil
+	}
+
+	// get lineage
+	lineage, err := m.lineage(ctx, model, nil)
+	if err != nil {
+		return false, err
+	}
+
+	// load stored node
+	node, found, err := m.node(ctx, model.ID())
+	if err != nil {
+		return false, err
+	}
+
+	// check if moved
+	moved := found && !sameIDs(stick.MustGet(node, m.meta.Tree.Ancestors).([]ID), lineage)
+
+	// require transaction
+	if moved && !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
+	// set tree
+	m.setTree(model, lineage, nil)
+
+	return moved, nil
+}
+
+func (m *Manager) retree(ctx context.Context, models []Model) error {
+	// check tree
+	if m.meta.Tree == nil {
+		return nil
+	}
+
+	// handle models
+	for _, model := range models {
+		// get lineage
+		lineage, err := m.lineage(ctx, model, nil)
+		if err != nil {
+			return err
+		}
+
+		// check change
+		var changed bool
+		m.setTree(model, lineage, &changed)
+		if !changed {
+			continue
+		}
+
+		// save tree
+		err = m.saveTree(ctx, model)
+		if err != nil {
+			return err
+		}
+
+		// rebase descendants
+		err = m.rebase(ctx, model)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) rebase(ctx context.Context, model Model) error {
+	// get tree
+	tree := m.meta.Tree
+
+	// get path
+	ancestors := stick.MustGet(model, tree.Ancestors).([]ID)
+	path := make([]ID, 0, len(ancestors)+1)
+	path = append(path, ancestors...)
+	path = append(path, model.ID())
+
+	// find descendants
+	descendants, err := m.nodes(ctx, bson.M{
+		m.meta.Fields[tree.Ancestors].BSONKey: model.ID(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// update descendants
+	for _, descendant := range descendants {
+		// get ancestors
+		ancestors := stick.MustGet(descendant, tree.Ancestors).([]ID)
+
+		// find position
+		pos := -1
+		for i, id := range ancestors {
+			if id == model.ID() {
+				pos = i
+			}
+		}
+		if pos < 0 {
+			continue
+		}
+
+		// compute lineage
+		lineage := make([]ID, 0, len(path)+len(ancestors)-pos-1)
+		lineage = append(lineage, path...)
+		lineage = append(lineage, ancestors[pos+1:]...)
+
+		// check change
+		var changed bool
+		m.setTree(descendant, lineage, &changed)
+		if !changed {
+			continue
+		}
+
+		// save tree
+		err = m.saveTree(ctx, descendant)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) setTree(model Model, lineage []ID, changed *bool) {
+	// get tree
+	tree := m.meta.Tree
+
+	// ensure lineage
+	if lineage == nil {
+		lineage = []ID{}
+	}
+
+	// track change
+	if !sameIDs(stick.MustGet(model, tree.Ancestors).([]ID), lineage) || stick.MustGetRaw(model, tree.Depth).Int() != int64(len(lineage)) {
+		if changed != nil {
+			*changed = true
+		}
+	}
+
+	// set fields
+	stick.MustSet(model, tree.Ancestors, lineage)
+	stick.MustGetRaw(model, tree.Depth).SetInt(int64(len(lineage)))
+}
+
+func (m *Manager) saveTree(ctx context.Context, model Model) error {
+	// get tree
+	tree := m.meta.Tree
+
+	// update document
+	_, err := m.coll.UpdateOne(ctx, bson.M{
+		"_id": model.ID(),
+	}, bson.M{
+		"$set": bson.M{
+			m.meta.Fields[tree.Ancestors].BSONKey: stick.MustGet(model, tree.Ancestors),
+			m.meta.Fields[tree.Depth].BSONKey:     stick.MustGetRaw(model, tree.Depth).Interface(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func sameIDs(a, b []ID) bool {
+	// check length
+	if len(a) != len(b) {
+		return false
+	}
+
+	// check items
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
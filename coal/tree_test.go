@@ -0,0 +1,267 @@
+package coal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+func init() {
+	AddTree(&folderModel{}, "Parent", "Ancestors", "Depth")
+}
+
+func TestAddTree(t *testing.T) {
+	assert.Equal(t, &Tree{
+		Parent:    "Parent",
+		Ancestors: "Ancestors",
+		Depth:     "Depth",
+	}, GetMeta(&folderModel{}).Tree)
+
+	assert.PanicsWithValue(t, `coal: field "Post" is not an optional to-one relationship referencing "comments"`, func() {
+		AddTree(&commentModel{}, "Post", "Ancestors", "Depth")
+	})
+
+	assert.PanicsWithValue(t, `coal: ancestors field "Name" is not of type "[]coal.ID"`, func() {
+		AddTree(&folderModel{}, "Parent", "Name", "Depth")
+	})
+
+	assert.PanicsWithValue(t, `coal: depth field "Name" is not an integer`, func() {
+		AddTree(&folderModel{}, "Parent", "Ancestors", "Name")
+	})
+
+	assert.PanicsWithValue(t, `coal: tree already registered on "coal.folderModel"`, func() {
+		AddTree(&folderModel{}, "Parent", "Ancestors", "Depth")
+	})
+}
+
+func TestTreeInsert(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		root := tester.Insert(&folderModel{Name: "root"}).(*folderModel)
+		assert.Equal(t, []ID{}, root.Ancestors)
+		assert.Equal(t, 0, root.Depth)
+
+		child := tester.Insert(&folderModel{Name: "child", Parent: stick.P(root.ID())}).(*folderModel)
+		assert.Equal(t, []ID{root.ID()}, child.Ancestors)
+		assert.Equal(t, 1, child.Depth)
+
+		/* batch */
+
+		a := &folderModel{Base: B(), Name: "a", Parent: stick.P(child.ID())}
+		b := &folderModel{Base: B(), Name: "b"}
+		c := &folderModel{Base: B(), Name: "c", Parent: stick.P(b.ID())}
+		b.Parent = stick.P(a.ID())
+
+		err := tester.Store.M(&folderModel{}).InsertAll(nil, []Model{c, b, a})
+		assert.NoError(t, err)
+		assert.Equal(t, []ID{root.ID(), child.ID()}, a.Ancestors)
+		assert.Equal(t, []ID{root.ID(), child.ID(), a.ID()}, b.Ancestors)
+		assert.Equal(t, []ID{root.ID(), child.ID(), a.ID(), b.ID()}, c.Ancestors)
+		assert.Equal(t, 4, c.Depth)
+
+		/* errors */
+
+		err = tester.Store.M(&folderModel{}).Insert(nil, &folderModel{Parent: stick.P(New())})
+		assert.True(t, ErrMissingParent.Is(err))
+
+		self := &folderModel{Base: B()}
+		self.Parent = stick.P(self.ID())
+		err = tester.Store.M(&folderModel{}).Insert(nil, self)
+		assert.True(t, ErrTreeCycle.Is(err))
+
+		d := &folderModel{Base: B()}
+		e := &folderModel{Base: B(), Parent: stick.P(d.ID())}
+		d.Parent = stick.P(e.ID())
+		err = tester.Store.M(&folderModel{}).InsertAll(nil, []Model{d, e})
+		assert.True(t, ErrTreeCycle.Is(err))
+
+		assert.Equal(t, 5, tester.Count(&folderModel{}))
+	})
+}
+
+func TestTreeMove(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		a := tester.Insert(&folderModel{Name: "a"}).(*folderModel)
+		b := tester.Insert(&folderModel{Name: "b", Parent: stick.P(a.ID())}).(*folderModel)
+		c := tester.Insert(&folderModel{Name: "c", Parent: stick.P(b.ID())}).(*folderModel)
+		d := tester.Insert(&folderModel{Name: "d", Parent: stick.P(c.ID())}).(*folderModel)
+		x := tester.Insert(&folderModel{Name: "x"}).(*folderModel)
+
+		manager := tester.Store.M(&folderModel{})
+
+		/* transaction */
+
+		found, err := manager.Move(nil, b.ID(), stick.P(x.ID()))
+		assert.True(t, ErrTransactionRequired.Is(err))
+		assert.False(t, found)
+
+		_, err = manager.Update(nil, nil, b.ID(), bson.M{
+			"$set": bson.M{
+				"Parent": x.ID(),
+			},
+		}, false)
+		assert.True(t, ErrTransactionRequired.Is(err))
+
+		/* move */
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			found, err := manager.Move(ctx, b.ID(), stick.P(x.ID()))
+			assert.True(t, found)
+			return err
+		})
+		assert.NoError(t, err)
+
+		b = tester.Fetch(&folderModel{}, b.ID()).(*folderModel)
+		assert.Equal(t, []ID{x.ID()}, b.Ancestors)
+		assert.Equal(t, 1, b.Depth)
+
+		c = tester.Fetch(&folderModel{}, c.ID()).(*folderModel)
+		assert.Equal(t, []ID{x.ID(), b.ID()}, c.Ancestors)
+		assert.Equal(t, 2, c.Depth)
+
+		d = tester.Fetch(&folderModel{}, d.ID()).(*folderModel)
+		assert.Equal(t, []ID{x.ID(), b.ID(), c.ID()}, d.Ancestors)
+		assert.Equal(t, 3, d.Depth)
+
+		/* cycle */
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			_, err := manager.Move(ctx, b.ID(), stick.P(d.ID()))
+			return err
+		})
+		assert.True(t, ErrTreeCycle.Is(err))
+
+		d = tester.Fetch(&folderModel{}, d.ID()).(*folderModel)
+		assert.Equal(t, []ID{x.ID(), b.ID(), c.ID()}, d.Ancestors)
+
+		/* root */
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			_, err := manager.Move(ctx, c.ID(), nil)
+			return err
+		})
+		assert.NoError(t, err)
+
+		c = tester.Fetch(&folderModel{}, c.ID()).(*folderModel)
+		assert.Equal(t, []ID{}, c.Ancestors)
+		assert.Equal(t, 0, c.Depth)
+
+		d = tester.Fetch(&folderModel{}, d.ID()).(*folderModel)
+		assert.Equal(t, []ID{c.ID()}, d.Ancestors)
+		assert.Equal(t, 1, d.Depth)
+
+		/* replace */
+
+		c.Parent = stick.P(a.ID())
+		_, err = manager.Replace(nil, c, false)
+		assert.True(t, ErrTransactionRequired.Is(err))
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			_, err := manager.Replace(ctx, c, false)
+			return err
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []ID{a.ID()}, c.Ancestors)
+
+		d = tester.Fetch(&folderModel{}, d.ID()).(*folderModel)
+		assert.Equal(t, []ID{a.ID(), c.ID()}, d.Ancestors)
+		assert.Equal(t, 2, d.Depth)
+
+		/* unchanged replace */
+
+		c.Name = "C"
+		found, err = manager.Replace(nil, c, false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+
+		/* update all */
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			_, err := manager.UpdateAll(ctx, bson.M{
+				"Parent": a.ID(),
+			}, bson.M{
+				"$set": bson.M{
+					"Parent": x.ID(),
+				},
+			}, false)
+			return err
+		})
+		assert.NoError(t, err)
+
+		d = tester.Fetch(&folderModel{}, d.ID()).(*folderModel)
+		assert.Equal(t, []ID{x.ID(), c.ID()}, d.Ancestors)
+		assert.Equal(t, 2, d.Depth)
+	})
+}
+
+func TestTreeQueries(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		a := tester.Insert(&folderModel{Name: "a"}).(*folderModel)
+		b := tester.Insert(&folderModel{Name: "b", Parent: stick.P(a.ID())}).(*folderModel)
+		c := tester.Insert(&folderModel{Name: "c", Parent: stick.P(b.ID())}).(*folderModel)
+		d := tester.Insert(&folderModel{Name: "d", Parent: stick.P(c.ID())}).(*folderModel)
+		e := tester.Insert(&folderModel{Name: "e", Parent: stick.P(a.ID())}).(*folderModel)
+
+		manager := tester.Store.M(&folderModel{})
+
+		var list []*folderModel
+		found, err := manager.Ancestors(nil, &list, d.ID(), NoTransaction)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, []*folderModel{a, b, c}, list)
+
+		found, err = manager.Ancestors(nil, &list, a.ID(), NoTransaction)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Empty(t, list)
+
+		found, err = manager.Ancestors(nil, &list, New(), NoTransaction)
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		found, err = manager.Descendants(nil, &list, a.ID(), 0, NoTransaction)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Len(t, list, 4)
+		assert.Equal(t, b.ID(), list[0].ID())
+		assert.Equal(t, e.ID(), list[1].ID())
+		assert.Equal(t, c, list[2])
+		assert.Equal(t, d, list[3])
+
+		found, err = manager.Descendants(nil, &list, b.ID(), 1, NoTransaction)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, []*folderModel{c}, list)
+	})
+}
+
+func TestRetree(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		a := tester.Insert(&folderModel{Name: "a"}).(*folderModel)
+		b := tester.Insert(&folderModel{Name: "b", Parent: stick.P(a.ID())}).(*folderModel)
+		c := tester.Insert(&folderModel{Name: "c", Parent: stick.P(b.ID())}).(*folderModel)
+
+		_, err := tester.Store.C(&folderModel{}).UpdateMany(nil, bson.M{}, bson.M{
+			"$set": bson.M{
+				"ancestors": bson.A{},
+				"depth":     7,
+			},
+		})
+		assert.NoError(t, err)
+
+		n, err := Retree(nil, tester.Store, &folderModel{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+
+		assert.Equal(t, a, tester.Fetch(&folderModel{}, a.ID()))
+		assert.Equal(t, b, tester.Fetch(&folderModel{}, b.ID()))
+		assert.Equal(t, c, tester.Fetch(&folderModel{}, c.ID()))
+
+		n, err = Retree(nil, tester.Store, &folderModel{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+	})
+}
@@ -56,6 +56,30 @@ func (m *noteModel) Validate() error {
 	return nil
 }
 
+type folderModel struct {
+	Base      `json:"-" bson:",inline" coal:"folders"`
+	Name      string  `json:"name"`
+	Parent    *ID     `json:"-" coal:"parent:folders"`
+	Children  HasMany `json:"-" bson:"-" coal:"children:folders:parent"`
+	Ancestors []ID    `json:"-"`
+	Depth     int     `json:"depth"`
+}
+
+func (m *folderModel) Validate() error {
+	return nil
+}
+
+type itemModel struct {
+	Base `json:"-" bson:",inline" coal:"items"`
+	Name string `json:"name"`
+	List string `json:"list"`
+	Rank Rank   `json:"rank"`
+}
+
+func (m *itemModel) Validate() error {
+	return nil
+}
+
 func init() {
 	AddIndex(&postModel{}, false, 0, "Published", "Title")
 	AddPartialIndex(&postModel{}, false, 0, []string{"-TextBody"}, bson.M{
@@ -66,7 +90,7 @@ func init() {
 var mongoStore = MustConnect("mongodb://0.0.0.0/test-fire-coal", xo.Panic)
 var lungoStore = MustOpen(nil, "test-fire-coal", xo.Panic)
 
-var modelList = []Model{&postModel{}, &commentModel{}, &selectionModel{}, &noteModel{}, &fooModel{}}
+var modelList = []Model{&postModel{}, &commentModel{}, &selectionModel{}, &noteModel{}, &fooModel{}, &blogModel{}, &entryModel{}, &pinModel{}, &secretModel{}, &hookModel{}, &authorModel{}, &articleModel{}, &shelfModel{}, &bookModel{}, &folderModel{}, &itemModel{}}
 
 func withTester(t *testing.T, fn func(*testing.T, *Tester)) {
 	t.Run("Mongo", func(t *testing.T) {
@@ -29,6 +29,32 @@ func Verify(models []Model, ignored ...string) error {
 				continue
 			}
 
+			// check polymorphic relationships
+			if field.PolyToOne || field.PolyToMany {
+				for _, relType := range field.RelTypes {
+					// get related meta
+					relMeta := index[relType]
+					if relMeta == nil {
+						return xo.F("missing type %s for relationship %s", relType, key)
+					}
+
+					// check inverse
+					var f *Field
+					for _, rField := range relMeta.Relationships {
+						if rField.RelType == modelMeta.PluralName && rField.RelInverse == name {
+							f = rField
+						}
+					}
+					if f == nil {
+						return xo.F("missing has-one/to-many relationship %s for type %s", key, relType)
+					} else if !f.HasOne && !f.HasMany {
+						return xo.F("expected has-one/to-many relationship %s for type %s", key, relType)
+					}
+				}
+
+				continue
+			}
+
 			// get related meta
 			relMeta := index[field.RelType]
 			if relMeta == nil {
@@ -52,8 +78,10 @@ func Verify(models []Model, ignored ...string) error {
 				rel := relMeta.Relationships[field.RelInverse]
 				if rel == nil {
 					return xo.F("missing to-one/to-many relationship %s", key)
-				} else if !rel.ToOne && !rel.ToMany {
+				} else if !rel.ToOne && !rel.ToMany && !rel.PolyToOne && !rel.PolyToMany {
 					return xo.F("expected to-one/to-many relationship %s", key)
+				} else if (rel.PolyToOne || rel.PolyToMany) && !stick.Contains(rel.RelTypes, modelMeta.PluralName) {
+					return xo.F("expected polymorphic relationship %s to include type %s", key, modelMeta.PluralName)
 				}
 			}
 		}
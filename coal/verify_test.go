@@ -4,9 +4,49 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/256dpi/fire/stick"
 )
 
 func TestVerify(t *testing.T) {
 	err := Verify(modelList)
 	assert.NoError(t, err)
 }
+
+func TestVerifyPolymorphic(t *testing.T) {
+	type post struct {
+		Base     `json:"-" bson:",inline" coal:"posts"`
+		Comments HasMany `json:"-" bson:"-" coal:"comments:comments:parent"`
+		stick.NoValidation
+	}
+
+	type photo struct {
+		Base     `json:"-" bson:",inline" coal:"photos"`
+		Comments HasMany `json:"-" bson:"-" coal:"comments:comments:parent"`
+		stick.NoValidation
+	}
+
+	type video struct {
+		Base `json:"-" bson:",inline" coal:"videos"`
+		stick.NoValidation
+	}
+
+	type comment struct {
+		Base   `json:"-" bson:",inline" coal:"comments"`
+		Parent Ref `json:"-" bson:"parent" coal:"parent:posts|photos"`
+		stick.NoValidation
+	}
+
+	type badComment struct {
+		Base   `json:"-" bson:",inline" coal:"comments"`
+		Parent Ref `json:"-" bson:"parent" coal:"parent:posts|videos"`
+		stick.NoValidation
+	}
+
+	err := Verify([]Model{&post{}, &photo{}, &comment{}})
+	assert.NoError(t, err)
+
+	err = Verify([]Model{&post{}, &video{}, &badComment{}})
+	assert.Error(t, err)
+	assert.Equal(t, "missing has-one/to-many relationship coal.badComment#parent for type videos", err.Error())
+}
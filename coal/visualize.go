@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os/exec"
-	"sort"
 	"strings"
 
 	"github.com/256dpi/xo"
@@ -79,39 +78,16 @@ func VisualizeDOT(title string, models ...Model) string {
 	out.WriteString("  edge[headclip=true, tailclip=false];\n")
 	out.WriteString("  label=\"" + title + "\";\n")
 
-	// prepare catalog
-	catalog := make(map[string]Model)
-	for _, model := range models {
-		catalog[GetMeta(model).PluralName] = model
-	}
-
-	// get a sorted list of model names and lookup table
-	var names []string
-	lookup := make(map[string]string)
-	for name, model := range catalog {
-		names = append(names, name)
-		lookup[name] = GetMeta(model).Name
-	}
-	sort.Strings(names)
+	// build graph
+	graph := BuildGraph(models...)
 
 	// add model nodes
-	for _, name := range names {
-		// get model
-		model := catalog[name]
-
-		// get meta
-		meta := GetMeta(model)
-
+	for _, model := range graph.Models {
 		// prepare index info
 		indexedInfo := map[string]string{}
-		for _, field := range meta.OrderedFields {
-			indexedInfo[field.Name] = ""
-		}
-
-		// analyse indexes
-		for _, index := range meta.Indexes {
+		for _, index := range model.Indexes {
 			for i, field := range index.Fields {
-				if index.Filter != nil {
+				if index.Partial {
 					indexedInfo[field] += "◌"
 				} else {
 					if i == 0 {
@@ -124,18 +100,17 @@ func VisualizeDOT(title string, models ...Model) string {
 		}
 
 		// write begin of node
-		out.WriteString(fmt.Sprintf(`  "%s" [ style=filled, fillcolor=white, label=`, lookup[name]))
+		out.WriteString(fmt.Sprintf(`  "%s" [ style=filled, fillcolor=white, label=`, model.Name))
 
 		// write head table
-		out.WriteString(fmt.Sprintf(`<<table border="0" align="center" cellspacing="0.5" cellpadding="0" width="134"><tr><td align="center" valign="bottom" width="130"><font face="Arial" point-size="11">%s</font></td></tr></table>|`, lookup[name]))
+		out.WriteString(fmt.Sprintf(`<<table border="0" align="center" cellspacing="0.5" cellpadding="0" width="134"><tr><td align="center" valign="bottom" width="130"><font face="Arial" point-size="11">%s</font></td></tr></table>|`, model.Name))
 
 		// write begin of tail table
 		out.WriteString(`<table border="0" align="left" cellspacing="2" cellpadding="0" width="134">`)
 
 		// write attributes
-		for _, field := range GetMeta(model).OrderedFields {
-			typ := strings.ReplaceAll(field.Type.String(), "primitive.ObjectID", "coal.ID")
-			typ = dotEscape(typ)
+		for _, field := range model.Fields {
+			typ := dotEscape(field.Type)
 			out.WriteString(fmt.Sprintf(`<tr><td align="left" width="130" port="%s">%s<font face="Arial" color="grey60"> %s %s</font></td></tr>`, field.Name, field.Name, typ, indexedInfo[field.Name]))
 		}
 
@@ -146,74 +121,22 @@ func VisualizeDOT(title string, models ...Model) string {
 		out.WriteString(`, shape=Mrecord, fontsize=10, fontname="Arial", margin="0.07,0.05", penwidth="1.0" ];` + "\n")
 	}
 
-	// define temporary struct
-	type rel struct {
-		from, to   string
-		srcMany    bool
-		dstMany    bool
-		hasInverse bool
-	}
-
-	// prepare list
-	list := make(map[string]*rel)
-	var relNames []string
-
-	// prepare relationships
-	for _, name := range names {
-		// get model
-		model := catalog[name]
-
-		// add all direct relationships
-		for _, field := range GetMeta(model).OrderedFields {
-			if field.RelName != "" && (field.ToOne || field.ToMany) {
-				list[name+"-"+field.RelName] = &rel{
-					from:    name,
-					to:      field.RelType,
-					srcMany: field.ToMany,
-				}
-
-				relNames = append(relNames, name+"-"+field.RelName)
-			}
-		}
-	}
-
-	// update relationships
-	for _, name := range names {
-		// get model
-		model := catalog[name]
-
-		// add all indirect relationships
-		for _, field := range GetMeta(model).OrderedFields {
-			if field.RelName != "" && (field.HasOne || field.HasMany) {
-				r := list[field.RelType+"-"+field.RelInverse]
-				r.dstMany = field.HasMany
-				r.hasInverse = true
-			}
-		}
-	}
-
-	// sort relationship names
-	sort.Strings(relNames)
-
 	// add relationships
-	for _, name := range relNames {
-		// get relationship
-		r := list[name]
-
+	for _, rel := range graph.Relationships {
 		// get style
 		style := "solid"
-		if !r.hasInverse {
+		if rel.Inverse == "" {
 			style = "dotted"
 		}
 
 		// get color
 		color := "black"
-		if r.srcMany {
+		if rel.Many {
 			color = "black:white:black"
 		}
 
 		// write edge
-		out.WriteString(fmt.Sprintf(`  "%s"--"%s"[ fontname="Arial", fontsize=7, dir=both, arrowsize="0.9", penwidth="0.9", labelangle=32, labeldistance="1.8", style=%s, color="%s", arrowhead=%s, arrowtail=%s ];`, lookup[r.from], lookup[r.to], style, color, "normal", "none") + "\n")
+		out.WriteString(fmt.Sprintf(`  "%s"--"%s"[ fontname="Arial", fontsize=7, dir=both, arrowsize="0.9", penwidth="0.9", labelangle=32, labeldistance="1.8", style=%s, color="%s", arrowhead=%s, arrowtail=%s ];`, graph.lookup(rel.From).Name, graph.lookup(rel.To).Name, style, color, "normal", "none") + "\n")
 	}
 
 	// end graph
@@ -222,6 +145,19 @@ func VisualizeDOT(title string, models ...Model) string {
 	return out.String()
 }
 
+// VisualizeMermaid emits a Mermaid entity relationship diagram that visualizes
+// the models and their relationships. Unlike the DOT output it can be rendered
+// without additional tooling e.g. in Markdown documents.
+func VisualizeMermaid(title string, models ...Model) string {
+	return BuildGraph(models...).Mermaid(title)
+}
+
+// VisualizeJSON returns a JSON document that describes the models, their
+// fields, indexes and relationships.
+func VisualizeJSON(models ...Model) ([]byte, error) {
+	return BuildGraph(models...).JSON()
+}
+
 func dotEscape(str string) string {
 	str = strings.ReplaceAll(str, "[", "&#91;")
 	str = strings.ReplaceAll(str, "]", "&#93;")
@@ -40,3 +40,89 @@ func TestCatalogVisualizeDOT(t *testing.T) {
 }
 `, out)
 }
+
+func TestCatalogVisualizeMermaid(t *testing.T) {
+	out := VisualizeMermaid("Test", &postModel{}, &commentModel{}, &selectionModel{}, &noteModel{})
+	assert.Equal(t, `---
+title: Test
+---
+erDiagram
+  coal_commentModel {
+    coal_ID _id PK
+    string Message
+    coal_ID Post FK
+    coal_ID Parent FK
+  }
+  coal_noteModel {
+    coal_ID _id PK
+    string Title
+    time_Time CreatedAt
+    time_Time UpdatedAt
+    coal_ID Post FK
+  }
+  coal_postModel {
+    coal_ID _id PK
+    string Title
+    bool Published
+    string TextBody
+  }
+  coal_selectionModel {
+    coal_ID _id PK
+    string Name
+    coal_ID[] Posts FK
+  }
+  coal_commentModel }o--o| coal_commentModel : parent
+  coal_commentModel }o--|| coal_postModel : post
+  coal_noteModel |o--|| coal_postModel : post
+  coal_selectionModel }o--o{ coal_postModel : posts
+`, out)
+}
+
+func TestCatalogVisualizeJSON(t *testing.T) {
+	out, err := VisualizeJSON(&postModel{}, &commentModel{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"pluralName": "posts"`)
+
+	graph := BuildGraph(&postModel{}, &commentModel{})
+	assert.Len(t, graph.Models, 2)
+	assert.Equal(t, GraphModel{
+		Name:       "coal.commentModel",
+		Package:    "github.com/256dpi/fire/coal",
+		PluralName: "comments",
+		Collection: "comments",
+		Fields: []GraphField{
+			{Name: "Message", Type: "string", JSONKey: "message", BSONKey: "message"},
+			{Name: "Post", Type: "coal.ID", BSONKey: "post_id", RelName: "post", RelType: "posts"},
+			{Name: "Parent", Type: "*coal.ID", BSONKey: "parent", Optional: true, RelName: "parent", RelType: "comments"},
+			{Name: "Children", Type: "coal.HasMany", RelName: "children", RelType: "comments", Virtual: true},
+		},
+	}, graph.Models[0])
+	assert.Equal(t, []GraphIndex{
+		{Fields: []string{"Published", "Title"}},
+		{Fields: []string{"TextBody"}, Partial: true},
+	}, graph.Models[1].Indexes)
+	assert.Equal(t, []GraphRelationship{
+		{From: "comments", To: "comments", Name: "parent", Field: "Parent", Optional: true, Inverse: "children", InverseMany: true},
+		{From: "comments", To: "posts", Name: "post", Field: "Post", Inverse: "comments", InverseMany: true},
+	}, graph.Relationships)
+}
+
+func TestCatalogGraphFilter(t *testing.T) {
+	graph := BuildGraph(&postModel{}, &commentModel{}, &selectionModel{}, &noteModel{})
+
+	filtered := graph.Filter(ByName("comments", "coal.post*"))
+	assert.Len(t, filtered.Models, 2)
+	assert.Len(t, filtered.Relationships, 2)
+
+	filtered = graph.Filter(ByName("notes"))
+	assert.Len(t, filtered.Models, 1)
+	assert.Empty(t, filtered.Relationships)
+
+	filtered = graph.Filter(ByPackage("github.com/256dpi/fire/coal"))
+	assert.Equal(t, graph, filtered)
+
+	groups := graph.Group()
+	assert.Equal(t, map[string]*Graph{
+		"github.com/256dpi/fire/coal": graph,
+	}, groups)
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,6 +28,8 @@ const blankCursor = "*"
 
 var cursorEncoding = base64.URLEncoding.WithPadding(base64.NoPadding)
 
+var treeFilters = []string{"ancestor", "depth", "min-depth", "max-depth"}
+
 // Stage defines a controller callback stage.
 type Stage int
 
@@ -102,7 +105,9 @@ type Controller struct {
 	FilterHandlers map[string]FilterHandler
 
 	// Sorters is a list of fields that are sortable. Only fields that are
-	// exposed and indexed should be made sortable.
+	// exposed and indexed should be made sortable. If the model has a
+	// registered ranking (see coal.AddRanking), resources are sorted by rank
+	// unless a sorting is requested.
 	//
 	// Note: The "sort" query parameters is used for sorting.
 	Sorters []string
@@ -195,6 +200,12 @@ type Controller struct {
 	// are used for cursor based pagination.
 	CursorPagination bool
 
+	// ListReadOptions can be set to attach the specified read options to the
+	// context of List operations, e.g. to read from secondaries. As List
+	// operations are run in a transaction, the options are ignored by the
+	// store while the transaction is active.
+	ListReadOptions *coal.ReadOptions
+
 	// DocumentLimit defines the maximum allowed size of an incoming document.
 	// The serve.ByteSize helper can be used to set the value.
 	//
@@ -247,6 +258,24 @@ type Controller struct {
 	// a TTL index to delete the documents automatically after some timeout.
 	SoftDelete bool
 
+	// Dependents can be set to a registry of models to enable the declarative
+	// on-delete behaviours. When a resource is deleted, the behaviours of the
+	// to-one and to-many relationships that reference the model are applied as
+	// part of the transaction using coal.Manager.Cascade. Dependent documents
+	// of models with a "fire-soft-delete" field are soft deleted. If the
+	// deletion is restricted, the request is aborted with a bad request error.
+	Dependents *coal.Registry
+
+	// Tree can be set to true to enable the tree filters for models with a
+	// registered tree (see coal.AddTree). The "ancestor" filter selects all
+	// descendants of the specified resources while the "depth", "min-depth"
+	// and "max-depth" filters select resources by their depth. The filters
+	// require the parent relationship to be readable.
+	//
+	// Note: The filter[ancestor] and filter[*depth] query parameters are used
+	// for filtering.
+	Tree bool
+
 	parser     jsonapi.Parser
 	meta       *coal.Meta
 	properties map[string]func(coal.Model) (interface{}, error)
@@ -346,6 +375,11 @@ func (c *Controller) prepare() {
 		}
 	}
 
+	// check tree
+	if c.Tree && c.meta.Tree == nil {
+		panic(fmt.Sprintf(`fire: model "%s" has no tree`, c.meta.Name))
+	}
+
 	// check filter handlers
 	for name := range c.FilterHandlers {
 		if !stick.Contains(c.Filters, name) {
@@ -438,9 +472,14 @@ func (c *Controller) handle(prefix string, ctx *Context, selector bson.M, write
 	ctx.ReadableProperties = c.initialProperties(ctx.JSONAPIRequest)
 	ctx.RelationshipFilters = map[string][]bson.M{}
 
-	// run operation with transaction if not an action
+	// attach read options to list operations
+	if ctx.Operation == List && c.ListReadOptions != nil {
+		ctx.Context = coal.WithReadOptions(ctx.Context, *c.ListReadOptions)
+	}
+
+	// run operation with transaction of the model store if not an action
 	if !ctx.Operation.Action() {
-		xo.AbortIf(c.Store.T(ctx.Context, ctx.Operation.Read(), func(tc context.Context) error {
+		xo.AbortIf(c.Store.S(c.Model).T(ctx.Context, ctx.Operation.Read(), func(tc context.Context) error {
 			return ctx.With(tc, func() error {
 				c.runOperation(ctx)
 				return nil
@@ -863,6 +902,15 @@ func (c *Controller) deleteResource(ctx *Context) {
 		}
 	}
 
+	// apply on-delete behaviours
+	if c.Dependents != nil {
+		err = ctx.Store.M(c.Model).Cascade(ctx, ctx.Model.ID(), c.Dependents, "fire-soft-delete")
+		if coal.ErrDeleteRestricted.Is(err) {
+			xo.Abort(jsonapi.BadRequest("resource has dependent resources"))
+		}
+		xo.AbortIf(err)
+	}
+
 	// run notifiers
 	c.runCallbacks(ctx, Notifier, c.Notifiers, http.StatusInternalServerError)
 
@@ -896,6 +944,12 @@ func (c *Controller) getRelatedResources(ctx *Context) {
 		xo.Abort(jsonapi.BadRequest("relationship is not readable"))
 	}
 
+	// handle polymorphic relationships
+	if rel.PolyToOne || rel.PolyToMany {
+		c.getPolymorphicRelatedResources(ctx, rel)
+		return
+	}
+
 	// get related controller
 	rc := ctx.Group.controllers[rel.RelType]
 	if rc == nil {
@@ -984,7 +1038,7 @@ func (c *Controller) getRelatedResources(ctx *Context) {
 
 		// prepare selector
 		selector := bson.M{
-			inverse.Name: ctx.Model.ID(),
+			inverse.Name: c.inverseReference(inverse, ctx.Model),
 		}
 
 		// handle virtual request
@@ -1015,7 +1069,7 @@ func (c *Controller) getRelatedResources(ctx *Context) {
 		// prepare selector
 		selector := bson.M{
 			inverse.Name: bson.M{
-				"$in": []coal.ID{ctx.Model.ID()},
+				"$in": []interface{}{c.inverseReference(inverse, ctx.Model)},
 			},
 		}
 
@@ -1037,6 +1091,106 @@ func (c *Controller) getRelatedResources(ctx *Context) {
 	ctx.Response.Links.Last = jsonapi.Link(strings.Replace(string(ctx.Response.Links.Last), from, to, 1))
 }
 
+func (c *Controller) getPolymorphicRelatedResources(ctx *Context, rel *coal.Field) {
+	// trace
+	ctx.Tracer.Push("fire/Controller.getPolymorphicRelatedResources")
+	defer ctx.Tracer.Pop()
+
+	// get references
+	var refs []coal.Ref
+	if rel.PolyToOne && rel.Optional {
+		if ref := stick.MustGet(ctx.Model, rel.Name).(*coal.Ref); ref != nil {
+			refs = append(refs, *ref)
+		}
+	} else if rel.PolyToOne {
+		refs = append(refs, stick.MustGet(ctx.Model, rel.Name).(coal.Ref))
+	} else {
+		refs = stick.MustGet(ctx.Model, rel.Name).([]coal.Ref)
+	}
+
+	// group ids by type
+	var types []string
+	ids := map[string][]coal.ID{}
+	for _, ref := range refs {
+		if !ref.IsZero() {
+			if ids[ref.Type] == nil {
+				types = append(types, ref.Type)
+			}
+			ids[ref.Type] = append(ids[ref.Type], ref.ID)
+		}
+	}
+
+	// prepare resources
+	resources := make([]*jsonapi.Resource, 0, len(refs))
+
+	// list resources of each type
+	for _, typ := range types {
+		// get related controller
+		rc := ctx.Group.controllers[typ]
+		if rc == nil {
+			xo.Abort(xo.F("missing related controller for %s", typ))
+		}
+
+		// prepare sub context
+		subCtx := &Context{
+			Context:        ctx,
+			Data:           stick.Map{},
+			Parent:         ctx.Model,
+			HTTPRequest:    ctx.HTTPRequest,
+			ResponseWriter: nil,
+			Controller:     rc,
+			Group:          ctx.Group,
+			Tracer:         ctx.Tracer,
+		}
+
+		// copy and prepare request
+		req := *ctx.JSONAPIRequest
+		req.Intent = jsonapi.ListResources
+		req.ResourceType = typ
+		req.ResourceID = ""
+		req.RelatedResource = ""
+		subCtx.JSONAPIRequest = &req
+
+		// prepare selector
+		selector := bson.M{
+			"_id": bson.M{"$in": ids[typ]},
+		}
+
+		// handle virtual request
+		rc.handle("", subCtx, selector, false)
+
+		// collect resources
+		resources = append(resources, subCtx.Response.Data.Many...)
+	}
+
+	// prepare response
+	ctx.Response = &jsonapi.Document{
+		Data: &jsonapi.HybridResource{
+			Many: resources,
+		},
+		Links: &jsonapi.DocumentLinks{
+			Self: jsonapi.Link(ctx.JSONAPIRequest.Self()),
+		},
+	}
+	ctx.ResponseCode = http.StatusOK
+
+	// finish to-one relationship
+	if rel.PolyToOne {
+		// check response
+		if len(resources) > 1 {
+			xo.Abort(xo.F("to one relationship returned more than one result"))
+		}
+
+		// pull out resource
+		if len(resources) == 1 {
+			ctx.Response.Data.One = resources[0]
+		}
+
+		// unset list
+		ctx.Response.Data.Many = nil
+	}
+}
+
 func (c *Controller) getRelationship(ctx *Context) {
 	// trace
 	ctx.Tracer.Push("fire/Controller.getRelationship")
@@ -1099,7 +1253,7 @@ func (c *Controller) setRelationship(ctx *Context) {
 
 	// get relationship
 	rel := c.meta.Relationships[ctx.JSONAPIRequest.Relationship]
-	if rel == nil || (!rel.ToOne && !rel.ToMany) {
+	if rel == nil || (!rel.ToOne && !rel.ToMany && !rel.PolyToOne && !rel.PolyToMany) {
 		xo.Abort(jsonapi.BadRequest("invalid relationship"))
 	}
 
@@ -1176,7 +1330,7 @@ func (c *Controller) appendToRelationship(ctx *Context) {
 
 	// get relationship
 	rel := c.meta.Relationships[ctx.JSONAPIRequest.Relationship]
-	if rel == nil || !rel.ToMany {
+	if rel == nil || (!rel.ToMany && !rel.PolyToMany) {
 		xo.Abort(jsonapi.BadRequest("invalid relationship"))
 	}
 
@@ -1190,6 +1344,23 @@ func (c *Controller) appendToRelationship(ctx *Context) {
 
 	// process all references
 	for _, ref := range ctx.Request.Data.Many {
+		// handle polymorphic references
+		if rel.PolyToMany {
+			// get reference
+			polyRef := c.polymorphicReference(ref, rel)
+
+			// get current references
+			refs := stick.MustGet(ctx.Model, rel.Name).([]coal.Ref)
+
+			// add reference if not present
+			if !stick.Contains(refs, polyRef) {
+				refs = append(refs, polyRef)
+				stick.MustSet(ctx.Model, rel.Name, refs)
+			}
+
+			continue
+		}
+
 		// check type
 		if ref.Type != rel.RelType {
 			xo.Abort(jsonapi.BadRequest("resource type mismatch"))
@@ -1276,7 +1447,7 @@ func (c *Controller) removeFromRelationship(ctx *Context) {
 
 	// get relationship
 	rel := c.meta.Relationships[ctx.JSONAPIRequest.Relationship]
-	if rel == nil || !rel.ToMany {
+	if rel == nil || (!rel.ToMany && !rel.PolyToMany) {
 		xo.Abort(jsonapi.BadRequest("invalid relationship"))
 	}
 
@@ -1290,6 +1461,24 @@ func (c *Controller) removeFromRelationship(ctx *Context) {
 
 	// process all references
 	for _, ref := range ctx.Request.Data.Many {
+		// handle polymorphic references
+		if rel.PolyToMany {
+			// get reference
+			polyRef := c.polymorphicReference(ref, rel)
+
+			// remove reference if present
+			refs := stick.MustGet(ctx.Model, rel.Name).([]coal.Ref)
+			for i, r := range refs {
+				if r == polyRef {
+					refs = append(refs[:i], refs[i+1:]...)
+					stick.MustSet(ctx.Model, rel.Name, refs)
+					break
+				}
+			}
+
+			continue
+		}
+
 		// check type
 		if ref.Type != rel.RelType {
 			xo.Abort(jsonapi.BadRequest("resource type mismatch"))
@@ -1431,7 +1620,7 @@ func (c *Controller) initialFields(write bool, r *jsonapi.Request) []string {
 
 	// add relationships
 	for _, f := range c.meta.Relationships {
-		if !write || f.ToOne || f.ToMany {
+		if !write || f.ToOne || f.ToMany || f.PolyToOne || f.PolyToMany {
 			list = append(list, f.Name)
 		}
 	}
@@ -1447,7 +1636,7 @@ func (c *Controller) initialFields(write bool, r *jsonapi.Request) []string {
 			}
 
 			// add relationship
-			if f := c.meta.Relationships[field]; f != nil && (!write || f.ToOne || f.ToMany) {
+			if f := c.meta.Relationships[field]; f != nil && (!write || f.ToOne || f.ToMany || f.PolyToOne || f.PolyToMany) {
 				requested = append(requested, f.Name)
 			}
 		}
@@ -1563,6 +1752,12 @@ func (c *Controller) loadModels(ctx *Context) {
 
 	// add filters
 	for name, values := range ctx.JSONAPIRequest.Filters {
+		// handle tree filters
+		if c.Tree && stick.Contains(treeFilters, name) {
+			ctx.Filters = append(ctx.Filters, c.treeFilter(name, values))
+			continue
+		}
+
 		// get field
 		field := c.meta.RequestFields[name]
 		if field == nil {
@@ -1688,6 +1883,11 @@ func (c *Controller) loadModels(ctx *Context) {
 		}
 	}
 
+	// sort by rank by default
+	if len(ctx.Sorting) == 0 && ctx.JSONAPIRequest.Search == "" && c.meta.Ranking != nil {
+		ctx.Sorting = []string{c.meta.Ranking.Field}
+	}
+
 	// check pagination
 	if ctx.JSONAPIRequest.Pagination != "" && ctx.JSONAPIRequest.Pagination != "offset" && ctx.JSONAPIRequest.Pagination != "cursor" {
 		xo.Abort(jsonapi.BadRequestParam("unknown pagination", "pagination"))
@@ -1726,6 +1926,14 @@ func (c *Controller) loadModels(ctx *Context) {
 
 	// check filter readability
 	for name := range ctx.JSONAPIRequest.Filters {
+		// handle tree filters
+		if c.Tree && stick.Contains(treeFilters, name) {
+			if !stick.Contains(readableFields, c.meta.Tree.Parent) {
+				xo.Abort(jsonapi.BadRequest("filter field is not readable"))
+			}
+			continue
+		}
+
 		// handle attributes filter
 		if field := c.meta.Attributes[name]; field != nil {
 			if !stick.Contains(readableFields, field.Name) {
@@ -1895,6 +2103,53 @@ func (c *Controller) loadModels(ctx *Context) {
 	c.runCallbacks(ctx, Verifier, c.Verifiers, http.StatusUnauthorized)
 }
 
+func (c *Controller) treeFilter(name string, values []string) bson.M {
+	// split values
+	var items []string
+	for _, value := range values {
+		items = append(items, strings.Split(value, ",")...)
+	}
+
+	// handle ancestor filter
+	if name == "ancestor" {
+		// convert to object ids
+		ids := make([]coal.ID, 0, len(items))
+		for _, item := range items {
+			id, err := coal.FromHex(item)
+			if err != nil {
+				xo.Abort(jsonapi.BadRequest("ancestor filter value is not an object id"))
+			}
+			ids = append(ids, id)
+		}
+
+		return bson.M{c.meta.Tree.Ancestors: bson.M{"$in": ids}}
+	}
+
+	// convert to integers
+	depths := make([]int64, 0, len(items))
+	for _, item := range items {
+		depth, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			xo.Abort(jsonapi.BadRequest("depth filter value is not an integer"))
+		}
+		depths = append(depths, depth)
+	}
+
+	// handle depth filters
+	switch name {
+	case "min-depth", "max-depth":
+		if len(depths) != 1 {
+			xo.Abort(jsonapi.BadRequest("depth filter expects a single value"))
+		}
+		if name == "min-depth" {
+			return bson.M{c.meta.Tree.Depth: bson.M{"$gte": depths[0]}}
+		}
+		return bson.M{c.meta.Tree.Depth: bson.M{"$lte": depths[0]}}
+	default:
+		return bson.M{c.meta.Tree.Depth: bson.M{"$in": depths}}
+	}
+}
+
 func (c *Controller) assignData(ctx *Context, res *jsonapi.Resource) {
 	// trace
 	ctx.Tracer.Push("fire/Controller.assignData")
@@ -1974,7 +2229,7 @@ func (c *Controller) assignData(ctx *Context, res *jsonapi.Resource) {
 		}
 
 		// check whitelist
-		if !stick.Contains(whitelist, name) || (!field.ToOne && !field.ToMany) {
+		if !stick.Contains(whitelist, name) || (!field.ToOne && !field.ToMany && !field.PolyToOne && !field.PolyToMany) {
 			// ignore violation if tolerated or verify read only access
 			if stick.Contains(c.TolerateViolations, field.Name) {
 				continue
@@ -2065,6 +2320,78 @@ func (c *Controller) assignRelationship(ctx *Context, rel *jsonapi.Document, fie
 		// set ids
 		stick.MustSet(ctx.Model, field.Name, ids)
 	}
+
+	// handle polymorphic to-one relationship
+	if field.PolyToOne {
+		// prepare zero value
+		var ref coal.Ref
+
+		// set reference if available
+		if rel.Data != nil && rel.Data.One != nil {
+			ref = c.polymorphicReference(rel.Data.One, field)
+		}
+
+		// set reference properly
+		if !field.Optional {
+			stick.MustSet(ctx.Model, field.Name, ref)
+		} else {
+			if !ref.IsZero() {
+				stick.MustSet(ctx.Model, field.Name, &ref)
+			} else {
+				stick.MustSet(ctx.Model, field.Name, stick.N[coal.Ref]())
+			}
+		}
+	}
+
+	// handle polymorphic to-many relationship
+	if field.PolyToMany {
+		// prepare references
+		var refs []coal.Ref
+
+		// check if data is available
+		if rel.Data != nil && len(rel.Data.Many) > 0 {
+			// prepare references
+			refs = make([]coal.Ref, len(rel.Data.Many))
+
+			// convert all references
+			for i, r := range rel.Data.Many {
+				refs[i] = c.polymorphicReference(r, field)
+			}
+		}
+
+		// set references
+		stick.MustSet(ctx.Model, field.Name, refs)
+	}
+}
+
+func (c *Controller) polymorphicReference(res *jsonapi.Resource, field *coal.Field) coal.Ref {
+	// check type
+	if !stick.Contains(field.RelTypes, res.Type) {
+		xo.Abort(jsonapi.BadRequest("resource type mismatch"))
+	}
+
+	// get id
+	id, err := coal.FromHex(res.ID)
+	if err != nil {
+		xo.Abort(jsonapi.BadRequest("invalid relationship id"))
+	}
+
+	return coal.Ref{
+		Type: res.Type,
+		ID:   id,
+	}
+}
+
+func (c *Controller) inverseReference(inverse *coal.Field, model coal.Model) interface{} {
+	// use reference for polymorphic relationships
+	if inverse.PolyToOne || inverse.PolyToMany {
+		return coal.Ref{
+			Type: c.meta.PluralName,
+			ID:   model.ID(),
+		}
+	}
+
+	return model.ID()
 }
 
 func (c *Controller) preloadRelationships(ctx *Context, models []coal.Model) map[string]map[coal.ID][]coal.ID {
@@ -2098,7 +2425,7 @@ func (c *Controller) preloadRelationships(ctx *Context, models []coal.Model) map
 	// go through all relationships
 	for _, field := range c.meta.Relationships {
 		// skip to one and to many relationships
-		if field.ToOne || field.ToMany {
+		if field.ToOne || field.ToMany || field.PolyToOne || field.PolyToMany {
 			continue
 		}
 
@@ -2119,16 +2446,18 @@ func (c *Controller) preloadRelationships(ctx *Context, models []coal.Model) map
 			xo.Abort(xo.F("no relationship matching the inverse name %s", field.RelInverse))
 		}
 
-		// collect model ids
+		// collect model ids and references
 		modelIDs := make([]coal.ID, 0, len(models))
+		modelRefs := make([]interface{}, 0, len(models))
 		for _, model := range models {
 			modelIDs = append(modelIDs, model.ID())
+			modelRefs = append(modelRefs, c.inverseReference(rel, model))
 		}
 
 		// prepare query
 		query := bson.M{
 			rel.Name: bson.M{
-				"$in": modelIDs,
+				"$in": modelRefs,
 			},
 		}
 
@@ -2183,6 +2512,30 @@ func (c *Controller) preloadRelationships(ctx *Context, models []coal.Model) map
 						}
 					}
 				}
+
+				// handle polymorphic to one references
+				if rel.PolyToOne {
+					// get reference
+					ref, ok := coal.ToRef(value)
+					if ok && ref.Type == c.meta.PluralName && ref.ID == modelID {
+						// add reference
+						entry[modelID] = append(entry[modelID], id)
+					}
+				}
+
+				// handle polymorphic to many references
+				if rel.PolyToMany {
+					// get references
+					refs, _ := value.(bson.A)
+					for _, _ref := range refs {
+						// get reference
+						ref, ok := coal.ToRef(_ref)
+						if ok && ref.Type == c.meta.PluralName && ref.ID == modelID {
+							// add reference
+							entry[modelID] = append(entry[modelID], id)
+						}
+					}
+				}
 			}
 		}
 
@@ -2346,6 +2699,57 @@ func (c *Controller) constructResource(ctx *Context, model coal.Model, relations
 					Many: references,
 				},
 			}
+		} else if field.PolyToOne {
+			// prepare reference
+			var reference *jsonapi.Resource
+
+			// get reference
+			var ref coal.Ref
+			if field.Optional {
+				if oref := stick.MustGet(model, field.Name).(*coal.Ref); oref != nil {
+					ref = *oref
+				}
+			} else {
+				ref = stick.MustGet(model, field.Name).(coal.Ref)
+			}
+
+			// create reference if available
+			if !ref.IsZero() {
+				reference = &jsonapi.Resource{
+					Type: ref.Type,
+					ID:   ref.ID.Hex(),
+				}
+			}
+
+			// set links and reference
+			resource.Relationships[field.RelName] = &jsonapi.Document{
+				Links: links,
+				Data: &jsonapi.HybridResource{
+					One: reference,
+				},
+			}
+		} else if field.PolyToMany {
+			// get references
+			refs := stick.MustGet(model, field.Name).([]coal.Ref)
+
+			// prepare references
+			references := make([]*jsonapi.Resource, len(refs))
+
+			// set all references
+			for i, ref := range refs {
+				references[i] = &jsonapi.Resource{
+					Type: ref.Type,
+					ID:   ref.ID.Hex(),
+				}
+			}
+
+			// set links and references
+			resource.Relationships[field.RelName] = &jsonapi.Document{
+				Links: links,
+				Data: &jsonapi.HybridResource{
+					Many: references,
+				},
+			}
 		} else if field.HasOne {
 			// skip if nil
 			if relationships == nil {
@@ -6603,6 +6603,432 @@ func TestListLimit(t *testing.T) {
 	})
 }
 
+func TestListReadOptions(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		var called []Operation
+		tester.Assign("", &Controller{
+			Model: &postModel{},
+			ListReadOptions: &coal.ReadOptions{
+				Preference: coal.SecondaryPreferred,
+				Concern:    coal.Majority,
+			},
+			Authorizers: L{
+				C("TestAuthorizer", Authorizer, All(), func(ctx *Context) error {
+					called = append(called, ctx.Operation)
+					opts, ok := coal.GetReadOptions(ctx)
+					if ctx.Operation == List {
+						assert.True(t, ok)
+						assert.Equal(t, coal.SecondaryPreferred, opts.Preference)
+					} else {
+						assert.False(t, ok)
+					}
+					assert.True(t, coal.HasTransaction(ctx))
+
+					_, err := ctx.Store.M(&commentModel{}).Count(ctx, bson.M{}, 0, 0, false)
+					return err
+				}),
+			},
+		}, &Controller{
+			Model: &commentModel{},
+		}, &Controller{
+			Model: &selectionModel{},
+		}, &Controller{
+			Model: &noteModel{},
+		})
+
+		// create some posts
+		for i := 0; i < 3; i++ {
+			tester.Insert(&postModel{
+				Title: fmt.Sprintf("Post %d", i+1),
+			})
+		}
+
+		// list posts
+		tester.Request("GET", "posts?page[size]=2", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			list := gjson.Get(r.Body.String(), "data").Array()
+			links := gjson.Get(r.Body.String(), "links").Raw
+
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.Equal(t, 2, len(list), tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"self": "/posts?page[number]=1&page[size]=2",
+				"first": "/posts?page[number]=1&page[size]=2",
+				"last": "/posts?page[number]=2&page[size]=2",
+				"next": "/posts?page[number]=2&page[size]=2"
+			}`, linkUnescape(links))
+		})
+
+		// find post
+		tester.Request("GET", "posts/"+tester.FindLast(&postModel{}).ID().Hex(), "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+		})
+
+		assert.Equal(t, []Operation{List, Find}, called)
+	})
+}
+
+func TestPolymorphicRelationships(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, polyModelList...)
+		tester.Clean()
+
+		tester.Assign("", &Controller{
+			Model: &articleModel{},
+			Validators: L{
+				RelationshipValidator(&articleModel{}, polyModelList),
+			},
+		}, &Controller{
+			Model: &photoModel{},
+			Validators: L{
+				RelationshipValidator(&photoModel{}, polyModelList),
+			},
+		}, &Controller{
+			Model: &reactionModel{},
+			Validators: L{
+				RelationshipValidator(&reactionModel{}, polyModelList),
+			},
+		})
+
+		article := tester.Insert(&articleModel{
+			Title: "Article",
+		}).ID().Hex()
+		photo := tester.Insert(&photoModel{
+			Caption: "Photo",
+		}).ID().Hex()
+
+		// invalid type
+		tester.Request("POST", "reactions", `{
+			"data": {
+				"type": "reactions",
+				"relationships": {
+					"subject": {
+						"data": {
+							"type": "reactions",
+							"id": "`+article+`"
+						}
+					}
+				}
+			}
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"title": "bad request",
+					"detail": "resource type mismatch"
+				}]
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// missing reference
+		tester.Request("POST", "reactions", `{
+			"data": {
+				"type": "reactions",
+				"relationships": {
+					"subject": {
+						"data": {
+							"type": "photos",
+							"id": "`+article+`"
+						}
+					}
+				}
+			}
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"title": "bad request",
+					"detail": "missing references for field Subject"
+				}]
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		var reaction string
+
+		// create reaction
+		tester.Request("POST", "reactions", `{
+			"data": {
+				"type": "reactions",
+				"attributes": {
+					"kind": "like"
+				},
+				"relationships": {
+					"subject": {
+						"data": {
+							"type": "photos",
+							"id": "`+photo+`"
+						}
+					},
+					"targets": {
+						"data": [
+							{
+								"type": "articles",
+								"id": "`+article+`"
+							},
+							{
+								"type": "photos",
+								"id": "`+photo+`"
+							}
+						]
+					}
+				}
+			}
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			reaction = tester.FindLast(&reactionModel{}).ID().Hex()
+
+			assert.Equal(t, http.StatusCreated, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"data": {
+					"type": "reactions",
+					"id": "`+reaction+`",
+					"attributes": {
+						"kind": "like"
+					},
+					"relationships": {
+						"subject": {
+							"data": {
+								"type": "photos",
+								"id": "`+photo+`"
+							},
+							"links": {
+								"self": "/reactions/`+reaction+`/relationships/subject",
+								"related": "/reactions/`+reaction+`/subject"
+							}
+						},
+						"targets": {
+							"data": [
+								{
+									"type": "articles",
+									"id": "`+article+`"
+								},
+								{
+									"type": "photos",
+									"id": "`+photo+`"
+								}
+							],
+							"links": {
+								"self": "/reactions/`+reaction+`/relationships/targets",
+								"related": "/reactions/`+reaction+`/targets"
+							}
+						}
+					}
+				},
+				"links": {
+					"self": "/reactions/`+reaction+`"
+				}
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// check document
+		model := tester.Fetch(&reactionModel{}, coal.MustFromHex(reaction)).(*reactionModel)
+		assert.Equal(t, &coal.Ref{Type: "photos", ID: coal.MustFromHex(photo)}, model.Subject)
+		assert.Equal(t, []coal.Ref{
+			{Type: "articles", ID: coal.MustFromHex(article)},
+			{Type: "photos", ID: coal.MustFromHex(photo)},
+		}, model.Targets)
+
+		// get related subject
+		tester.Request("GET", "reactions/"+reaction+"/subject", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"data": {
+					"type": "photos",
+					"id": "`+photo+`",
+					"attributes": {
+						"caption": "Photo"
+					},
+					"relationships": {
+						"reactions": {
+							"data": [
+								{
+									"type": "reactions",
+									"id": "`+reaction+`"
+								}
+							],
+							"links": {
+								"self": "/photos/`+photo+`/relationships/reactions",
+								"related": "/photos/`+photo+`/reactions"
+							}
+						}
+					}
+				},
+				"links": {
+					"self": "/reactions/`+reaction+`/subject"
+				}
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// get related targets
+		tester.Request("GET", "reactions/"+reaction+"/targets", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"data": [
+					{
+						"type": "articles",
+						"id": "`+article+`",
+						"attributes": {
+							"title": "Article"
+						},
+						"relationships": {
+							"reactions": {
+								"data": [],
+								"links": {
+									"self": "/articles/`+article+`/relationships/reactions",
+									"related": "/articles/`+article+`/reactions"
+								}
+							}
+						}
+					},
+					{
+						"type": "photos",
+						"id": "`+photo+`",
+						"attributes": {
+							"caption": "Photo"
+						},
+						"relationships": {
+							"reactions": {
+								"data": [
+									{
+										"type": "reactions",
+										"id": "`+reaction+`"
+									}
+								],
+								"links": {
+									"self": "/photos/`+photo+`/relationships/reactions",
+									"related": "/photos/`+photo+`/reactions"
+								}
+							}
+						}
+					}
+				],
+				"links": {
+					"self": "/reactions/`+reaction+`/targets"
+				}
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// get related reactions
+		tester.Request("GET", "photos/"+photo+"/reactions", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.Equal(t, reaction, gjson.Get(r.Body.String(), "data.0.id").String(), tester.DebugRequest(rq, r))
+			assert.Equal(t, int64(1), gjson.Get(r.Body.String(), "data.#").Int(), tester.DebugRequest(rq, r))
+		})
+
+		// set subject
+		tester.Request("PATCH", "reactions/"+reaction+"/relationships/subject", `{
+			"data": {
+				"type": "articles",
+				"id": "`+article+`"
+			}
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"data": {
+					"type": "articles",
+					"id": "`+article+`"
+				},
+				"links": {
+					"self": "/reactions/`+reaction+`/relationships/subject",
+					"related": "/reactions/`+reaction+`/subject"
+				}
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// check inverse
+		tester.Request("GET", "articles/"+article+"/relationships/reactions", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"data": [
+					{
+						"type": "reactions",
+						"id": "`+reaction+`"
+					}
+				],
+				"links": {
+					"self": "/articles/`+article+`/relationships/reactions",
+					"related": "/articles/`+article+`/reactions"
+				}
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// remove target
+		tester.Request("DELETE", "reactions/"+reaction+"/relationships/targets", `{
+			"data": [
+				{
+					"type": "articles",
+					"id": "`+article+`"
+				}
+			]
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `[
+				{
+					"type": "photos",
+					"id": "`+photo+`"
+				}
+			]`, gjson.Get(r.Body.String(), "data").Raw, tester.DebugRequest(rq, r))
+		})
+
+		// append target
+		tester.Request("POST", "reactions/"+reaction+"/relationships/targets", `{
+			"data": [
+				{
+					"type": "photos",
+					"id": "`+photo+`"
+				},
+				{
+					"type": "articles",
+					"id": "`+article+`"
+				}
+			]
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `[
+				{
+					"type": "photos",
+					"id": "`+photo+`"
+				},
+				{
+					"type": "articles",
+					"id": "`+article+`"
+				}
+			]`, gjson.Get(r.Body.String(), "data").Raw, tester.DebugRequest(rq, r))
+		})
+
+		// delete referenced article
+		tester.Request("DELETE", "articles/"+article, "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"title": "bad request",
+					"detail": "resource has dependent resources"
+				}]
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// unset subject
+		tester.Request("PATCH", "reactions/"+reaction+"/relationships/subject", `{
+			"data": null
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.Equal(t, "null", gjson.Get(r.Body.String(), "data").Raw, tester.DebugRequest(rq, r))
+		})
+
+		// get missing related subject
+		tester.Request("GET", "reactions/"+reaction+"/subject", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"data": null,
+				"links": {
+					"self": "/reactions/`+reaction+`/subject"
+				}
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+	})
+}
+
 func TestCollectionActions(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		assert.PanicsWithValue(t, `fire: invalid collection action ""`, func() {
@@ -6974,6 +7400,79 @@ func TestSoftDelete(t *testing.T) {
 	})
 }
 
+func TestDependents(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, &topicModel{}, &replyModel{}, &linkModel{}, &pinModel{})
+		tester.Clean()
+
+		tester.Assign("", &Controller{
+			Model:      &topicModel{},
+			Dependents: coal.NewRegistry(&replyModel{}, &linkModel{}, &pinModel{}),
+		})
+
+		topic := tester.Insert(&topicModel{
+			Title: "Topic 1",
+		}).(*topicModel)
+
+		reply1 := tester.Insert(&replyModel{
+			Message: "Reply 1",
+			Topic:   topic.ID(),
+		}).(*replyModel)
+
+		reply2 := tester.Insert(&replyModel{
+			Message: "Reply 2",
+			Topic:   coal.New(),
+			Parent:  stick.P(reply1.ID()),
+		}).(*replyModel)
+
+		link := tester.Insert(&linkModel{
+			Name:   "Link 1",
+			Topics: []coal.ID{topic.ID()},
+		}).(*linkModel)
+
+		pin := tester.Insert(&pinModel{
+			Title: "Pin 1",
+			Topic: topic.ID(),
+		}).(*pinModel)
+
+		// restricted delete
+		tester.Request("DELETE", "topics/"+topic.ID().Hex(), "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [
+					{
+						"status": "400",
+						"title": "bad request",
+						"detail": "resource has dependent resources"
+					}
+				]
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		assert.Equal(t, 1, tester.Count(&topicModel{}))
+
+		tester.Delete(pin)
+
+		// delete topic
+		tester.Request("DELETE", "topics/"+topic.ID().Hex(), "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusNoContent, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.Equal(t, "", r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		assert.Equal(t, 0, tester.Count(&topicModel{}))
+
+		reply := tester.Fetch(&replyModel{}, reply1.ID()).(*replyModel)
+		assert.NotNil(t, reply.Deleted)
+
+		reply = tester.Fetch(&replyModel{}, reply2.ID()).(*replyModel)
+		assert.Nil(t, reply.Deleted)
+		assert.Nil(t, reply.Parent)
+
+		link = tester.Fetch(&linkModel{}, link.ID()).(*linkModel)
+		assert.Equal(t, []coal.ID{}, link.Topics)
+	})
+}
+
 func TestIdempotentCreate(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		// missing field on model
@@ -7461,3 +7960,123 @@ func TestTransactions(t *testing.T) {
 		assert.Equal(t, []string{"foo", "foo"}, errs)
 	})
 }
+
+func TestTreeFilters(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, &folderModel{})
+		tester.Clean()
+
+		tester.Assign("", &Controller{
+			Model:   &folderModel{},
+			Tree:    true,
+			Sorters: []string{"Name"},
+			Validators: L{
+				TreeValidator(),
+			},
+		})
+
+		a := tester.Insert(&folderModel{Name: "a"}).(*folderModel)
+		b := tester.Insert(&folderModel{Name: "b", Parent: stick.P(a.ID())}).(*folderModel)
+		c := tester.Insert(&folderModel{Name: "c", Parent: stick.P(b.ID())}).(*folderModel)
+		tester.Insert(&folderModel{Name: "d", Parent: stick.P(a.ID())})
+		x := tester.Insert(&folderModel{Name: "x"}).(*folderModel)
+
+		names := func(query string) []string {
+			var list []string
+			tester.Request("GET", "folders?sort=name&"+query, "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+				assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+				for _, name := range gjson.Get(r.Body.String(), "data.#.attributes.name").Array() {
+					list = append(list, name.String())
+				}
+			})
+			return list
+		}
+
+		// filters
+		assert.Equal(t, []string{"b", "c", "d"}, names("filter[ancestor]="+a.ID().Hex()))
+		assert.Equal(t, []string{"c"}, names("filter[ancestor]="+b.ID().Hex()))
+		assert.Equal(t, []string{"a", "x"}, names("filter[depth]=0"))
+		assert.Equal(t, []string{"b", "c", "d"}, names("filter[min-depth]=1"))
+		assert.Equal(t, []string{"b", "d"}, names("filter[ancestor]="+a.ID().Hex()+"&filter[max-depth]=1"))
+
+		// invalid filters
+		tester.Request("GET", "folders?filter[ancestor]=foo", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"title": "bad request",
+					"detail": "ancestor filter value is not an object id"
+				}]
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+		tester.Request("GET", "folders?filter[min-depth]=1,2", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"title": "bad request",
+					"detail": "depth filter expects a single value"
+				}]
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// missing parent
+		tester.Request("POST", "folders", `{
+			"data": {
+				"type": "folders",
+				"relationships": {
+					"parent": {
+						"data": {
+							"type": "folders",
+							"id": "`+coal.New().Hex()+`"
+						}
+					}
+				}
+			}
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"title": "bad request",
+					"detail": "missing parent"
+				}]
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// cycle
+		tester.Request("PATCH", "folders/"+a.ID().Hex()+"/relationships/parent", `{
+			"data": {
+				"type": "folders",
+				"id": "`+c.ID().Hex()+`"
+			}
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"title": "bad request",
+					"detail": "invalid parent"
+				}]
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// move
+		tester.Request("PATCH", "folders/"+b.ID().Hex()+"/relationships/parent", `{
+			"data": {
+				"type": "folders",
+				"id": "`+x.ID().Hex()+`"
+			}
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+		})
+
+		assert.Equal(t, []string{"b", "c"}, names("filter[ancestor]="+x.ID().Hex()))
+		assert.Equal(t, []string{"d"}, names("filter[ancestor]="+a.ID().Hex()))
+
+		c = tester.Fetch(&folderModel{}, c.ID()).(*folderModel)
+		assert.Equal(t, []coal.ID{x.ID(), b.ID()}, c.Ancestors)
+		assert.Equal(t, 2, c.Depth)
+	})
+}
@@ -0,0 +1,58 @@
+package glut
+
+import (
+	"context"
+
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+type checkpointValue struct {
+	Base               `json:"-" glut:"glut/checkpoint,0"`
+	Name               string `json:"-"`
+	Token              []byte `json:"token"`
+	stick.NoValidation `json:"-"`
+}
+
+func (v *checkpointValue) GetExtension() string {
+	return "/" + v.Name
+}
+
+// Checkpoints implements coal.Checkpoints using values.
+type Checkpoints struct {
+	store *coal.Store
+}
+
+// NewCheckpoints will create and return checkpoints that are stored as values
+// in the specified store.
+func NewCheckpoints(store *coal.Store) *Checkpoints {
+	return &Checkpoints{
+		store: store,
+	}
+}
+
+// Load implements the coal.Checkpoints interface.
+func (c *Checkpoints) Load(ctx context.Context, name string) ([]byte, error) {
+	// get value
+	value := &checkpointValue{Name: name}
+	found, err := Get(ctx, c.store, value)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return value.Token, nil
+}
+
+// Save implements the coal.Checkpoints interface.
+func (c *Checkpoints) Save(ctx context.Context, name string, token []byte) error {
+	// delete value if token is missing
+	if token == nil {
+		_, err := Delete(ctx, c.store, &checkpointValue{Name: name})
+		return err
+	}
+
+	// set value
+	_, err := Set(ctx, c.store, &checkpointValue{Name: name, Token: token})
+
+	return err
+}
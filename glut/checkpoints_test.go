@@ -0,0 +1,40 @@
+package glut
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/coal"
+)
+
+func TestCheckpoints(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *coal.Tester) {
+		checkpoints := NewCheckpoints(tester.Store)
+
+		token, err := checkpoints.Load(nil, "foo")
+		assert.NoError(t, err)
+		assert.Nil(t, token)
+
+		data, err := bson.Marshal(bson.M{"foo": "bar"})
+		assert.NoError(t, err)
+
+		err = checkpoints.Save(nil, "foo", data)
+		assert.NoError(t, err)
+
+		token, err = checkpoints.Load(nil, "foo")
+		assert.NoError(t, err)
+		assert.Equal(t, data, token)
+
+		model := tester.FindLast(&Model{}).(*Model)
+		assert.Equal(t, "glut/checkpoint/foo", model.Key)
+
+		err = checkpoints.Save(nil, "foo", nil)
+		assert.NoError(t, err)
+
+		token, err = checkpoints.Load(nil, "foo")
+		assert.NoError(t, err)
+		assert.Nil(t, token)
+	})
+}
@@ -68,6 +68,48 @@ func ConvertModel(model coal.Model) (*jsonapi.Resource, error) {
 				},
 			}
 		}
+
+		// handle polymorphic to-one relationship
+		if rel.PolyToOne {
+			val := stick.MustGet(model, rel.Name)
+			var ref coal.Ref
+			if rel.Optional {
+				if r := val.(*coal.Ref); r != nil {
+					ref = *r
+				}
+			} else {
+				ref = val.(coal.Ref)
+			}
+			if !ref.IsZero() {
+				relationships[rel.RelName] = &jsonapi.Document{
+					Data: &jsonapi.HybridResource{
+						One: &jsonapi.Resource{
+							Type: ref.Type,
+							ID:   ref.ID.Hex(),
+						},
+					},
+				}
+			} else {
+				relationships[rel.RelName] = &jsonapi.Document{}
+			}
+		}
+
+		// handle polymorphic to-many relationship
+		if rel.PolyToMany {
+			refs := stick.MustGet(model, rel.Name).([]coal.Ref)
+			many := make([]*jsonapi.Resource, 0, len(refs))
+			for _, ref := range refs {
+				many = append(many, &jsonapi.Resource{
+					Type: ref.Type,
+					ID:   ref.ID.Hex(),
+				})
+			}
+			relationships[rel.RelName] = &jsonapi.Document{
+				Data: &jsonapi.HybridResource{
+					Many: many,
+				},
+			}
+		}
 	}
 
 	// prepare resource
@@ -139,6 +181,40 @@ func AssignResource(model coal.Model, res *jsonapi.Resource) error {
 				stick.MustSet(model, rel.Name, []coal.ID(nil))
 			}
 		}
+
+		// handle polymorphic to one
+		if rel.PolyToOne {
+			var ref coal.Ref
+			if doc.Data != nil && doc.Data.One != nil {
+				ref = coal.Ref{
+					Type: doc.Data.One.Type,
+					ID:   coal.MustFromHex(doc.Data.One.ID),
+				}
+			}
+			if !rel.Optional {
+				stick.MustSet(model, rel.Name, ref)
+			} else if !ref.IsZero() {
+				stick.MustSet(model, rel.Name, &ref)
+			} else {
+				stick.MustSet(model, rel.Name, stick.N[coal.Ref]())
+			}
+		}
+
+		// handle polymorphic to many
+		if rel.PolyToMany {
+			if doc.Data != nil && len(doc.Data.Many) > 0 {
+				refs := make([]coal.Ref, 0, len(doc.Data.Many))
+				for _, res := range doc.Data.Many {
+					refs = append(refs, coal.Ref{
+						Type: res.Type,
+						ID:   coal.MustFromHex(res.ID),
+					})
+				}
+				stick.MustSet(model, rel.Name, refs)
+			} else {
+				stick.MustSet(model, rel.Name, []coal.Ref(nil))
+			}
+		}
 	}
 
 	return nil
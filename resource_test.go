@@ -235,3 +235,74 @@ func TestAssignResource(t *testing.T) {
 		Many: []coal.ID{id},
 	}, foo)
 }
+
+func TestConvertAndAssignPolymorphic(t *testing.T) {
+	id1 := coal.New()
+	id2 := coal.New()
+
+	res, err := ConvertModel(&reactionModel{
+		Base:    coal.B(id1),
+		Kind:    "like",
+		Subject: &coal.Ref{Type: "photos", ID: id2},
+		Targets: []coal.Ref{
+			{Type: "articles", ID: id1},
+			{Type: "photos", ID: id2},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &jsonapi.Resource{
+		Type: "reactions",
+		ID:   id1.Hex(),
+		Attributes: jsonapi.Map{
+			"kind": "like",
+		},
+		Relationships: map[string]*jsonapi.Document{
+			"subject": {
+				Data: &jsonapi.HybridResource{
+					One: &jsonapi.Resource{
+						Type: "photos",
+						ID:   id2.Hex(),
+					},
+				},
+			},
+			"targets": {
+				Data: &jsonapi.HybridResource{
+					Many: []*jsonapi.Resource{
+						{
+							Type: "articles",
+							ID:   id1.Hex(),
+						},
+						{
+							Type: "photos",
+							ID:   id2.Hex(),
+						},
+					},
+				},
+			},
+		},
+	}, res)
+
+	var model reactionModel
+	err = AssignResource(&model, res)
+	assert.NoError(t, err)
+	assert.Equal(t, reactionModel{
+		Base:    coal.B(id1),
+		Kind:    "like",
+		Subject: &coal.Ref{Type: "photos", ID: id2},
+		Targets: []coal.Ref{
+			{Type: "articles", ID: id1},
+			{Type: "photos", ID: id2},
+		},
+	}, model)
+
+	res, err = ConvertModel(&reactionModel{
+		Base: coal.B(id1),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &jsonapi.Document{}, res.Relationships["subject"])
+
+	err = AssignResource(&model, res)
+	assert.NoError(t, err)
+	assert.Nil(t, model.Subject)
+	assert.Nil(t, model.Targets)
+}
@@ -68,3 +68,27 @@ func (f *Factory) Make(model coal.Model, others ...coal.Model) coal.Model {
 func (f *Factory) Insert(model coal.Model, others ...coal.Model) coal.Model {
 	return f.tester.Insert(f.Make(model, others...))
 }
+
+// Load will build the provided fixtures using the registry, merge each model
+// into its registered base model if available and insert them. The inserted
+// models are returned keyed by their fixture names e.g. "posts/hello".
+func (f *Factory) Load(registry *coal.Registry, fixtures coal.Fixtures) map[string]coal.Model {
+	// build fixtures
+	list, err := fixtures.Build(registry, func(model coal.Model) coal.Model {
+		if f.registry[coal.GetMeta(model)] != nil {
+			return f.Make(model)
+		}
+		return model
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// insert models
+	models := map[string]coal.Model{}
+	for _, fixture := range list {
+		models[fixture.Name] = f.tester.Insert(fixture.Model)
+	}
+
+	return models
+}
@@ -57,3 +57,40 @@ func TestFactory(t *testing.T) {
 	tester.Fetch(res2, res1.ID())
 	assert.Equal(t, res1, res2)
 }
+
+func TestFactoryLoad(t *testing.T) {
+	tester := coal.NewTester(nil, &fooModel{})
+	factory := NewFactory(tester)
+
+	factory.Register(func() coal.Model {
+		return &fooModel{
+			String: S("foo-#"),
+		}
+	})
+
+	res := factory.Load(models, coal.Fixtures{
+		"foos": {
+			"a": {"bool": true},
+			"b": {"one": "a", "many": []interface{}{"a", "b"}},
+		},
+	})
+	assert.Len(t, res, 2)
+
+	a := res["foos/a"].(*fooModel)
+	b := res["foos/b"].(*fooModel)
+	assert.True(t, a.Bool)
+	assert.NotZero(t, a.String)
+	assert.NotZero(t, b.String)
+	assert.Equal(t, a.ID(), b.One)
+	assert.Equal(t, []coal.ID{a.ID(), b.ID()}, b.Many)
+
+	var found fooModel
+	tester.Fetch(&found, b.ID())
+	assert.Equal(t, b, &found)
+
+	assert.Panics(t, func() {
+		factory.Load(models, coal.Fixtures{
+			"foos": {"c": {"one": "missing"}},
+		})
+	})
+}
@@ -59,7 +59,12 @@ type Stream struct {
 	// SoftDelete can be set to true to support soft deleted documents.
 	SoftDelete bool
 
+	// Hub may be set to subscribe to a shared stream instead of opening a
+	// dedicated stream using the store.
+	Hub *coal.Hub
+
 	stream *coal.Stream
+	sub    *coal.Subscription
 }
 
 // Name returns the name of the stream.
@@ -68,8 +73,8 @@ func (s *Stream) Name() string {
 }
 
 func (s *Stream) open(manager *manager, reporter func(error)) {
-	// open stream
-	s.stream = coal.OpenStream(s.Store, s.Model, nil, func(e coal.Event, id coal.ID, model coal.Model, err error, token []byte) error {
+	// prepare receiver
+	receiver := func(e coal.Event, id coal.ID, model coal.Model, err error, token []byte) error {
 		// ignore opened, resumed and stopped events
 		if e == coal.Opened || e == coal.Resumed || e == coal.Stopped {
 			return nil
@@ -114,9 +119,23 @@ func (s *Stream) open(manager *manager, reporter func(error)) {
 		manager.broadcast(evt)
 
 		return nil
-	})
+	}
+
+	// subscribe hub if available
+	if s.Hub != nil {
+		s.sub = s.Hub.Subscribe(s.Model, coal.SubscriptionOptions{}, receiver)
+		return
+	}
+
+	// open stream
+	s.stream = coal.OpenStream(s.Store, s.Model, nil, receiver)
 }
 
 func (s *Stream) close() {
-	s.stream.Close()
+	// close subscription or stream
+	if s.sub != nil {
+		s.sub.Close()
+	} else {
+		s.stream.Close()
+	}
 }
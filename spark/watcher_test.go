@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/coal"
 )
 
 func TestWatcher(t *testing.T) {
@@ -100,3 +101,59 @@ func TestWatcher(t *testing.T) {
 		watcher.Close()
 	})
 }
+
+func TestWatcherHub(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *fire.Tester) {
+		hub := coal.NewHub(tester.Store)
+		defer hub.Close()
+
+		watcher := NewWatcher(xo.Panic)
+		watcher.Add(&Stream{
+			Model: &itemModel{},
+			Hub:   hub,
+		})
+		defer watcher.Close()
+
+		group := tester.Assign("", &fire.Controller{
+			Model: &itemModel{},
+		})
+		group.Handle("watch", &fire.GroupAction{
+			Action: watcher.Action(),
+		})
+
+		server := &http.Server{Addr: "0.0.0.0:1234", Handler: tester.Handler}
+		go func() { _ = server.ListenAndServe() }()
+		defer server.Close()
+
+		time.Sleep(100 * time.Millisecond)
+
+		ws, _, err := websocket.DefaultDialer.Dial("ws://0.0.0.0:1234/watch", nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, ws)
+
+		defer ws.Close()
+
+		err = ws.WriteMessage(websocket.TextMessage, []byte(`{
+			"subscribe": {
+				"items": {}
+			}
+		}`))
+		assert.NoError(t, err)
+
+		time.Sleep(100 * time.Millisecond)
+
+		itm := tester.Insert(&itemModel{
+			Bar: "bar",
+		}).(*itemModel)
+
+		_ = ws.SetReadDeadline(time.Now().Add(time.Minute))
+		typ, bytes, err := ws.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, websocket.TextMessage, typ)
+		assert.JSONEq(t, `{
+			"items": {
+				"`+itm.ID().Hex()+`": "created"
+			}
+		}`, string(bytes))
+	})
+}
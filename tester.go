@@ -230,7 +230,13 @@ func (t *Tester) WithContext(ctx *Context, fn func(ctx *Context) error) error {
 
 	// yield context
 	if !ctx.Operation.Action() && ctx.Store != nil {
-		return ctx.Store.T(ctx.Context, false, func(tc context.Context) error {
+		// get store
+		store := ctx.Store
+		if ctx.Model != nil {
+			store = store.S(ctx.Model)
+		}
+
+		return store.T(ctx.Context, false, func(tc context.Context) error {
 			return ctx.With(tc, func() error {
 				return fn(ctx)
 			})
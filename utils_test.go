@@ -93,11 +93,90 @@ type barModel struct {
 	stick.NoValidation `json:"-" bson:"-"`
 }
 
+type topicModel struct {
+	coal.Base          `json:"-" bson:",inline" coal:"topics"`
+	Title              string       `json:"title"`
+	Replies            coal.HasMany `json:"-" bson:"-" coal:"replies:replies:topic"`
+	Links              coal.HasMany `json:"-" bson:"-" coal:"links:links:topics"`
+	Pins               coal.HasMany `json:"-" bson:"-" coal:"pins:pins:topic"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type replyModel struct {
+	coal.Base          `json:"-" bson:",inline" coal:"replies"`
+	Message            string     `json:"message"`
+	Deleted            *time.Time `json:"-" bson:"deleted_at" coal:"fire-soft-delete"`
+	Parent             *coal.ID   `json:"-" bson:"parent_id" coal:"parent:replies:nullify"`
+	Topic              coal.ID    `json:"-" bson:"topic_id" coal:"topic:topics:cascade"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type linkModel struct {
+	coal.Base          `json:"-" bson:",inline" coal:"links"`
+	Name               string    `json:"name"`
+	Topics             []coal.ID `json:"-" bson:"topic_ids" coal:"topics:topics:nullify"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type pinModel struct {
+	coal.Base          `json:"-" bson:",inline" coal:"pins"`
+	Title              string  `json:"title"`
+	Topic              coal.ID `json:"-" bson:"topic_id" coal:"topic:topics:restrict"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type articleModel struct {
+	coal.Base          `json:"-" bson:",inline" coal:"articles"`
+	Title              string       `json:"title"`
+	Reactions          coal.HasMany `json:"-" bson:"-" coal:"reactions:reactions:subject"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type photoModel struct {
+	coal.Base          `json:"-" bson:",inline" coal:"photos"`
+	Caption            string       `json:"caption"`
+	Reactions          coal.HasMany `json:"-" bson:"-" coal:"reactions:reactions:subject"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type reactionModel struct {
+	coal.Base          `json:"-" bson:",inline" coal:"reactions"`
+	Kind               string     `json:"kind"`
+	Subject            *coal.Ref  `json:"-" bson:"subject" coal:"subject:articles|photos"`
+	Targets            []coal.Ref `json:"-" bson:"targets" coal:"targets:articles|photos"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type folderModel struct {
+	coal.Base          `json:"-" bson:",inline" coal:"folders"`
+	Name               string       `json:"name"`
+	Parent             *coal.ID     `json:"-" coal:"parent:folders"`
+	Children           coal.HasMany `json:"-" bson:"-" coal:"children:folders:parent"`
+	Ancestors          []coal.ID    `json:"-"`
+	Depth              int          `json:"depth"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+type itemModel struct {
+	coal.Base          `json:"-" bson:",inline" coal:"items"`
+	Name               string    `json:"name"`
+	List               string    `json:"list"`
+	Rank               coal.Rank `json:"rank"`
+	stick.NoValidation `json:"-" bson:"-"`
+}
+
+func init() {
+	coal.AddTree(&folderModel{}, "Parent", "Ancestors", "Depth")
+	coal.AddRanking(&itemModel{}, "Rank", "List")
+}
+
 var mongoStore = coal.MustConnect("mongodb://0.0.0.0/test-fire", xo.Panic)
 var lungoStore = coal.MustOpen(nil, "test-fire", xo.Panic)
 
 var modelList = []coal.Model{&postModel{}, &commentModel{}, &selectionModel{}, &noteModel{}, &fooModel{}, &barModel{}}
 
+var polyModelList = []coal.Model{&articleModel{}, &photoModel{}, &reactionModel{}}
+
 func withTester(t *testing.T, fn func(*testing.T, *Tester)) {
 	t.Run("Mongo", func(t *testing.T) {
 		tester := NewTester(mongoStore, modelList...)